@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Rafin000/call-recording-service-v2/internal/server"
+	"github.com/Rafin000/call-recording-service-v2/internal/tasks"
+)
+
+// runBackfill implements the backfill subcommand:
+//
+//	call-recording-service backfill -from 2024-05-01 -to 2024-05-03 [-customers 1001,1002] [-dry-run]
+//
+// Interrupting it is safe; running the same command again skips recordings
+// that were already archived.
+func runBackfill(args []string) error {
+	flags := flag.NewFlagSet("backfill", flag.ExitOnError)
+	from := flags.String("from", "", "first day to back up (YYYY-MM-DD, required)")
+	to := flags.String("to", "", "last day to back up (YYYY-MM-DD, defaults to -from)")
+	customers := flags.String("customers", "", "comma-separated i_customer list (defaults to all customers)")
+	dryRun := flags.Bool("dry-run", false, "only count the recordings that would be archived")
+	progressInterval := flags.Duration("progress-interval", 10*time.Second, "how often to log progress")
+	_ = flags.Parse(args)
+
+	if *from == "" {
+		flags.Usage()
+		return fmt.Errorf("-from is required")
+	}
+	if *to == "" {
+		*to = *from
+	}
+
+	opts := tasks.BackfillOptions{DryRun: *dryRun}
+
+	var err error
+	if opts.From, err = time.Parse("2006-01-02", *from); err != nil {
+		return fmt.Errorf("invalid -from: %w", err)
+	}
+	if opts.To, err = time.Parse("2006-01-02", *to); err != nil {
+		return fmt.Errorf("invalid -to: %w", err)
+	}
+	for _, iCustomer := range strings.Split(*customers, ",") {
+		if iCustomer = strings.TrimSpace(iCustomer); iCustomer != "" {
+			opts.ICustomers = append(opts.ICustomers, iCustomer)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	return server.RunBackfill(ctx, opts, *progressInterval)
+}
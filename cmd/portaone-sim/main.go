@@ -0,0 +1,49 @@
+// Command portaone-sim runs a fake PortaOne REST server for local development.
+//
+// Point the service at it with portaone.base_url: "http://localhost:8090" and
+// the same username/password given here.
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/Rafin000/call-recording-service-v2/internal/common"
+	"github.com/Rafin000/call-recording-service-v2/internal/infra/portaone/portaonesim"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:8090", "address to listen on")
+	fixtures := flag.String("fixtures", "fixtures/portaone", "directory holding xdrs.json and recordings/")
+	username := flag.String("username", "sim", "accepted PortaOne login")
+	password := flag.String("password", "sim", "accepted PortaOne password")
+	sessionTTL := flag.Duration("session-ttl", 0, "lifetime of issued sessions (0 = forever)")
+	latency := flag.Duration("latency", 0, "latency added to every request")
+	maxPageSize := flag.Int("max-page-size", 0, "reject get_customer_xdrs replies larger than this (0 = unlimited)")
+	flag.Parse()
+
+	logLevel := new(slog.LevelVar)
+	logLevel.Set(slog.LevelDebug)
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, common.GetTextHandlerOptions(logLevel))))
+
+	sim, err := portaonesim.New(portaonesim.Options{
+		Username:    *username,
+		Password:    *password,
+		FixturesDir: *fixtures,
+		SessionTTL:  *sessionTTL,
+		Latency:     *latency,
+		MaxPageSize: *maxPageSize,
+	})
+	if err != nil {
+		slog.Error("failed to start PortaOne simulator", "error", err)
+		os.Exit(1)
+	}
+
+	slog.Info("PortaOne simulator listening", "addr", *addr)
+	if err := http.ListenAndServe(*addr, sim); err != nil {
+		slog.Error("PortaOne simulator stopped", "error", err)
+		os.Exit(1)
+	}
+}
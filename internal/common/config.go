@@ -2,7 +2,12 @@ package common
 
 import (
 	"fmt"
+	"net/url"
+	"sort"
+	"time"
+	_ "time/tzdata" // time zones must load in images without a zoneinfo database
 
+	"github.com/robfig/cron/v3"
 	"github.com/spf13/viper"
 )
 
@@ -16,23 +21,248 @@ type AppConfig struct {
 	MongoDB  MongoDBConfig  `mapstructure:"mongodb"`
 	Redis    RedisConfig    `mapstructure:"redis"`
 	PortaOne PortaOneConfig `mapstructure:"portaone"`
+	Backup   BackupConfig   `mapstructure:"backup"`
+	Leader   LeaderConfig   `mapstructure:"leader_election"`
+	Jobs     JobsConfig     `mapstructure:"jobs"`
+	Storage  StorageConfig  `mapstructure:"storage"`
+	Export   ExportConfig   `mapstructure:"export"`
 }
 
 type AppSettings struct {
-	Env                  string `mapstructure:"env"`
-	GinMode              string `mapstructure:"gin_mode"`
-	ServerAddress        string `mapstructure:"server_address"`
-	SECRET_KEY           string `mapstructure:"secret_key"`
-	S3_BUCKET_NAME       string `mapstructure:"s3_bucket_name"`
-	S3_ENDPOINT_URL      string `mapstructure:"s3_endpoint_url"`
-	AWS_ACCESS_KEY       string `mapstructure:"aws_access_key"`
-	AWS_REGION           string `mapstructure:"aws_region"`
+	Env                   string `mapstructure:"env"`
+	GinMode               string `mapstructure:"gin_mode"`
+	ServerAddress         string `mapstructure:"server_address"`
+	SECRET_KEY            string `mapstructure:"secret_key"`
+	S3_BUCKET_NAME        string `mapstructure:"s3_bucket_name"`
+	S3_ENDPOINT_URL       string `mapstructure:"s3_endpoint_url"`
+	AWS_ACCESS_KEY        string `mapstructure:"aws_access_key"`
+	AWS_REGION            string `mapstructure:"aws_region"`
 	AWS_SECRET_ACCESS_KEY string `mapstructure:"aws_secret_access_key"`
+	// PublicBaseURL is the scheme, host and any path prefix clients reach the
+	// service by, used for the links it hands out. Links go to the Host of
+	// the request when empty.
+	PublicBaseURL string `mapstructure:"public_base_url"`
 }
 
+// PortaOneConfig describes the default PortaOne instance inline, plus any
+// additional named instances and the customers that live on them.
 type PortaOneConfig struct {
-	Username string `mapstructure:"username"`
-	Password string `mapstructure:"password"`
+	PortaOneInstanceConfig `mapstructure:",squash"`
+	Instances              map[string]PortaOneInstanceConfig `mapstructure:"instances"`
+	Customers              map[string]string                 `mapstructure:"customers"`
+}
+
+type PortaOneInstanceConfig struct {
+	BaseURL            string               `mapstructure:"base_url"`
+	Username           string               `mapstructure:"username"`
+	Password           string               `mapstructure:"password"`
+	Timeout            time.Duration        `mapstructure:"timeout"`
+	InsecureSkipVerify bool                 `mapstructure:"insecure_skip_verify"`
+	CACertFile         string               `mapstructure:"ca_cert_file"`
+	PageSize           int                  `mapstructure:"page_size"`
+	Retry              RetryConfig          `mapstructure:"retry"`
+	CircuitBreaker     CircuitBreakerConfig `mapstructure:"circuit_breaker"`
+}
+
+// RetryConfig bounds the exponential backoff used for transient failures.
+type RetryConfig struct {
+	MaxAttempts    int           `mapstructure:"max_attempts"`
+	InitialBackoff time.Duration `mapstructure:"initial_backoff"`
+	MaxBackoff     time.Duration `mapstructure:"max_backoff"`
+}
+
+// CircuitBreakerConfig controls when outbound calls start failing fast.
+type CircuitBreakerConfig struct {
+	FailureThreshold int           `mapstructure:"failure_threshold"`
+	OpenTimeout      time.Duration `mapstructure:"open_timeout"`
+}
+
+// PortaOneDefaultInstance is the name of the instance configured inline under portaone.
+const PortaOneDefaultInstance = "default"
+
+// Instance returns the configuration of a named PortaOne instance.
+// An empty name refers to the default instance.
+func (c PortaOneConfig) Instance(name string) (PortaOneInstanceConfig, bool) {
+	if name == "" || name == PortaOneDefaultInstance {
+		return c.PortaOneInstanceConfig, true
+	}
+	instance, ok := c.Instances[name]
+	return instance, ok
+}
+
+// BackupConfig limits how many recordings the backup archives at once, and
+// how recordings that fail to archive are retried.
+type BackupConfig struct {
+	Workers            int          `mapstructure:"workers"`
+	PerCustomerWorkers int          `mapstructure:"per_customer_workers"`
+	Verify             VerifyConfig `mapstructure:"verify"`
+	Retry              RetryConfig  `mapstructure:"retry"`
+}
+
+// VerifyConfig controls how archived recordings are re-checked.
+type VerifyConfig struct {
+	BatchSize     int           `mapstructure:"batch_size"`
+	ReverifyAfter time.Duration `mapstructure:"reverify_after"`
+}
+
+// LeaderConfig controls the Redis lease that picks the one replica running
+// scheduled jobs.
+type LeaderConfig struct {
+	Enabled bool          `mapstructure:"enabled"`
+	Key     string        `mapstructure:"key"`
+	TTL     time.Duration `mapstructure:"ttl"`
+}
+
+// Storage backends for archived recordings.
+const (
+	StorageBackendS3         = "s3"
+	StorageBackendFilesystem = "filesystem"
+)
+
+// StorageConfig selects where recordings are archived. The S3 backend uses the
+// s3_* and aws_* settings under app.
+type StorageConfig struct {
+	Backend    string                  `mapstructure:"backend"`
+	Filesystem FilesystemStorageConfig `mapstructure:"filesystem"`
+	// SignedURLTTL is how long a signed playback URL stays valid.
+	SignedURLTTL time.Duration `mapstructure:"signed_url_ttl"`
+}
+
+// FilesystemStorageConfig configures archiving to a local or mounted directory.
+type FilesystemStorageConfig struct {
+	Root string `mapstructure:"root"`
+}
+
+// ExportConfig bounds bulk recording downloads.
+type ExportConfig struct {
+	// MaxBytes caps the size of the recordings in one download.
+	MaxBytes int64 `mapstructure:"max_bytes"`
+	// SyncMaxBytes is the most that is zipped while the client waits; larger
+	// downloads are built in the background and fetched from a link.
+	SyncMaxBytes int64 `mapstructure:"sync_max_bytes"`
+	// Retention is how long a background export stays downloadable.
+	Retention time.Duration `mapstructure:"retention"`
+	// MaxConcurrent caps the background exports one replica builds at once.
+	MaxConcurrent int `mapstructure:"max_concurrent"`
+}
+
+// Names of the scheduled jobs.
+const (
+	JobBackup = "backup"
+	JobVerify = "verify"
+	JobRetry  = "retry"
+)
+
+// JobNames lists every scheduled job, in the order they are registered.
+var JobNames = []string{JobBackup, JobVerify, JobRetry}
+
+// DefaultTimeZone is the zone customers' calendar days are counted in: by the
+// XDR routes, and by the backup job unless its time_zone says otherwise. It is
+// UTC+6 all year.
+const DefaultTimeZone = "Asia/Dhaka"
+
+// DefaultLocation is DefaultTimeZone loaded.
+var DefaultLocation = mustLoadLocation(DefaultTimeZone)
+
+func mustLoadLocation(name string) *time.Location {
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return location
+}
+
+// JobsConfig schedules the background jobs by name. Jobs left out keep their
+// default schedule.
+type JobsConfig map[string]JobConfig
+
+// JobConfig schedules one background job.
+type JobConfig struct {
+	// Enabled defaults to true when unset.
+	Enabled *bool `mapstructure:"enabled"`
+	// Schedule is a standard five-field cron expression.
+	Schedule string `mapstructure:"schedule"`
+	// TimeZone is the IANA zone the schedule is evaluated in, and the backup
+	// job's days are counted in; UTC when empty.
+	TimeZone string `mapstructure:"time_zone"`
+	// Lookback is how far back a run reaches, for jobs that cover a time range.
+	Lookback time.Duration `mapstructure:"lookback"`
+}
+
+// Location returns the zone the job runs in, UTC when TimeZone is empty.
+// TimeZone is checked when the config is loaded.
+func (c JobConfig) Location() *time.Location {
+	location, err := time.LoadLocation(c.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// IsEnabled reports whether the job should be scheduled.
+func (c JobConfig) IsEnabled() bool {
+	return c.Enabled == nil || *c.Enabled
+}
+
+// Job returns the configuration of a job layered over its defaults: fields
+// set in the config win.
+func (c JobsConfig) Job(name string, defaults JobConfig) JobConfig {
+	job, ok := c[name]
+	if !ok {
+		return defaults
+	}
+	if job.Enabled == nil {
+		job.Enabled = defaults.Enabled
+	}
+	if job.Schedule == "" {
+		job.Schedule = defaults.Schedule
+	}
+	if job.TimeZone == "" {
+		job.TimeZone = defaults.TimeZone
+	}
+	if job.Lookback == 0 {
+		job.Lookback = defaults.Lookback
+	}
+	return job
+}
+
+// Validate rejects unknown job names, cron expressions and time zones.
+func (c JobsConfig) Validate() error {
+	names := make([]string, 0, len(c))
+	for name := range c {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		job := c[name]
+		if !isJobName(name) {
+			return fmt.Errorf("jobs.%s: unknown job, expected one of %v", name, JobNames)
+		}
+		if job.Schedule != "" {
+			if _, err := cron.ParseStandard(job.Schedule); err != nil {
+				return fmt.Errorf("jobs.%s.schedule: %w", name, err)
+			}
+		}
+		if job.TimeZone != "" {
+			if _, err := time.LoadLocation(job.TimeZone); err != nil {
+				return fmt.Errorf("jobs.%s.time_zone: %w", name, err)
+			}
+		}
+		if job.Lookback < 0 {
+			return fmt.Errorf("jobs.%s.lookback must not be negative", name)
+		}
+	}
+	return nil
+}
+
+func isJobName(name string) bool {
+	for _, known := range JobNames {
+		if name == known {
+			return true
+		}
+	}
+	return false
 }
 
 // type DBConfig struct {
@@ -67,5 +297,78 @@ func LoadConfig() (*AppConfig, error) {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
 	return &config, nil
 }
+
+// Validate checks the configuration for mistakes that would only surface at runtime.
+func (c *AppConfig) Validate() error {
+	if c.PortaOne.BaseURL == "" {
+		return fmt.Errorf("portaone.base_url is required")
+	}
+
+	for name, instance := range c.PortaOne.Instances {
+		if name == PortaOneDefaultInstance {
+			return fmt.Errorf("portaone.instances.%s: name is reserved for the inline instance", name)
+		}
+		if instance.BaseURL == "" {
+			return fmt.Errorf("portaone.instances.%s.base_url is required", name)
+		}
+	}
+
+	for iCustomer, name := range c.PortaOne.Customers {
+		if _, ok := c.PortaOne.Instance(name); !ok {
+			return fmt.Errorf("portaone.customers.%s: unknown instance %q", iCustomer, name)
+		}
+	}
+
+	if c.App.PublicBaseURL != "" {
+		base, err := url.Parse(c.App.PublicBaseURL)
+		if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" || base.RawQuery != "" {
+			return fmt.Errorf("app.public_base_url must be an http or https URL without a query")
+		}
+	}
+
+	if c.Leader.Enabled && c.Leader.TTL > 0 && c.Leader.TTL < 3*time.Second {
+		return fmt.Errorf("leader_election.ttl must be at least 3s")
+	}
+
+	if c.Backup.Workers < 0 || c.Backup.PerCustomerWorkers < 0 {
+		return fmt.Errorf("backup.workers and backup.per_customer_workers must not be negative")
+	}
+
+	if c.Backup.Retry.InitialBackoff > 0 && c.Backup.Retry.MaxBackoff > 0 && c.Backup.Retry.MaxBackoff < c.Backup.Retry.InitialBackoff {
+		return fmt.Errorf("backup.retry.max_backoff must not be less than backup.retry.initial_backoff")
+	}
+
+	switch c.Storage.Backend {
+	case "", StorageBackendS3:
+	case StorageBackendFilesystem:
+		if c.Storage.Filesystem.Root == "" {
+			return fmt.Errorf("storage.filesystem.root is required for the filesystem backend")
+		}
+	default:
+		return fmt.Errorf("storage.backend: unknown backend %q, expected %s or %s", c.Storage.Backend, StorageBackendS3, StorageBackendFilesystem)
+	}
+
+	// S3 refuses to presign for longer than a week
+	if c.Storage.SignedURLTTL < 0 || c.Storage.SignedURLTTL > 7*24*time.Hour {
+		return fmt.Errorf("storage.signed_url_ttl must be between 0 and 168h")
+	}
+
+	if c.Export.MaxBytes < 0 || c.Export.SyncMaxBytes < 0 || c.Export.Retention < 0 || c.Export.MaxConcurrent < 0 {
+		return fmt.Errorf("export.max_bytes, export.sync_max_bytes, export.retention and export.max_concurrent must not be negative")
+	}
+	if c.Export.MaxBytes > 0 && c.Export.SyncMaxBytes > c.Export.MaxBytes {
+		return fmt.Errorf("export.sync_max_bytes must not exceed export.max_bytes")
+	}
+
+	if err := c.Jobs.Validate(); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -2,21 +2,35 @@ package cron
 
 import (
 	"context"
-	"log/slog"
+	"fmt"
+	"time"
 
 	"github.com/Rafin000/call-recording-service-v2/internal/common"
-	"github.com/Rafin000/call-recording-service-v2/internal/domain"
-	"github.com/Rafin000/call-recording-service-v2/internal/infra/portaone"
 	"github.com/Rafin000/call-recording-service-v2/internal/tasks"
-	"github.com/go-co-op/gocron"
 )
 
-// RegisterReportJobs schedules reporting-related jobs.
-func RegisterBackupJobs(scheduler *gocron.Scheduler, userRepo domain.UserRepository, XDRRepo domain.XDRRepository, c context.Context, cfg common.AppSettings, portaOneClient portaone.PortaOneClient) {
-	_, err := scheduler.Every(5).Minutes().Do(func() {
-		tasks.BackupTask(userRepo, XDRRepo, c, cfg, portaOneClient)
-	})
-	if err != nil {
-		slog.Error("failed to schedule report job", "error", err)
+// maxTriggerLookback bounds the lookback of a triggered backup; longer ranges
+// belong in a backfill.
+const maxTriggerLookback = 31 * 24 * time.Hour
+
+// backupJob backs up recent recordings over the job's lookback window, in
+// days of the job's time zone. A triggered run may pass its own lookback, e.g.
+// {"lookback": "72h"}.
+func backupJob(backup *tasks.Backup) jobFunc {
+	return func(cfg common.JobConfig, params JobParams) (runFunc, error) {
+		if err := params.only("lookback"); err != nil {
+			return nil, err
+		}
+		lookback, err := params.duration("lookback", cfg.Lookback)
+		if err != nil {
+			return nil, err
+		}
+		if lookback > maxTriggerLookback {
+			return nil, fmt.Errorf("lookback must not exceed %s, use a backfill instead", maxTriggerLookback)
+		}
+
+		return func(c context.Context, progress *tasks.Progress) {
+			backup.Run(c, lookback, cfg.Location(), progress)
+		}, nil
 	}
 }
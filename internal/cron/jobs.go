@@ -8,33 +8,193 @@ import (
 	"github.com/Rafin000/call-recording-service-v2/internal/common"
 	"github.com/Rafin000/call-recording-service-v2/internal/domain"
 	"github.com/Rafin000/call-recording-service-v2/internal/infra/portaone"
+	"github.com/Rafin000/call-recording-service-v2/internal/infra/redis"
+	"github.com/Rafin000/call-recording-service-v2/internal/infra/storage"
+	"github.com/Rafin000/call-recording-service-v2/internal/tasks"
 	"github.com/go-co-op/gocron"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
+const (
+	defaultLeaderKey = "call_recording_service:leader"
+	defaultLeaderTTL = 30 * time.Second
+)
+
+// defaultJobs are the schedules of jobs not configured under jobs.
+var defaultJobs = map[string]common.JobConfig{
+	common.JobBackup: {Schedule: "*/5 * * * *", TimeZone: common.DefaultTimeZone, Lookback: 24 * time.Hour},
+	common.JobVerify: {Schedule: "0 3 * * *"},
+	common.JobRetry:  {Schedule: "* * * * *"},
+}
+
+// JobConfig returns the configuration of a job in jobs layered over its
+// defaults.
+func JobConfig(jobs common.JobsConfig, name string) common.JobConfig {
+	return jobs.Job(name, defaultJobs[name])
+}
+
 // JobManager holds the scheduler instance.
 type JobManager struct {
-	Scheduler      *gocron.Scheduler
-	UserRepo       domain.UserRepository
-	XDRRepo        domain.XDRRepository
-	portaOneClient portaone.PortaOneClient
-	config         common.AppSettings
-	C              context.Context
+	Scheduler *gocron.Scheduler
+	UserRepo  domain.UserRepository
+	XDRRepo   domain.XDRRepository
+	Backup    *tasks.Backup
+	Verifier  *tasks.Verifier
+	Leader    *redis.LeaderElector
+	Jobs      common.JobsConfig
+	C         context.Context
+	cancel    context.CancelFunc
+	jobs      map[string]*registeredJob
 }
 
 // NewJobManager initializes a new JobManager.
-func NewJobManager(c context.Context, mongoDB *mongo.Database, portaOneClient portaone.PortaOneClient, cfg common.AppSettings) *JobManager {
+// Jobs run with a context detached from c that is cancelled by Stop.
+func NewJobManager(c context.Context, mongoDB *mongo.Database, redisClient redis.RedisClient, portaOne portaone.Registry, store storage.RecordingStore, cfg common.AppConfig) *JobManager {
 	userRepo := domain.NewUserRepository(mongoDB)
 	XDRRepo := domain.NewXDRRepository(mongoDB)
+	backup := tasks.NewBackup(userRepo, XDRRepo, domain.NewBackupRunRepository(mongoDB), domain.NewRecordingRetryRepository(mongoDB), domain.NewBackfillRepository(mongoDB), store, portaOne, cfg.Backup)
+	verifier := tasks.NewVerifier(XDRRepo, domain.NewIntegrityReportRepository(mongoDB), store, cfg.Backup)
 	scheduler := gocron.NewScheduler(time.UTC)
-	return &JobManager{Scheduler: scheduler, UserRepo: userRepo, XDRRepo: XDRRepo, C: c, portaOneClient: portaOneClient, config: cfg}
+	jobCtx, cancel := context.WithCancel(context.WithoutCancel(c))
+
+	var leader *redis.LeaderElector
+	if cfg.Leader.Enabled {
+		key, ttl := cfg.Leader.Key, cfg.Leader.TTL
+		if key == "" {
+			key = defaultLeaderKey
+		}
+		if ttl <= 0 {
+			ttl = defaultLeaderTTL
+		}
+		leader = redis.NewLeaderElector(redisClient, key, ttl)
+	}
+
+	return &JobManager{Scheduler: scheduler, UserRepo: userRepo, XDRRepo: XDRRepo, Backup: backup, Verifier: verifier, Leader: leader, Jobs: cfg.Jobs, C: jobCtx, cancel: cancel, jobs: make(map[string]*registeredJob)}
 }
 
 // RegisterJobs sets up all scheduled jobs.
 func (jm *JobManager) RegisterJobs() {
+	if jm.Leader != nil {
+		go jm.Leader.Run(jm.C)
+	}
 
-	RegisterBackupJobs(jm.Scheduler, jm.UserRepo, jm.XDRRepo, jm.C, jm.config, jm.portaOneClient)
+	jm.register(common.JobBackup, backupJob(jm.Backup))
+	jm.register(common.JobVerify, verifyJob(jm.Verifier))
+	jm.register(common.JobRetry, retryJob(jm.Backup))
 
 	jm.Scheduler.StartAsync()
-	slog.Info("gocron scheduler started")
+	slog.Info("gocron scheduler started", "leaderElection", jm.Leader != nil)
+}
+
+// register adds a job and, unless it is disabled, runs it on its cron
+// schedule. Scheduled runs are skipped when JobContext says this replica must
+// not run them, or when the job is still running from an earlier run.
+func (jm *JobManager) register(name string, build jobFunc) {
+	job := &registeredJob{name: name, cfg: JobConfig(jm.Jobs, name), build: build}
+	jm.jobs[name] = job
+
+	if !job.cfg.IsEnabled() {
+		slog.Info("Job disabled", "job", name)
+		return
+	}
+
+	schedule := job.cfg.Schedule
+	if job.cfg.TimeZone != "" {
+		schedule = "CRON_TZ=" + job.cfg.TimeZone + " " + schedule
+	}
+
+	scheduled, err := jm.Scheduler.Cron(schedule).SingletonMode().Tag(name).Do(func() {
+		c, ok := jm.JobContext()
+		if !ok {
+			slog.Debug("Not the leader, skipping job", "job", name)
+			return
+		}
+		run, err := job.start(c, TriggerSchedule, nil)
+		if err != nil {
+			slog.Warn("Skipping scheduled job", "job", name, "error", err)
+			return
+		}
+		<-run.Done()
+	})
+	if err != nil {
+		slog.Error("failed to schedule job", "job", name, "error", err)
+		return
+	}
+	job.scheduled = scheduled
+	slog.Info("Scheduled job", "job", name, "schedule", job.cfg.Schedule, "timeZone", job.cfg.TimeZone)
+}
+
+// ListJobs describes every registered job, in registration order.
+func (jm *JobManager) ListJobs() []JobInfo {
+	jobs := make([]JobInfo, 0, len(jm.jobs))
+	for _, name := range common.JobNames {
+		if job, ok := jm.jobs[name]; ok {
+			jobs = append(jobs, job.info())
+		}
+	}
+	return jobs
+}
+
+// GetJob describes one registered job.
+func (jm *JobManager) GetJob(name string) (JobInfo, error) {
+	job, ok := jm.jobs[name]
+	if !ok {
+		return JobInfo{}, ErrJobNotFound
+	}
+	return job.info(), nil
+}
+
+// TriggerJob starts a run of a job right away, whether or not it is enabled or
+// this replica is the leader. The run is cancelled by CancelJob or Stop.
+func (jm *JobManager) TriggerJob(name string, params JobParams) (*JobRun, error) {
+	job, ok := jm.jobs[name]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	return job.start(jm.C, TriggerManual, params)
+}
+
+// CancelJob cancels the running run of a job, scheduled or triggered.
+func (jm *JobManager) CancelJob(name string) (*JobRun, error) {
+	job, ok := jm.jobs[name]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	return job.cancelRun()
+}
+
+// JobContext returns the context scheduled runs get, or false when they must
+// not run on this replica. With leader election enabled, jobs only run on the
+// leader and are cancelled if it loses the lease.
+func (jm *JobManager) JobContext() (context.Context, bool) {
+	if jm.Leader == nil {
+		return jm.C, true
+	}
+	return jm.Leader.LeaderContext()
+}
+
+// Stop stops scheduling new runs, cancels the jobs that are running and waits
+// until they have returned or ctx is done, so that none is left writing to the
+// database after shutdown.
+func (jm *JobManager) Stop(ctx context.Context) {
+	// Cancel first: stopping the scheduler waits for the scheduled runs
+	jm.cancel()
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		jm.Scheduler.Stop()
+		for _, job := range jm.jobs {
+			if run := job.running(); run != nil {
+				<-run.Done()
+			}
+		}
+	}()
+
+	select {
+	case <-stopped:
+		slog.Info("gocron scheduler stopped")
+	case <-ctx.Done():
+		slog.Warn("Gave up waiting for jobs to stop", "error", ctx.Err())
+	}
 }
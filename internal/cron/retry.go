@@ -0,0 +1,17 @@
+package cron
+
+import (
+	"github.com/Rafin000/call-recording-service-v2/internal/common"
+	"github.com/Rafin000/call-recording-service-v2/internal/tasks"
+)
+
+// retryJob retries the recordings in the retry queue that are due. It takes
+// no parameters.
+func retryJob(backup *tasks.Backup) jobFunc {
+	return func(cfg common.JobConfig, params JobParams) (runFunc, error) {
+		if err := params.only(); err != nil {
+			return nil, err
+		}
+		return backup.RetryRecordings, nil
+	}
+}
@@ -0,0 +1,265 @@
+package cron
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Rafin000/call-recording-service-v2/internal/common"
+	"github.com/Rafin000/call-recording-service-v2/internal/tasks"
+	"github.com/go-co-op/gocron"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// What started a job run.
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+// Job run states.
+const (
+	JobRunRunning   = "running"
+	JobRunCompleted = "completed"
+	JobRunCancelled = "cancelled"
+)
+
+var (
+	ErrJobNotFound      = errors.New("job not found")
+	ErrJobRunning       = errors.New("job is already running")
+	ErrJobNotRunning    = errors.New("job is not running")
+	ErrInvalidJobParams = errors.New("invalid job parameters")
+)
+
+// JobParams are the parameters of a manually triggered run.
+type JobParams map[string]string
+
+// only rejects parameters a job doesn't take.
+func (p JobParams) only(keys ...string) error {
+	for key := range p {
+		known := false
+		for _, k := range keys {
+			known = known || key == k
+		}
+		if !known {
+			return fmt.Errorf("unknown parameter %q", key)
+		}
+	}
+	return nil
+}
+
+// duration parses a positive duration parameter, or returns def if it is unset.
+func (p JobParams) duration(key string, def time.Duration) (time.Duration, error) {
+	value, ok := p[key]
+	if !ok {
+		return def, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%s must be a positive duration such as 48h", key)
+	}
+	return d, nil
+}
+
+// int parses a positive integer parameter, or returns def if it is unset.
+func (p JobParams) int(key string, def int) (int, error) {
+	value, ok := p[key]
+	if !ok {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("%s must be a positive integer", key)
+	}
+	return n, nil
+}
+
+// runFunc is one run of a job.
+type runFunc func(c context.Context, progress *tasks.Progress)
+
+// jobFunc validates the parameters of a run of a job configured with cfg and
+// returns the run. Scheduled runs get no parameters.
+type jobFunc func(cfg common.JobConfig, params JobParams) (runFunc, error)
+
+// registeredJob is a job known to the JobManager, with its runs on this replica.
+type registeredJob struct {
+	name      string
+	cfg       common.JobConfig
+	build     jobFunc
+	scheduled *gocron.Job
+
+	mu      sync.Mutex
+	current *JobRun
+	last    *JobRun
+}
+
+// JobRun is one run of a job on this replica.
+type JobRun struct {
+	id        string
+	job       string
+	trigger   string
+	params    JobParams
+	startedAt time.Time
+	cancel    context.CancelFunc
+	done      chan struct{}
+	progress  *tasks.Progress
+
+	mu         sync.Mutex
+	state      string
+	finishedAt *time.Time
+}
+
+// JobRunInfo is a snapshot of a job run.
+type JobRunInfo struct {
+	ID         string                 `json:"id"`
+	Job        string                 `json:"job"`
+	Trigger    string                 `json:"trigger"`
+	Params     JobParams              `json:"params,omitempty"`
+	State      string                 `json:"state"`
+	StartedAt  time.Time              `json:"started_at"`
+	FinishedAt *time.Time             `json:"finished_at,omitempty"`
+	Progress   tasks.ProgressSnapshot `json:"progress"`
+}
+
+// Info returns the current state and progress of the run.
+func (r *JobRun) Info() JobRunInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return JobRunInfo{
+		ID:         r.id,
+		Job:        r.job,
+		Trigger:    r.trigger,
+		Params:     r.params,
+		State:      r.state,
+		StartedAt:  r.startedAt,
+		FinishedAt: r.finishedAt,
+		Progress:   r.progress.Snapshot(),
+	}
+}
+
+// Done is closed once the run has stopped.
+func (r *JobRun) Done() <-chan struct{} {
+	return r.done
+}
+
+// JobInfo describes a registered job and its runs on this replica.
+type JobInfo struct {
+	Name     string      `json:"name"`
+	Enabled  bool        `json:"enabled"`
+	Schedule string      `json:"schedule"`
+	TimeZone string      `json:"time_zone,omitempty"`
+	Lookback string      `json:"lookback,omitempty"`
+	NextRun  *time.Time  `json:"next_run,omitempty"`
+	Running  *JobRunInfo `json:"running,omitempty"`
+	LastRun  *JobRunInfo `json:"last_run,omitempty"`
+}
+
+func (j *registeredJob) info() JobInfo {
+	info := JobInfo{
+		Name:     j.name,
+		Enabled:  j.cfg.IsEnabled(),
+		Schedule: j.cfg.Schedule,
+		TimeZone: j.cfg.TimeZone,
+	}
+	if j.cfg.Lookback > 0 {
+		info.Lookback = j.cfg.Lookback.String()
+	}
+	if j.scheduled != nil {
+		if next := j.scheduled.NextRun(); !next.IsZero() {
+			info.NextRun = &next
+		}
+	}
+
+	j.mu.Lock()
+	current, last := j.current, j.last
+	j.mu.Unlock()
+
+	if current != nil {
+		running := current.Info()
+		info.Running = &running
+	}
+	if last != nil {
+		lastRun := last.Info()
+		info.LastRun = &lastRun
+	}
+	return info
+}
+
+// start runs the job in the background with a context derived from c. A job
+// runs at most once at a time on a replica.
+func (j *registeredJob) start(c context.Context, trigger string, params JobParams) (*JobRun, error) {
+	run, err := j.build(j.cfg, params)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidJobParams, err)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.current != nil {
+		return nil, ErrJobRunning
+	}
+
+	ctx, cancel := context.WithCancel(c)
+	jobRun := &JobRun{
+		id:        primitive.NewObjectID().Hex(),
+		job:       j.name,
+		trigger:   trigger,
+		params:    params,
+		startedAt: time.Now(),
+		cancel:    cancel,
+		done:      make(chan struct{}),
+		progress:  &tasks.Progress{},
+		state:     JobRunRunning,
+	}
+	j.current = jobRun
+
+	go func() {
+		defer close(jobRun.done)
+		defer cancel()
+
+		slog.Info("Job started", "job", j.name, "run", jobRun.id, "trigger", trigger)
+		run(ctx, jobRun.progress)
+
+		finishedAt := time.Now()
+		jobRun.mu.Lock()
+		jobRun.finishedAt = &finishedAt
+		jobRun.state = JobRunCompleted
+		if ctx.Err() != nil {
+			jobRun.state = JobRunCancelled
+		}
+		jobRun.mu.Unlock()
+
+		j.mu.Lock()
+		j.current, j.last = nil, jobRun
+		j.mu.Unlock()
+
+		slog.Info("Job finished", "job", j.name, "run", jobRun.id, "state", jobRun.Info().State, "duration", finishedAt.Sub(jobRun.startedAt))
+	}()
+
+	return jobRun, nil
+}
+
+// running returns the job's running run, or nil if it isn't running.
+func (j *registeredJob) running() *JobRun {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.current
+}
+
+// cancelRun cancels the context of the job's running run.
+func (j *registeredJob) cancelRun() (*JobRun, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.current == nil {
+		return nil, ErrJobNotRunning
+	}
+	j.current.cancel()
+	return j.current, nil
+}
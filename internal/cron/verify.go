@@ -0,0 +1,26 @@
+package cron
+
+import (
+	"context"
+
+	"github.com/Rafin000/call-recording-service-v2/internal/common"
+	"github.com/Rafin000/call-recording-service-v2/internal/tasks"
+)
+
+// verifyJob checks one batch of archived recordings. A triggered run may pass
+// its own batch size, e.g. {"batch_size": "200"}.
+func verifyJob(verifier *tasks.Verifier) jobFunc {
+	return func(cfg common.JobConfig, params JobParams) (runFunc, error) {
+		if err := params.only("batch_size"); err != nil {
+			return nil, err
+		}
+		batchSize, err := params.int("batch_size", 0)
+		if err != nil {
+			return nil, err
+		}
+
+		return func(c context.Context, progress *tasks.Progress) {
+			verifier.Run(c, batchSize, progress)
+		}, nil
+	}
+}
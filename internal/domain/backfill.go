@@ -0,0 +1,33 @@
+package domain
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Backfill is the progress of a backfill, stored in the backfills collection
+// so that it outlives the process running it. UpdatedAt is refreshed while the
+// backfill runs.
+type Backfill struct {
+	ID          primitive.ObjectID `bson:"_id"`
+	State       string             `bson:"state"`
+	From        time.Time          `bson:"from"`
+	To          time.Time          `bson:"to"`
+	TimeZone    string             `bson:"time_zone"`
+	ICustomers  []string           `bson:"i_customers,omitempty"`
+	DryRun      bool               `bson:"dry_run"`
+	DaysTotal   int                `bson:"days_total"`
+	DaysDone    int                `bson:"days_done"`
+	DaysSkipped int                `bson:"days_skipped"`
+	CurrentDay  string             `bson:"current_day,omitempty"`
+	XDRs        int64              `bson:"xdrs"`
+	Archived    int64              `bson:"archived"`
+	Skipped     int64              `bson:"skipped"`
+	Pending     int64              `bson:"pending"`
+	Failed      int64              `bson:"failed"`
+	Queued      int64              `bson:"queued"`
+	StartedAt   time.Time          `bson:"started_at"`
+	UpdatedAt   time.Time          `bson:"updated_at"`
+	FinishedAt  *time.Time         `bson:"finished_at,omitempty"`
+}
@@ -0,0 +1,81 @@
+package domain
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// BackfillRepository defines the interface for backfill progress operations
+type BackfillRepository interface {
+	SaveBackfill(ctx context.Context, backfill Backfill) error
+	GetBackfill(ctx context.Context, id primitive.ObjectID) (*Backfill, error)
+	ListBackfills(ctx context.Context, limit int) ([]Backfill, error)
+}
+
+// backfillRepository implements BackfillRepository
+type backfillRepository struct {
+	collection *mongo.Collection
+}
+
+// NewBackfillRepository creates a new BackfillRepository
+func NewBackfillRepository(db *mongo.Database) BackfillRepository {
+	return &backfillRepository{
+		collection: db.Collection("backfills"),
+	}
+}
+
+// SaveBackfill stores the progress of a backfill, replacing what was stored
+// before.
+func (r *backfillRepository) SaveBackfill(ctx context.Context, backfill Backfill) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.ReplaceOne(ctx, bson.M{"_id": backfill.ID}, backfill, options.Replace().SetUpsert(true))
+	return err
+}
+
+// GetBackfill returns a backfill by ID, or nil if it does not exist.
+func (r *backfillRepository) GetBackfill(ctx context.Context, id primitive.ObjectID) (*Backfill, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var backfill Backfill
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&backfill)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &backfill, nil
+}
+
+// ListBackfills returns the most recent backfills, newest first.
+func (r *backfillRepository) ListBackfills(ctx context.Context, limit int) ([]Backfill, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if limit < 1 {
+		limit = 20
+	}
+
+	opts := options.Find().SetSort(bson.M{"started_at": -1}).SetLimit(int64(limit))
+	cursor, err := r.collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var backfills []Backfill
+	if err := cursor.All(ctx, &backfills); err != nil {
+		return nil, err
+	}
+
+	return backfills, nil
+}
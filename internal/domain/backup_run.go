@@ -0,0 +1,76 @@
+package domain
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Backup run states. The next run over the same window and customers picks up
+// the latest run that was not abandoned; a completed one is reopened unless it
+// already covered the whole window.
+const (
+	BackupRunRunning    = "running"
+	BackupRunCompleted  = "completed"
+	BackupRunIncomplete = "incomplete"
+	BackupRunCancelled  = "cancelled"
+	// BackupRunAbandoned is a run given up on after too many attempts or too
+	// long; the next run over its window starts afresh.
+	BackupRunAbandoned = "abandoned"
+)
+
+// Progress of a customer within a backup run.
+const (
+	BackupCustomerPending = "pending"
+	BackupCustomerListing = "listing"
+	BackupCustomerListed  = "listed"
+	BackupCustomerDone    = "done"
+	// BackupCustomerFailed is a customer that can't be backed up at all, such
+	// as one with no PortaOne instance. It doesn't hold the run open.
+	BackupCustomerFailed = "failed"
+)
+
+// Progress of an XDR within a backup run.
+const (
+	BackupXDRPending  = "pending"
+	BackupXDRArchived = "archived"
+	BackupXDRSkipped  = "skipped"
+	BackupXDRFailed   = "failed"
+	// BackupXDRQueued is a failed XDR handed over to the recording retry queue.
+	BackupXDRQueued = "queued"
+)
+
+// BackupRun is the checkpoint of one backup over a time window, stored in
+// the backup_runs collection.
+type BackupRun struct {
+	ID         primitive.ObjectID           `bson:"_id,omitempty" json:"id"`
+	StartTime  string                       `bson:"start_time" json:"start_time"`
+	EndTime    string                       `bson:"end_time" json:"end_time"`
+	Date       string                       `bson:"date" json:"date"`
+	Scope      string                       `bson:"scope" json:"scope"`
+	State      string                       `bson:"state" json:"state"`
+	Attempts   int                          `bson:"attempts" json:"attempts"`
+	Customers  map[string]BackupRunCustomer `bson:"customers" json:"customers"`
+	StartedAt  time.Time                    `bson:"started_at" json:"started_at"`
+	UpdatedAt  time.Time                    `bson:"updated_at" json:"updated_at"`
+	FinishedAt *time.Time                   `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+}
+
+// BackupRunCustomer is the progress of one customer in a backup run, keyed by
+// i_customer in BackupRun.Customers.
+type BackupRunCustomer struct {
+	Instance  string    `bson:"instance,omitempty" json:"instance,omitempty"`
+	State     string    `bson:"state" json:"state"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// BackupRunXDR is the progress of one recording in a backup run, stored in
+// the backup_run_xdrs collection.
+type BackupRunXDR struct {
+	RunID     primitive.ObjectID `bson:"run_id" json:"run_id"`
+	IXDR      int64              `bson:"i_xdr" json:"i_xdr"`
+	ICustomer int                `bson:"i_customer" json:"i_customer"`
+	State     string             `bson:"state" json:"state"`
+	Error     string             `bson:"error,omitempty" json:"error,omitempty"`
+	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+}
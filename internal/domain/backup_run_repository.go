@@ -0,0 +1,307 @@
+package domain
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// BackupRunRepository defines the interface for backup checkpoint operations
+type BackupRunRepository interface {
+	CreateBackupRun(ctx context.Context, run BackupRun) (primitive.ObjectID, error)
+	GetBackupRun(ctx context.Context, id primitive.ObjectID) (*BackupRun, error)
+	FindLatestBackupRun(ctx context.Context, startTime, endTime, scope string) (*BackupRun, error)
+	ListBackupRuns(ctx context.Context, limit int) ([]BackupRun, error)
+	SetBackupRunCustomerState(ctx context.Context, id primitive.ObjectID, iCustomer, state string) error
+	SetBackupRunState(ctx context.Context, id primitive.ObjectID, state string) error
+	ResumeBackupRun(ctx context.Context, id primitive.ObjectID, customers map[string]BackupRunCustomer) error
+	ReopenBackupRun(ctx context.Context, id primitive.ObjectID, customers map[string]BackupRunCustomer) error
+	TouchBackupRun(ctx context.Context, id primitive.ObjectID) error
+	AddBackupRunXDR(ctx context.Context, item BackupRunXDR) error
+	SetBackupRunXDRState(ctx context.Context, id primitive.ObjectID, iXDR int64, state, errMessage string) error
+	ListBackupRunXDRs(ctx context.Context, id primitive.ObjectID, iCustomer *int, states []string, limit int) ([]BackupRunXDR, error)
+	CountBackupRunXDRs(ctx context.Context, id primitive.ObjectID) (map[string]int, error)
+	DeleteBackupRunXDRs(ctx context.Context, id primitive.ObjectID, states []string) error
+}
+
+// backupRunRepository implements BackupRunRepository
+type backupRunRepository struct {
+	runs *mongo.Collection
+	xdrs *mongo.Collection
+}
+
+// NewBackupRunRepository creates a new BackupRunRepository
+func NewBackupRunRepository(db *mongo.Database) BackupRunRepository {
+	return &backupRunRepository{
+		runs: db.Collection("backup_runs"),
+		xdrs: db.Collection("backup_run_xdrs"),
+	}
+}
+
+// CreateBackupRun inserts a new run and returns its ID.
+func (r *backupRunRepository) CreateBackupRun(ctx context.Context, run BackupRun) (primitive.ObjectID, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	result, err := r.runs.InsertOne(ctx, run)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	id, ok := result.InsertedID.(primitive.ObjectID)
+	if !ok {
+		return primitive.NilObjectID, mongo.ErrNilDocument
+	}
+
+	return id, nil
+}
+
+// GetBackupRun returns a run by ID, or nil if it does not exist.
+func (r *backupRunRepository) GetBackupRun(ctx context.Context, id primitive.ObjectID) (*BackupRun, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var run BackupRun
+	err := r.runs.FindOne(ctx, bson.M{"_id": id}).Decode(&run)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &run, nil
+}
+
+// FindLatestBackupRun returns the latest run over the same window and
+// customers that was not abandoned, or nil if there is none.
+func (r *backupRunRepository) FindLatestBackupRun(ctx context.Context, startTime, endTime, scope string) (*BackupRun, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"start_time": startTime,
+		"end_time":   endTime,
+		"scope":      scope,
+		"state":      bson.M{"$ne": BackupRunAbandoned},
+	}
+
+	var run BackupRun
+	err := r.runs.FindOne(ctx, filter, options.FindOne().SetSort(bson.M{"started_at": -1})).Decode(&run)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &run, nil
+}
+
+// ListBackupRuns returns the most recent runs, newest first.
+func (r *backupRunRepository) ListBackupRuns(ctx context.Context, limit int) ([]BackupRun, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if limit < 1 {
+		limit = 20
+	}
+
+	opts := options.Find().SetSort(bson.M{"started_at": -1}).SetLimit(int64(limit))
+	cursor, err := r.runs.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var runs []BackupRun
+	if err := cursor.All(ctx, &runs); err != nil {
+		return nil, err
+	}
+
+	return runs, nil
+}
+
+// SetBackupRunCustomerState records the progress of one customer.
+func (r *backupRunRepository) SetBackupRunCustomerState(ctx context.Context, id primitive.ObjectID, iCustomer, state string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	update := bson.M{"$set": bson.M{
+		"customers." + iCustomer + ".state":      state,
+		"customers." + iCustomer + ".updated_at": now,
+		"updated_at":                             now,
+	}}
+
+	_, err := r.runs.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+// SetBackupRunState records how a run ended.
+func (r *backupRunRepository) SetBackupRunState(ctx context.Context, id primitive.ObjectID, state string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	update := bson.M{"$set": bson.M{
+		"state":       state,
+		"updated_at":  now,
+		"finished_at": now,
+	}}
+
+	_, err := r.runs.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+// ResumeBackupRun marks a run as running again and counts the attempt.
+// customers are added to the run, or replace the progress of those already in
+// it.
+func (r *backupRunRepository) ResumeBackupRun(ctx context.Context, id primitive.ObjectID, customers map[string]BackupRunCustomer) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	set := bson.M{"state": BackupRunRunning, "updated_at": time.Now()}
+	for iCustomer, customer := range customers {
+		set["customers."+iCustomer] = customer
+	}
+	update := bson.M{
+		"$set":   set,
+		"$inc":   bson.M{"attempts": 1},
+		"$unset": bson.M{"finished_at": ""},
+	}
+
+	_, err := r.runs.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+// ReopenBackupRun marks a completed run as running again for another pass
+// over its window. Its attempts start over.
+func (r *backupRunRepository) ReopenBackupRun(ctx context.Context, id primitive.ObjectID, customers map[string]BackupRunCustomer) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	set := bson.M{"state": BackupRunRunning, "attempts": 1, "updated_at": time.Now()}
+	for iCustomer, customer := range customers {
+		set["customers."+iCustomer] = customer
+	}
+	update := bson.M{
+		"$set":   set,
+		"$unset": bson.M{"finished_at": ""},
+	}
+
+	_, err := r.runs.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+// TouchBackupRun records that a run is still making progress.
+func (r *backupRunRepository) TouchBackupRun(ctx context.Context, id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := r.runs.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"updated_at": time.Now()}})
+	return err
+}
+
+// AddBackupRunXDR records an XDR as part of a run. An XDR already in the run
+// keeps its state.
+func (r *backupRunRepository) AddBackupRunXDR(ctx context.Context, item BackupRunXDR) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"run_id": item.RunID, "i_xdr": item.IXDR}
+	update := bson.M{"$setOnInsert": item}
+
+	_, err := r.xdrs.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	return err
+}
+
+// SetBackupRunXDRState records the progress of one XDR.
+func (r *backupRunRepository) SetBackupRunXDRState(ctx context.Context, id primitive.ObjectID, iXDR int64, state, errMessage string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{
+		"state":      state,
+		"error":      errMessage,
+		"updated_at": time.Now(),
+	}}
+
+	_, err := r.xdrs.UpdateOne(ctx, bson.M{"run_id": id, "i_xdr": iXDR}, update)
+	return err
+}
+
+// ListBackupRunXDRs returns the XDRs of a run, optionally limited to one
+// customer and to the given states, in i_xdr order.
+func (r *backupRunRepository) ListBackupRunXDRs(ctx context.Context, id primitive.ObjectID, iCustomer *int, states []string, limit int) ([]BackupRunXDR, error) {
+	filter := bson.M{"run_id": id}
+	if iCustomer != nil {
+		filter["i_customer"] = *iCustomer
+	}
+	if len(states) > 0 {
+		filter["state"] = bson.M{"$in": states}
+	}
+
+	opts := options.Find().SetProjection(bson.M{"_id": 0}).SetSort(bson.M{"i_xdr": 1})
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+
+	cursor, err := r.xdrs.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var items []BackupRunXDR
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// CountBackupRunXDRs returns how many XDRs of a run are in each state.
+func (r *backupRunRepository) CountBackupRunXDRs(ctx context.Context, id primitive.ObjectID) (map[string]int, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"run_id": id}}},
+		{{Key: "$group", Value: bson.M{"_id": "$state", "count": bson.M{"$sum": 1}}}},
+	}
+
+	cursor, err := r.xdrs.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var groups []struct {
+		State string `bson:"_id"`
+		Count int    `bson:"count"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int, len(groups))
+	for _, group := range groups {
+		counts[group.State] = group.Count
+	}
+
+	return counts, nil
+}
+
+// DeleteBackupRunXDRs removes the XDRs of a run in the given states.
+func (r *backupRunRepository) DeleteBackupRunXDRs(ctx context.Context, id primitive.ObjectID, states []string) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	_, err := r.xdrs.DeleteMany(ctx, bson.M{"run_id": id, "state": bson.M{"$in": states}})
+	return err
+}
@@ -0,0 +1,88 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Rafin000/call-recording-service-v2/internal/common"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// backupRunRetention is how long finished backup runs and the XDRs left in
+// them are kept before MongoDB expires them.
+const backupRunRetention = 30 * 24 * time.Hour
+
+// indexes are the indexes the repositories rely on, by collection. The unique
+// ones back the upserts keyed on i_xdr, which would otherwise insert
+// duplicates when two writers race. XDRs are keyed on their instance as well,
+// since i_xdr is only unique within one PortaOne instance.
+var indexes = []struct {
+	collection string
+	models     []mongo.IndexModel
+}{
+	{"xdr_list", []mongo.IndexModel{
+		{Keys: bson.D{{Key: "instance", Value: 1}, {Key: "i_xdr", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "i_customer", Value: 1}, {Key: "unix_connect_time", Value: 1}}},
+	}},
+	{"recording_retries", []mongo.IndexModel{
+		{Keys: bson.D{{Key: "i_xdr", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "state", Value: 1}, {Key: "next_attempt_at", Value: 1}}},
+	}},
+	{"backup_run_xdrs", []mongo.IndexModel{
+		{Keys: bson.D{{Key: "run_id", Value: 1}, {Key: "i_xdr", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "updated_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(int32(backupRunRetention.Seconds()))},
+	}},
+	{"backup_runs", []mongo.IndexModel{
+		{Keys: bson.D{{Key: "start_time", Value: 1}, {Key: "end_time", Value: 1}, {Key: "scope", Value: 1}, {Key: "started_at", Value: -1}}},
+		// Runs still going have no finished_at and are never expired
+		{Keys: bson.D{{Key: "finished_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(int32(backupRunRetention.Seconds()))},
+	}},
+}
+
+// EnsureIndexes creates the indexes the repositories rely on, after moving
+// xdr_list over to per-instance keys. Indexes that already exist are left
+// alone. It goes on past a collection that fails, for
+// instance because it holds duplicates a unique index rejects, and returns the
+// first error.
+func EnsureIndexes(ctx context.Context, db *mongo.Database) error {
+	firstErr := migrateXDRInstance(ctx, db.Collection("xdr_list"))
+	for _, index := range indexes {
+		ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		_, err := db.Collection(index.collection).Indexes().CreateMany(ctx, index.models)
+		cancel()
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to create indexes on %s: %w", index.collection, err)
+		}
+	}
+	return firstErr
+}
+
+// migrateXDRInstance moves xdr_list over to keying XDRs on their instance.
+// XDRs saved before the instance was recorded came from the default
+// instance, and the unique index on i_xdr alone is dropped so that another
+// instance's XDR with the same i_xdr can be saved.
+func migrateXDRInstance(ctx context.Context, collection *mongo.Collection) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	_, err := collection.UpdateMany(ctx,
+		bson.M{"instance": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"instance": common.PortaOneDefaultInstance}})
+	if err != nil {
+		return fmt.Errorf("failed to assign XDRs to the default instance: %w", err)
+	}
+
+	var cmdErr mongo.CommandError
+	if _, err := collection.Indexes().DropOne(ctx, "i_xdr_1"); err != nil && !(errors.As(err, &cmdErr) && cmdErr.Code == indexNotFoundCode) {
+		return fmt.Errorf("failed to drop the i_xdr index of xdr_list: %w", err)
+	}
+	return nil
+}
+
+// indexNotFoundCode is the MongoDB error code for dropping an index that
+// doesn't exist.
+const indexNotFoundCode = 27
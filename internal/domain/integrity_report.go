@@ -0,0 +1,36 @@
+package domain
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Integrity states of an archived recording, as last seen by the verifier.
+const (
+	IntegrityOK               = "ok"
+	IntegrityMissing          = "missing"
+	IntegritySizeMismatch     = "size_mismatch"
+	IntegrityChecksumMismatch = "checksum_mismatch"
+)
+
+// IntegrityReport summarises one verification run over archived recordings.
+type IntegrityReport struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	StartedAt  time.Time          `bson:"started_at" json:"started_at"`
+	FinishedAt time.Time          `bson:"finished_at" json:"finished_at"`
+	Checked    int                `bson:"checked" json:"checked"`
+	OK         int                `bson:"ok" json:"ok"`
+	Errors     int                `bson:"errors" json:"errors"`
+	Issues     []IntegrityIssue   `bson:"issues" json:"issues"`
+}
+
+// IntegrityIssue is an archived recording that failed verification.
+type IntegrityIssue struct {
+	IXDR      int64  `bson:"i_xdr" json:"i_xdr"`
+	ICustomer int    `bson:"i_customer" json:"i_customer"`
+	S3Key     string `bson:"s3_key" json:"s3_key"`
+	Problem   string `bson:"problem" json:"problem"`
+	Expected  string `bson:"expected,omitempty" json:"expected,omitempty"`
+	Actual    string `bson:"actual,omitempty" json:"actual,omitempty"`
+}
@@ -0,0 +1,61 @@
+package domain
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// IntegrityReportRepository defines the interface for integrity report operations
+type IntegrityReportRepository interface {
+	CreateIntegrityReport(ctx context.Context, report IntegrityReport) error
+	ListIntegrityReports(ctx context.Context, limit int) ([]IntegrityReport, error)
+}
+
+// integrityReportRepository implements IntegrityReportRepository
+type integrityReportRepository struct {
+	collection *mongo.Collection
+}
+
+// NewIntegrityReportRepository creates a new IntegrityReportRepository
+func NewIntegrityReportRepository(db *mongo.Database) IntegrityReportRepository {
+	return &integrityReportRepository{
+		collection: db.Collection("integrity_reports"),
+	}
+}
+
+// CreateIntegrityReport stores the report of a finished verification run.
+func (r *integrityReportRepository) CreateIntegrityReport(ctx context.Context, report IntegrityReport) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.InsertOne(ctx, report)
+	return err
+}
+
+// ListIntegrityReports returns the most recent reports, newest first.
+func (r *integrityReportRepository) ListIntegrityReports(ctx context.Context, limit int) ([]IntegrityReport, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if limit < 1 {
+		limit = 10
+	}
+
+	opts := options.Find().SetSort(bson.M{"started_at": -1}).SetLimit(int64(limit))
+	cursor, err := r.collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var reports []IntegrityReport
+	if err := cursor.All(ctx, &reports); err != nil {
+		return nil, err
+	}
+
+	return reports, nil
+}
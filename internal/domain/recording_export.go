@@ -0,0 +1,37 @@
+package domain
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Recording export states.
+const (
+	RecordingExportRunning = "running"
+	RecordingExportReady   = "ready"
+	RecordingExportFailed  = "failed"
+)
+
+// RecordingExport is a ZIP of a customer's recordings built in the background,
+// stored in the recording_exports collection. Once ready the ZIP is kept in the
+// recording store under Key until ExpiresAt.
+type RecordingExport struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ICustomer  int                `bson:"i_customer" json:"i_customer"`
+	FromDate   time.Time          `bson:"from_date" json:"from_date"`
+	ToDate     time.Time          `bson:"to_date" json:"to_date"`
+	State      string             `bson:"state" json:"state"`
+	XDRs       int64              `bson:"xdrs" json:"xdrs"`
+	Recordings int64              `bson:"recordings" json:"recordings"`
+	// RecordingBytes is the size of the recordings going in; Size that of the
+	// finished ZIP.
+	RecordingBytes int64      `bson:"recording_bytes" json:"recording_bytes"`
+	Size           int64      `bson:"size,omitempty" json:"size,omitempty"`
+	Key            string     `bson:"key" json:"-"`
+	Error          string     `bson:"error,omitempty" json:"error,omitempty"`
+	CreatedBy      string     `bson:"created_by,omitempty" json:"-"`
+	CreatedAt      time.Time  `bson:"created_at" json:"created_at"`
+	FinishedAt     *time.Time `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+	ExpiresAt      time.Time  `bson:"expires_at" json:"expires_at"`
+}
@@ -0,0 +1,143 @@
+package domain
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RecordingExportRepository defines the interface for recording export operations
+type RecordingExportRepository interface {
+	CreateRecordingExport(ctx context.Context, export RecordingExport) (primitive.ObjectID, error)
+	GetRecordingExport(ctx context.Context, id primitive.ObjectID) (*RecordingExport, error)
+	FindRunningRecordingExport(ctx context.Context, iCustomer int, from, to, createdAfter time.Time) (*RecordingExport, error)
+	FinishRecordingExport(ctx context.Context, id primitive.ObjectID, state string, size int64, errMessage string, expiresAt time.Time) error
+	ListExpiredRecordingExports(ctx context.Context, now time.Time, limit int) ([]RecordingExport, error)
+	DeleteRecordingExport(ctx context.Context, id primitive.ObjectID) error
+}
+
+// recordingExportRepository implements RecordingExportRepository
+type recordingExportRepository struct {
+	collection *mongo.Collection
+}
+
+// NewRecordingExportRepository creates a new RecordingExportRepository
+func NewRecordingExportRepository(db *mongo.Database) RecordingExportRepository {
+	return &recordingExportRepository{
+		collection: db.Collection("recording_exports"),
+	}
+}
+
+// CreateRecordingExport inserts a new export and returns its ID.
+func (r *recordingExportRepository) CreateRecordingExport(ctx context.Context, export RecordingExport) (primitive.ObjectID, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	result, err := r.collection.InsertOne(ctx, export)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	id, ok := result.InsertedID.(primitive.ObjectID)
+	if !ok {
+		return primitive.NilObjectID, mongo.ErrNilDocument
+	}
+
+	return id, nil
+}
+
+// GetRecordingExport returns an export by ID, or nil if it does not exist.
+func (r *recordingExportRepository) GetRecordingExport(ctx context.Context, id primitive.ObjectID) (*RecordingExport, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var export RecordingExport
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&export)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &export, nil
+}
+
+// FindRunningRecordingExport returns the newest export of a customer's calls
+// between from and to that is still running and was created after
+// createdAfter, or nil if there is none.
+func (r *recordingExportRepository) FindRunningRecordingExport(ctx context.Context, iCustomer int, from, to, createdAfter time.Time) (*RecordingExport, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"i_customer": iCustomer,
+		"from_date":  from,
+		"to_date":    to,
+		"state":      RecordingExportRunning,
+		"created_at": bson.M{"$gt": createdAfter},
+	}
+	opts := options.FindOne().SetSort(bson.M{"created_at": -1})
+
+	var export RecordingExport
+	err := r.collection.FindOne(ctx, filter, opts).Decode(&export)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &export, nil
+}
+
+// FinishRecordingExport records how an export ended and until when it is kept.
+func (r *recordingExportRepository) FinishRecordingExport(ctx context.Context, id primitive.ObjectID, state string, size int64, errMessage string, expiresAt time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{
+		"state":       state,
+		"size":        size,
+		"error":       errMessage,
+		"finished_at": time.Now(),
+		"expires_at":  expiresAt,
+	}}
+
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+// ListExpiredRecordingExports returns exports whose ZIP is past its expiry,
+// oldest first.
+func (r *recordingExportRepository) ListExpiredRecordingExports(ctx context.Context, now time.Time, limit int) ([]RecordingExport, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"expires_at": 1}).SetLimit(int64(limit))
+	cursor, err := r.collection.Find(ctx, bson.M{"expires_at": bson.M{"$lte": now}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var exports []RecordingExport
+	if err := cursor.All(ctx, &exports); err != nil {
+		return nil, err
+	}
+
+	return exports, nil
+}
+
+// DeleteRecordingExport removes an export.
+func (r *recordingExportRepository) DeleteRecordingExport(ctx context.Context, id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
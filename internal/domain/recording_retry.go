@@ -0,0 +1,25 @@
+package domain
+
+import "time"
+
+// States of a recording in the retry queue.
+const (
+	RecordingRetryPending = "pending"
+	RecordingRetryDead    = "dead"
+)
+
+// RecordingRetry is a recording whose archiving failed, kept in the
+// recording_retries collection until a retry succeeds and removes it, or it
+// runs out of attempts and is marked dead.
+type RecordingRetry struct {
+	IXDR          int64     `bson:"i_xdr" json:"i_xdr"`
+	ICustomer     int       `bson:"i_customer" json:"i_customer"`
+	Instance      string    `bson:"instance,omitempty" json:"instance,omitempty"`
+	Date          string    `bson:"date" json:"date"`
+	State         string    `bson:"state" json:"state"`
+	Attempts      int       `bson:"attempts" json:"attempts"`
+	LastError     string    `bson:"last_error,omitempty" json:"last_error,omitempty"`
+	NextAttemptAt time.Time `bson:"next_attempt_at" json:"next_attempt_at"`
+	CreatedAt     time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt     time.Time `bson:"updated_at" json:"updated_at"`
+}
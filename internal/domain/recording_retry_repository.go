@@ -0,0 +1,198 @@
+package domain
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RecordingRetryRepository defines the interface for the recording retry queue
+type RecordingRetryRepository interface {
+	EnqueueRecordingRetry(ctx context.Context, retry RecordingRetry) error
+	GetRecordingRetry(ctx context.Context, iXDR int64) (*RecordingRetry, error)
+	ListDueRecordingRetries(ctx context.Context, now time.Time, limit int) ([]RecordingRetry, error)
+	ListRecordingRetries(ctx context.Context, state string, page, pageSize int) ([]RecordingRetry, int64, error)
+	RecordRetryAttempt(ctx context.Context, iXDR int64, state string, attempts int, nextAttemptAt time.Time, lastError string) error
+	RequeueRecordingRetry(ctx context.Context, iXDR int64) (bool, error)
+	DeleteRecordingRetry(ctx context.Context, iXDR int64) error
+}
+
+// recordingRetryRepository implements RecordingRetryRepository
+type recordingRetryRepository struct {
+	collection *mongo.Collection
+}
+
+// NewRecordingRetryRepository creates a new RecordingRetryRepository
+func NewRecordingRetryRepository(db *mongo.Database) RecordingRetryRepository {
+	return &recordingRetryRepository{
+		collection: db.Collection("recording_retries"),
+	}
+}
+
+// EnqueueRecordingRetry adds a failed recording to the queue, keyed by i_xdr.
+// A recording already queued keeps its attempt count and schedule and only has
+// its last error updated.
+func (r *recordingRetryRepository) EnqueueRecordingRetry(ctx context.Context, retry RecordingRetry) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"i_xdr": retry.IXDR}
+	update := bson.M{
+		"$set": bson.M{
+			"last_error": retry.LastError,
+			"updated_at": retry.UpdatedAt,
+		},
+		"$setOnInsert": bson.M{
+			"i_customer":      retry.ICustomer,
+			"instance":        retry.Instance,
+			"date":            retry.Date,
+			"state":           retry.State,
+			"attempts":        retry.Attempts,
+			"next_attempt_at": retry.NextAttemptAt,
+			"created_at":      retry.CreatedAt,
+		},
+	}
+
+	_, err := r.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	return err
+}
+
+// GetRecordingRetry returns the queue entry of an XDR, or nil if it has none.
+func (r *recordingRetryRepository) GetRecordingRetry(ctx context.Context, iXDR int64) (*RecordingRetry, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var retry RecordingRetry
+	err := r.collection.FindOne(ctx, bson.M{"i_xdr": iXDR}).Decode(&retry)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &retry, nil
+}
+
+// ListDueRecordingRetries returns pending retries whose next attempt is due,
+// the longest overdue first.
+func (r *recordingRetryRepository) ListDueRecordingRetries(ctx context.Context, now time.Time, limit int) ([]RecordingRetry, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"state":           RecordingRetryPending,
+		"next_attempt_at": bson.M{"$lte": now},
+	}
+	opts := options.Find().
+		SetProjection(bson.M{"_id": 0}).
+		SetSort(bson.M{"next_attempt_at": 1}).
+		SetLimit(int64(limit))
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var retries []RecordingRetry
+	if err := cursor.All(ctx, &retries); err != nil {
+		return nil, err
+	}
+
+	return retries, nil
+}
+
+// ListRecordingRetries returns a page of the queue, optionally in one state,
+// most recently updated first, along with the total count.
+func (r *recordingRetryRepository) ListRecordingRetries(ctx context.Context, state string, page, pageSize int) ([]RecordingRetry, int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 50
+	}
+
+	filter := bson.M{}
+	if state != "" {
+		filter["state"] = state
+	}
+
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetProjection(bson.M{"_id": 0}).
+		SetSort(bson.M{"updated_at": -1}).
+		SetSkip(int64((page - 1) * pageSize)).
+		SetLimit(int64(pageSize))
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var retries []RecordingRetry
+	if err := cursor.All(ctx, &retries); err != nil {
+		return nil, 0, err
+	}
+
+	return retries, total, nil
+}
+
+// RecordRetryAttempt stores the outcome of a retry.
+func (r *recordingRetryRepository) RecordRetryAttempt(ctx context.Context, iXDR int64, state string, attempts int, nextAttemptAt time.Time, lastError string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{
+		"state":           state,
+		"attempts":        attempts,
+		"next_attempt_at": nextAttemptAt,
+		"last_error":      lastError,
+		"updated_at":      time.Now(),
+	}}
+
+	_, err := r.collection.UpdateOne(ctx, bson.M{"i_xdr": iXDR}, update)
+	return err
+}
+
+// RequeueRecordingRetry puts a recording back in the queue with a fresh set of
+// attempts, due immediately. It returns false if the XDR is not in the queue.
+func (r *recordingRetryRepository) RequeueRecordingRetry(ctx context.Context, iXDR int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	update := bson.M{"$set": bson.M{
+		"state":           RecordingRetryPending,
+		"attempts":        0,
+		"next_attempt_at": now,
+		"updated_at":      now,
+	}}
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{"i_xdr": iXDR}, update)
+	if err != nil {
+		return false, err
+	}
+
+	return result.MatchedCount > 0, nil
+}
+
+// DeleteRecordingRetry removes a recording from the queue.
+func (r *recordingRetryRepository) DeleteRecordingRetry(ctx context.Context, iXDR int64) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := r.collection.DeleteOne(ctx, bson.M{"i_xdr": iXDR})
+	return err
+}
@@ -43,23 +43,25 @@ import (
 // }
 
 type User struct {
-	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	Name      string             `bson:"name" json:"name"`
-	Email     string             `bson:"email" json:"email"`
-	Password  string             `bson:"password" json:"password"`
-	Role      string             `bson:"role" json:"role"`
-	ICustomer *string            `bson:"i_customer,omitempty" json:"i_customer,omitempty"`
-	IsActive  bool               `bson:"is_active" json:"is_active"`
-	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
-	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+	ID               primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name             string             `bson:"name" json:"name"`
+	Email            string             `bson:"email" json:"email"`
+	Password         string             `bson:"password" json:"password"`
+	Role             string             `bson:"role" json:"role"`
+	ICustomer        *string            `bson:"i_customer,omitempty" json:"i_customer,omitempty"`
+	PortaOneInstance string             `bson:"portaone_instance,omitempty" json:"portaone_instance,omitempty"`
+	IsActive         bool               `bson:"is_active" json:"is_active"`
+	CreatedAt        time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt        time.Time          `bson:"updated_at" json:"updated_at"`
 }
 
 type UpdateUser struct {
-	Name      string  `json:"name" bson:"name" binding:"required"`
-	Email     string  `json:"email" bson:"email" binding:"required,email"`
-	Role      *string `json:"role,omitempty" bson:"role,omitempty"`
-	ICustomer *string `json:"i_customer,omitempty" bson:"i_customer,omitempty"`
-	IsActive  *bool   `json:"is_active,omitempty" bson:"is_active,omitempty"`
+	Name             string  `json:"name" bson:"name" binding:"required"`
+	Email            string  `json:"email" bson:"email" binding:"required,email"`
+	Role             *string `json:"role,omitempty" bson:"role,omitempty"`
+	ICustomer        *string `json:"i_customer,omitempty" bson:"i_customer,omitempty"`
+	IsActive         *bool   `json:"is_active,omitempty" bson:"is_active,omitempty"`
+	PortaOneInstance *string `json:"portaone_instance,omitempty" bson:"portaone_instance,omitempty"`
 }
 
 type ChangePassword struct {
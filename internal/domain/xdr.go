@@ -1,5 +1,7 @@
 package domain
 
+import "time"
+
 // Params struct to represent the parameters including `i_customer`
 // type Params struct {
 // 	ICustomer string `json:"i_customer"`
@@ -18,3 +20,72 @@ type XDRDumpsRequest struct {
 	ToDate    string `json:"to_date" binding:"required"`
 	ICustomer string `json:"i_customer" binding:"required"`
 }
+
+// XDR is a call detail record as stored in the xdr_list collection.
+// Field names follow PortaOne's get_customer_xdrs reply. i_xdr is only unique
+// within the PortaOne instance the XDR was fetched from.
+type XDR struct {
+	Instance           string      `bson:"instance" json:"instance"`
+	IXDR               int64       `bson:"i_xdr" json:"i_xdr"`
+	ICustomer          int         `bson:"i_customer" json:"i_customer"`
+	IAccount           int64       `bson:"i_account" json:"i_account"`
+	AccountID          string      `bson:"account_id" json:"account_id"`
+	CLI                string      `bson:"CLI" json:"CLI"`
+	CLD                string      `bson:"CLD" json:"CLD"`
+	ConnectTime        string      `bson:"connect_time" json:"connect_time"`
+	DisconnectTime     string      `bson:"disconnect_time" json:"disconnect_time"`
+	UnixConnectTime    int64       `bson:"unix_connect_time" json:"unix_connect_time"`
+	UnixDisconnectTime int64       `bson:"unix_disconnect_time" json:"unix_disconnect_time"`
+	ChargedAmount      float64     `bson:"charged_amount" json:"charged_amount"`
+	ChargedQuantity    int64       `bson:"charged_quantity" json:"charged_quantity"`
+	IService           int         `bson:"i_service" json:"i_service"`
+	IDest              int64       `bson:"i_dest" json:"i_dest"`
+	Country            string      `bson:"country" json:"country"`
+	Subdivision        string      `bson:"subdivision" json:"subdivision"`
+	Description        string      `bson:"description" json:"description"`
+	BillStatus         string      `bson:"bill_status" json:"bill_status"`
+	H323ConfID         string      `bson:"h323_conf_id" json:"h323_conf_id"`
+	Archive            *XDRArchive `bson:"archive,omitempty" json:"archive,omitempty"`
+	UpdatedAt          time.Time   `bson:"updated_at" json:"updated_at"`
+}
+
+// XDRArchive describes the archived copy of an XDR's recording.
+type XDRArchive struct {
+	S3Key      string     `bson:"s3_key" json:"s3_key"`
+	Size       int64      `bson:"size" json:"size"`
+	SHA256     string     `bson:"sha256" json:"sha256"`
+	UploadedAt time.Time  `bson:"uploaded_at" json:"uploaded_at"`
+	VerifiedAt *time.Time `bson:"verified_at,omitempty" json:"verified_at,omitempty"`
+	Integrity  string     `bson:"integrity,omitempty" json:"integrity,omitempty"`
+	// Audio is unset for recordings archived before it was recorded, or that
+	// aren't WAV files.
+	Audio *RecordingAudio `bson:"audio,omitempty" json:"audio,omitempty"`
+}
+
+// What the duration of a recording can disagree with.
+const (
+	AudioMismatchCallDuration    = "call_duration"
+	AudioMismatchChargedQuantity = "charged_quantity"
+)
+
+// RecordingAudio describes the audio of an archived recording, as read from
+// its WAV header.
+type RecordingAudio struct {
+	Codec         string `bson:"codec" json:"codec"`
+	SampleRate    int    `bson:"sample_rate" json:"sample_rate"`
+	Channels      int    `bson:"channels" json:"channels"`
+	BitsPerSample int    `bson:"bits_per_sample" json:"bits_per_sample"`
+	// Duration is in seconds.
+	Duration float64 `bson:"duration" json:"duration"`
+	// DataSize is the size of the samples, without the header.
+	DataSize int64 `bson:"data_size" json:"data_size"`
+	// DurationMismatch lists what the duration disagrees with, if anything.
+	DurationMismatch []string `bson:"duration_mismatch,omitempty" json:"duration_mismatch,omitempty"`
+}
+
+// XDRSummary counts the XDRs matching a filter and their archived recordings.
+type XDRSummary struct {
+	XDRs           int64 `bson:"xdrs" json:"xdrs"`
+	Recordings     int64 `bson:"recordings" json:"recordings"`
+	RecordingBytes int64 `bson:"recording_bytes" json:"recording_bytes"`
+}
@@ -16,9 +16,17 @@ import (
 // XDRRepository defines the interface for XDR operations
 type XDRRepository interface {
 	GetXDRList(ctx context.Context, iCustomer int, fromDateUnix, toDateUnix int64, page, pageSize int) (map[string]interface{}, error)
-	GetXDRByIXDR(ctx context.Context, iXDR int) (bson.M, error)
+	GetXDRByIXDR(ctx context.Context, instance string, iXDR int) (bson.M, error)
 	PostXDRList(ctx context.Context, data bson.M) (primitive.ObjectID, error)
 	AcknowledgeXDRList(ctx context.Context, id primitive.ObjectID, s3Path string) error
+	UpsertXDR(ctx context.Context, xdr XDR) error
+	MarkXDRArchived(ctx context.Context, instance string, iXDR int64, archive XDRArchive) error
+	GetXDRArchive(ctx context.Context, instance string, iXDR int64) (*XDRArchive, error)
+	GetXDR(ctx context.Context, instance string, iXDR int64) (*XDR, error)
+	SummarizeXDRs(ctx context.Context, iCustomer int, fromDateUnix, toDateUnix int64) (*XDRSummary, error)
+	ListXDRs(ctx context.Context, iCustomer int, fromDateUnix, toDateUnix int64, limit int) ([]XDR, error)
+	ListXDRsToVerify(ctx context.Context, verifiedBefore time.Time, limit int) ([]XDR, error)
+	SetXDRIntegrity(ctx context.Context, instance string, iXDR int64, integrity string, verifiedAt time.Time) error
 }
 
 // xdrRepository implements XDRRepository
@@ -91,9 +99,9 @@ func (repo *xdrRepository) GetXDRList(ctx context.Context, iCustomer int, fromDa
 	return result, nil
 }
 
-// GetXDRByIXDR retrieves an XDR by its i_xdr value.
-func (repo *xdrRepository) GetXDRByIXDR(ctx context.Context, iXDR int) (bson.M, error) {
-	query := bson.M{"i_xdr": iXDR}
+// GetXDRByIXDR retrieves an XDR of an instance by its i_xdr value.
+func (repo *xdrRepository) GetXDRByIXDR(ctx context.Context, instance string, iXDR int) (bson.M, error) {
+	query := bson.M{"instance": instance, "i_xdr": iXDR}
 	var result bson.M
 
 	err := repo.collection.FindOne(ctx, query, options.FindOne().SetProjection(bson.M{"_id": 0})).Decode(&result)
@@ -144,3 +152,198 @@ func (r *xdrRepository) PostXDRList(ctx context.Context, data bson.M) (primitive
 
 	return id, nil
 }
+
+// UpsertXDR inserts or refreshes an XDR keyed by instance and i_xdr. An
+// existing archive entry is left untouched.
+func (r *xdrRepository) UpsertXDR(ctx context.Context, xdr XDR) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	xdr.Archive = nil
+	xdr.UpdatedAt = time.Now()
+
+	filter := bson.M{"instance": xdr.Instance, "i_xdr": xdr.IXDR}
+	update := bson.M{
+		"$set":         xdr,
+		"$setOnInsert": bson.M{"created_at": xdr.UpdatedAt},
+	}
+
+	_, err := r.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		slog.Error("Failed to upsert XDR record", "instance", xdr.Instance, "i_xdr", xdr.IXDR, "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// MarkXDRArchived records where the recording of an XDR was archived.
+// s3_path is kept alongside for readers of the older schema.
+func (r *xdrRepository) MarkXDRArchived(ctx context.Context, instance string, iXDR int64, archive XDRArchive) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"instance": instance, "i_xdr": iXDR}
+	update := bson.M{"$set": bson.M{
+		"archive":    archive,
+		"s3_path":    archive.S3Key,
+		"updated_at": time.Now(),
+	}}
+
+	_, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		slog.Error("Failed to mark XDR as archived", "instance", instance, "i_xdr", iXDR, "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetXDRArchive returns the archive entry of an XDR, or nil if its recording
+// has not been archived (or the XDR is unknown).
+func (r *xdrRepository) GetXDRArchive(ctx context.Context, instance string, iXDR int64) (*XDRArchive, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var result struct {
+		Archive *XDRArchive `bson:"archive"`
+	}
+
+	opts := options.FindOne().SetProjection(bson.M{"_id": 0, "archive": 1})
+	err := r.collection.FindOne(ctx, bson.M{"instance": instance, "i_xdr": iXDR}, opts).Decode(&result)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return result.Archive, nil
+}
+
+// GetXDR returns an XDR from xdr_list, or nil if it has not been backed up.
+func (r *xdrRepository) GetXDR(ctx context.Context, instance string, iXDR int64) (*XDR, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var xdr XDR
+	err := r.collection.FindOne(ctx, bson.M{"instance": instance, "i_xdr": iXDR}).Decode(&xdr)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &xdr, nil
+}
+
+// SummarizeXDRs counts a customer's XDRs connected in a time range, and the
+// archived recordings among them.
+func (r *xdrRepository) SummarizeXDRs(ctx context.Context, iCustomer int, fromDateUnix, toDateUnix int64) (*XDRSummary, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"i_customer":        iCustomer,
+			"unix_connect_time": bson.M{"$gte": fromDateUnix, "$lte": toDateUnix},
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":             nil,
+			"xdrs":            bson.M{"$sum": 1},
+			"recordings":      bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$ifNull": bson.A{"$archive", false}}, 1, 0}}},
+			"recording_bytes": bson.M{"$sum": bson.M{"$ifNull": bson.A{"$archive.size", 0}}},
+		}}},
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var summary XDRSummary
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&summary); err != nil {
+			return nil, err
+		}
+	}
+	return &summary, cursor.Err()
+}
+
+// ListXDRs returns up to limit of a customer's XDRs connected in a time range,
+// oldest first.
+func (r *xdrRepository) ListXDRs(ctx context.Context, iCustomer int, fromDateUnix, toDateUnix int64, limit int) ([]XDR, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"i_customer":        iCustomer,
+		"unix_connect_time": bson.M{"$gte": fromDateUnix, "$lte": toDateUnix},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "unix_connect_time", Value: 1}, {Key: "i_xdr", Value: 1}}).SetLimit(int64(limit))
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var xdrs []XDR
+	if err := cursor.All(ctx, &xdrs); err != nil {
+		return nil, err
+	}
+
+	return xdrs, nil
+}
+
+// ListXDRsToVerify returns archived XDRs that were never verified or were last
+// verified before verifiedBefore, least recently verified first.
+func (r *xdrRepository) ListXDRsToVerify(ctx context.Context, verifiedBefore time.Time, limit int) ([]XDR, error) {
+	filter := bson.M{
+		"archive": bson.M{"$exists": true},
+		"$or": bson.A{
+			bson.M{"archive.verified_at": bson.M{"$exists": false}},
+			bson.M{"archive.verified_at": bson.M{"$lt": verifiedBefore}},
+		},
+	}
+
+	opts := options.Find().
+		SetProjection(bson.M{"_id": 0}).
+		SetSort(bson.D{{Key: "archive.verified_at", Value: 1}, {Key: "i_xdr", Value: 1}}).
+		SetLimit(int64(limit))
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var xdrs []XDR
+	if err := cursor.All(ctx, &xdrs); err != nil {
+		return nil, err
+	}
+
+	return xdrs, nil
+}
+
+// SetXDRIntegrity records the outcome of verifying an archived recording.
+func (r *xdrRepository) SetXDRIntegrity(ctx context.Context, instance string, iXDR int64, integrity string, verifiedAt time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"instance": instance, "i_xdr": iXDR, "archive": bson.M{"$exists": true}}
+	update := bson.M{"$set": bson.M{
+		"archive.integrity":   integrity,
+		"archive.verified_at": verifiedAt,
+	}}
+
+	_, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		slog.Error("Failed to record XDR integrity", "instance", instance, "i_xdr", iXDR, "error", err)
+		return err
+	}
+
+	return nil
+}
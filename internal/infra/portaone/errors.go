@@ -0,0 +1,57 @@
+package portaone
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Rafin000/call-recording-service-v2/internal/infra/resilience"
+)
+
+// transportError wraps a failure to get any reply from PortaOne.
+type transportError struct {
+	method string
+	err    error
+}
+
+func (e *transportError) Error() string {
+	return fmt.Sprintf("PortaOne %s request failed: %v", e.method, e.err)
+}
+
+func (e *transportError) Unwrap() error {
+	return e.err
+}
+
+// IsUnavailable reports whether err means PortaOne could not be reached,
+// either because the circuit breaker is open or retries were exhausted.
+// Callers should answer 503 or postpone work rather than treat it as a bad request.
+func IsUnavailable(err error) bool {
+	return errors.Is(err, resilience.ErrCircuitOpen) || isTransient(context.Background(), err)
+}
+
+// isTransient reports whether err is worth retrying: transport failures and
+// gateway statuses. PortaOne faults (HTTP 500 with a faultcode) are not.
+// Errors caused by the caller cancelling ctx are never transient.
+func isTransient(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.FaultCode == "" && isTransientStatus(apiErr.StatusCode)
+	}
+
+	// Connection refused, reset, timeout...
+	var transportErr *transportError
+	return errors.As(err, &transportErr)
+}
+
+func isTransientStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,8 @@
+package portaone
+
+import "github.com/Rafin000/call-recording-service-v2/internal/infra/redis"
+
+// NewMemRedis gives the external tests an in-memory RedisClient.
+func NewMemRedis() redis.RedisClient {
+	return newMemRedis()
+}
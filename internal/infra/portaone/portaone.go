@@ -2,123 +2,541 @@ package portaone
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/Rafin000/call-recording-service-v2/internal/common"
 	"github.com/Rafin000/call-recording-service-v2/internal/infra/redis"
+	"github.com/Rafin000/call-recording-service-v2/internal/infra/resilience"
 
 	"github.com/go-resty/resty/v2"
+	"golang.org/x/sync/singleflight"
 )
 
 const (
 	portaOneSessionKey = "portaone_session_id"
 	sessionTimeout     = 25 * time.Minute
+
+	restPath        = "/rest"
+	defaultTimeout  = 30 * time.Second
+	defaultPageSize = 500
+	dateTimeLayout  = "2006-01-02 15:04:05"
+
+	// A replica holds the login lock while it logs in, refreshing it every
+	// third of its TTL; others poll for the new session
+	loginLockTTL      = 15 * time.Second
+	loginWaitTimeout  = 30 * time.Second
+	loginPollInterval = 100 * time.Millisecond
+
+	methodLogin            = "Session/login"
+	methodGetCustomerXDRs  = "Customer/get_customer_xdrs"
+	methodGetCallRecording = "CDR/get_call_recording"
+	methodGetCustomerInfo  = "Customer/get_customer_info"
+	methodGetAccountList   = "Account/get_account_list"
 )
 
 type PortaOneClient interface {
+	// Name returns the name of the instance the client talks to.
+	Name() string
 	GetSessionID(ctx context.Context) (string, error)
+	GetCustomerXDRs(ctx context.Context, req GetCustomerXDRsRequest) (*GetCustomerXDRsResponse, error)
+	ForEachCustomerXDR(ctx context.Context, req GetCustomerXDRsRequest, fn func(XDR) error) error
+	ForEachCustomerXDRPage(ctx context.Context, req GetCustomerXDRsRequest, fn func([]XDR) error) error
+	GetCustomerXDR(ctx context.Context, iCustomer int, iXDR int64, day time.Time) (*XDR, error)
+	GetCallRecording(ctx context.Context, req GetCallRecordingRequest) (*CallRecording, error)
+	GetCustomerInfo(ctx context.Context, req GetCustomerInfoRequest) (*CustomerInfo, error)
+	GetAccountList(ctx context.Context, req GetAccountListRequest) (*GetAccountListResponse, error)
 }
 
 // portaOneClient handles PortaOne API interactions
 type portaOneClient struct {
-	config     common.PortaOneConfig
+	name       string
+	sessionKey string
+	config     common.PortaOneInstanceConfig
 	redis      redis.RedisClient
 	httpClient *resty.Client
+	pageSize   int
+	retrier    *resilience.Retrier
+	breaker    *resilience.CircuitBreaker
+	loginGroup singleflight.Group
 }
 
-// // NewPortaOneClient creates a new PortaOne client
-// func NewPortaOneClient(config common.PortaOneConfig, redisClient redis.RedisClient) PortaOneClient {
-// 	return &portaOneClient{
-// 		config:     config,
-// 		redis:      redisClient,
-// 		httpClient: resty.New(),
-// 	}
-// }
-
-// NewPortaOneClient creates a new PortaOne client
-func NewPortaOneClient(config common.PortaOneConfig, redisClient redis.RedisClient) (PortaOneClient, error) {
+// NewPortaOneClient creates a new PortaOne client for the named instance
+func NewPortaOneClient(name string, config common.PortaOneInstanceConfig, redisClient redis.RedisClient) (PortaOneClient, error) {
 	// Check if the Redis client is valid
 	if redisClient == nil {
 		slog.Error("Invalid Redis client", "error", "client is nil")
 		return nil, fmt.Errorf("invalid Redis client: client is nil")
 	}
 
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	httpClient := resty.New().
+		SetBaseURL(strings.TrimRight(config.BaseURL, "/") + restPath).
+		SetTimeout(timeout).
+		SetTLSClientConfig(&tls.Config{InsecureSkipVerify: config.InsecureSkipVerify})
+	if config.CACertFile != "" {
+		httpClient.SetRootCertificate(config.CACertFile)
+	}
+
+	pageSize := config.PageSize
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+
+	// Sessions of the default instance keep the historical Redis key
+	sessionKey := portaOneSessionKey
+	if name != common.PortaOneDefaultInstance {
+		sessionKey = portaOneSessionKey + ":" + name
+	}
+
 	// Create and return the new PortaOne client
 	client := &portaOneClient{
+		name:       name,
+		sessionKey: sessionKey,
 		config:     config,
 		redis:      redisClient,
-		httpClient: resty.New(),
+		httpClient: httpClient,
+		pageSize:   pageSize,
+		retrier:    resilience.NewRetrier(config.Retry),
+		breaker:    resilience.NewCircuitBreaker("portaone:"+name, config.CircuitBreaker),
 	}
 
-	slog.Info("PortaOne client created", "config", config)
+	slog.Info("PortaOne client created", "instance", name, "base_url", config.BaseURL, "username", config.Username)
 
 	return client, nil
 }
 
+func (c *portaOneClient) Name() string {
+	return c.name
+}
+
 // GetSessionID retrieves or creates a new PortaOne session
 func (c *portaOneClient) GetSessionID(ctx context.Context) (string, error) {
 	// Try to get existing session from Redis
-	sessionID, err := c.redis.Get(ctx, portaOneSessionKey)
+	sessionID, err := c.redis.Get(ctx, c.sessionKey)
 	if err == nil && sessionID != "" {
-		slog.Info("Session found in Redis", "sessionID", sessionID)
+		slog.Debug("Session found in Redis", "instance", c.name)
 		return sessionID, nil
 	}
 
-	slog.Info("No session found in Redis, creating new session")
+	slog.Info("No session found in Redis, creating new session", "instance", c.name)
 	// Create new session if none exists
-	return c.login(ctx)
+	return c.refreshSession(ctx, "")
 }
 
-// login performs the PortaOne login and stores the session
-func (c *portaOneClient) login(ctx context.Context) (string, error) {
-	loginURL := "https://pbwebsrv.intercloud.com.bd/rest/Session/login"
-	loginPayload := map[string]interface{}{
-		"params": map[string]string{
-			"login":    c.config.Username,
-			"password": c.config.Password,
-		},
+// refreshSession obtains a session other than stale, making sure only one
+// login happens at a time: concurrent callers in this process share a single
+// attempt, and across replicas a Redis lock elects the one that logs in while
+// the others wait for the session it stores.
+func (c *portaOneClient) refreshSession(ctx context.Context, stale string) (string, error) {
+	// The login is shared by every waiter, so it belongs to none of them: it
+	// runs on its own context and outlives a caller that gives up
+	result := c.loginGroup.DoChan(c.sessionKey, func() (interface{}, error) {
+		loginCtx, cancel := context.WithTimeout(context.Background(), loginWaitTimeout)
+		defer cancel()
+		return c.loginExclusive(loginCtx, stale)
+	})
+
+	select {
+	case res := <-result:
+		if res.Err != nil {
+			return "", res.Err
+		}
+		return res.Val.(string), nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// loginExclusive logs in while holding the cross-replica login lock, unless
+// another replica stores a fresh session first.
+func (c *portaOneClient) loginExclusive(ctx context.Context, stale string) (string, error) {
+	lock := redis.NewLock(c.redis, c.sessionKey+":lock", loginLockTTL)
+
+	for {
+		if sessionID, err := c.redis.Get(ctx, c.sessionKey); err == nil && sessionID != "" && sessionID != stale {
+			slog.Debug("Using session created by another caller", "instance", c.name)
+			return sessionID, nil
+		}
+
+		acquired, err := lock.TryAcquire(ctx)
+		if err != nil {
+			// Without Redis there is nothing to coordinate on; log in directly
+			slog.Warn("Failed to take PortaOne login lock, logging in without it", "instance", c.name, "error", err)
+			return c.login(ctx)
+		}
+
+		if acquired {
+			defer func() {
+				if err := lock.Release(context.WithoutCancel(ctx)); err != nil {
+					slog.Error("Failed to release PortaOne login lock", "instance", c.name, "error", err)
+				}
+			}()
+
+			// The session may have been stored between our check and taking the lock
+			if sessionID, err := c.redis.Get(ctx, c.sessionKey); err == nil && sessionID != "" && sessionID != stale {
+				return sessionID, nil
+			}
+
+			// A login with retries can outlast the TTL; keep the lock until it ends
+			stop := c.holdLoginLock(ctx, lock)
+			defer stop()
+			return c.login(ctx)
+		}
+
+		select {
+		case <-time.After(loginPollInterval):
+		case <-ctx.Done():
+			return "", fmt.Errorf("timed out waiting for PortaOne login: %w", ctx.Err())
+		}
+	}
+}
+
+// holdLoginLock refreshes the login lock every third of its TTL until the
+// returned func is called, so other replicas don't log in meanwhile.
+func (c *portaOneClient) holdLoginLock(ctx context.Context, lock *redis.Lock) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(loginLockTTL / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if ok, err := lock.Refresh(ctx); err != nil || !ok {
+					slog.Warn("Failed to refresh PortaOne login lock", "instance", c.name, "lost", !ok, "error", err)
+					return
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// GetCustomerXDRs fetches the XDRs of a customer within a time range.
+func (c *portaOneClient) GetCustomerXDRs(ctx context.Context, req GetCustomerXDRsRequest) (*GetCustomerXDRsResponse, error) {
+	var resp GetCustomerXDRsResponse
+	if err := c.call(ctx, methodGetCustomerXDRs, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ForEachCustomerXDR pages through Customer/get_customer_xdrs and calls fn for
+// every XDR in order, so that large customers never need a single huge reply.
+// req.Limit sets the page size (the configured page_size when zero) and
+// req.Offset the starting point. An error returned by fn stops the iteration
+// and is returned as is.
+func (c *portaOneClient) ForEachCustomerXDR(ctx context.Context, req GetCustomerXDRsRequest, fn func(XDR) error) error {
+	return c.ForEachCustomerXDRPage(ctx, req, func(page []XDR) error {
+		for _, xdr := range page {
+			if err := fn(xdr); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ForEachCustomerXDRPage is ForEachCustomerXDR a page at a time. fn is called
+// for every non-empty page.
+func (c *portaOneClient) ForEachCustomerXDRPage(ctx context.Context, req GetCustomerXDRsRequest, fn func([]XDR) error) error {
+	if req.Limit <= 0 {
+		req.Limit = c.pageSize
+	}
+
+	for {
+		resp, err := c.GetCustomerXDRs(ctx, req)
+		if err != nil {
+			return err
+		}
+
+		if len(resp.XDRList) > 0 {
+			if err := fn(resp.XDRList); err != nil {
+				return err
+			}
+		}
+
+		if len(resp.XDRList) < req.Limit {
+			return nil
+		}
+		req.Offset += len(resp.XDRList)
+
+		slog.Debug("Fetching next XDR page", "instance", c.name, "i_customer", req.ICustomer, "offset", req.Offset)
+	}
+}
+
+// errXDRFound stops the paging in GetCustomerXDR once the XDR has turned up.
+var errXDRFound = errors.New("xdr found")
+
+// GetCustomerXDR looks up one XDR of a customer by paging through
+// Customer/get_customer_xdrs over the day (in its own location) containing
+// day, returning nil if the customer has no such XDR that day.
+func (c *portaOneClient) GetCustomerXDR(ctx context.Context, iCustomer int, iXDR int64, day time.Time) (*XDR, error) {
+	from := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	req := GetCustomerXDRsRequest{
+		ICustomer: iCustomer,
+		FromDate:  from.UTC().Format(dateTimeLayout),
+		ToDate:    from.AddDate(0, 0, 1).Add(-time.Second).UTC().Format(dateTimeLayout),
+	}
+
+	var found *XDR
+	err := c.ForEachCustomerXDR(ctx, req, func(xdr XDR) error {
+		if xdr.IXDR != iXDR {
+			return nil
+		}
+		found = &xdr
+		return errXDRFound
+	})
+	if err != nil && !errors.Is(err, errXDRFound) {
+		return nil, err
+	}
+	return found, nil
+}
+
+// GetCallRecording opens the audio stream of the recording attached to an XDR.
+// The caller must close the returned Body.
+func (c *portaOneClient) GetCallRecording(ctx context.Context, req GetCallRecordingRequest) (*CallRecording, error) {
+	resp, err := c.stream(ctx, methodGetCallRecording, req)
+	if err != nil {
+		return nil, err
 	}
 
-	slog.Debug("Making login request", "url", loginURL, "payload", loginPayload)
+	return &CallRecording{
+		Body:          resp.RawBody(),
+		ContentType:   resp.Header().Get("Content-Type"),
+		ContentLength: resp.RawResponse.ContentLength,
+	}, nil
+}
+
+// GetCustomerInfo fetches the details of a customer.
+func (c *portaOneClient) GetCustomerInfo(ctx context.Context, req GetCustomerInfoRequest) (*CustomerInfo, error) {
+	var resp GetCustomerInfoResponse
+	if err := c.call(ctx, methodGetCustomerInfo, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.CustomerInfo, nil
+}
+
+// GetAccountList fetches the accounts that belong to a customer.
+func (c *portaOneClient) GetAccountList(ctx context.Context, req GetAccountListRequest) (*GetAccountListResponse, error) {
+	var resp GetAccountListResponse
+	if err := c.call(ctx, methodGetAccountList, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// call performs an authenticated PortaOne request and decodes the JSON reply into out.
+func (c *portaOneClient) call(ctx context.Context, method string, params interface{}, out interface{}) error {
+	var resp *resty.Response
+	err := c.withSession(ctx, method, func(sessionID string) error {
+		var err error
+		resp, err = c.post(ctx, method, sessionID, params, false)
+		if err != nil {
+			return err
+		}
+
+		if resp.StatusCode() != http.StatusOK {
+			return decodeFault(method, resp.StatusCode(), resp.Body())
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(resp.Body(), out); err != nil {
+		slog.Error("Failed to parse PortaOne response", "method", method, "error", err)
+		return fmt.Errorf("failed to parse PortaOne %s response: %w", method, err)
+	}
+
+	return nil
+}
+
+// stream performs an authenticated PortaOne request and leaves the response body unread.
+// On success the caller owns resp.RawBody().
+func (c *portaOneClient) stream(ctx context.Context, method string, params interface{}) (*resty.Response, error) {
+	var resp *resty.Response
+	err := c.withSession(ctx, method, func(sessionID string) error {
+		var err error
+		resp, err = c.post(ctx, method, sessionID, params, true)
+		if err != nil {
+			return err
+		}
+
+		contentType := resp.Header().Get("Content-Type")
+
+		// PortaOne reports faults as JSON, even with a 200 status.
+		if resp.StatusCode() != http.StatusOK || strings.HasPrefix(contentType, "application/json") {
+			defer resp.RawBody().Close()
+			body, _ := io.ReadAll(resp.RawBody())
+			return decodeFault(method, resp.StatusCode(), body)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
 
-	resp, err := c.httpClient.R().
-		SetContext(ctx).
-		SetBody(loginPayload).
-		Post(loginURL)
+// withSession runs fn with the cached session. If PortaOne rejects that session,
+// it is dropped from Redis, a fresh one is obtained and fn is retried once.
+func (c *portaOneClient) withSession(ctx context.Context, method string, fn func(sessionID string) error) error {
+	sessionID, err := c.GetSessionID(ctx)
+	if err != nil {
+		return err
+	}
 
-	slog.Debug("Received PortaOne response", "statusCode", resp.StatusCode(), "body", string(resp.Body()))
+	err = fn(sessionID)
+	if !IsSessionFault(err) {
+		return err
+	}
 
+	slog.Warn("PortaOne rejected the cached session, logging in again", "method", method, "error", err)
+	c.invalidateSession(ctx, sessionID)
+
+	sessionID, err = c.refreshSession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	return fn(sessionID)
+}
+
+// invalidateSession removes the rejected session from Redis, unless it has
+// already been replaced by a newer one.
+func (c *portaOneClient) invalidateSession(ctx context.Context, sessionID string) {
+	cached, err := c.redis.Get(ctx, c.sessionKey)
+	if err != nil || cached != sessionID {
+		return
+	}
+
+	if err := c.redis.Del(ctx, c.sessionKey); err != nil {
+		slog.Error("Failed to remove PortaOne session from Redis", "error", err)
+	}
+}
+
+// post sends a form-encoded PortaOne request carrying auth_info and params as JSON.
+// An empty sessionID omits auth_info, as required by Session/login.
+func (c *portaOneClient) post(ctx context.Context, method, sessionID string, params interface{}, raw bool) (*resty.Response, error) {
+	paramsJSON, err := json.Marshal(params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal PortaOne %s params: %w", method, err)
+	}
+
+	form := map[string]string{"params": string(paramsJSON)}
+	if sessionID != "" {
+		authInfoJSON, err := json.Marshal(map[string]string{"session_id": sessionID})
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal PortaOne auth_info: %w", err)
+		}
+		form["auth_info"] = string(authInfoJSON)
+	}
+
+	if method != methodLogin {
+		slog.Debug("Making PortaOne request", "instance", c.name, "method", method, "params", string(paramsJSON))
+	}
+
+	var resp *resty.Response
+	err = c.breaker.Execute(func() error {
+		return c.retrier.Do(ctx, "portaone:"+method, func() error {
+			var err error
+			resp, err = c.httpClient.R().
+				SetContext(ctx).
+				SetFormData(form).
+				SetDoNotParseResponse(raw).
+				Post("/" + method)
+			if err != nil {
+				return &transportError{method: method, err: err}
+			}
+
+			// Gateway errors mean PortaOne itself is unreachable; retry them
+			if isTransientStatus(resp.StatusCode()) {
+				if raw {
+					resp.RawBody().Close()
+				}
+				return &APIError{Method: method, StatusCode: resp.StatusCode()}
+			}
+			return nil
+		}, func(err error) bool { return isTransient(ctx, err) })
+	}, func(err error) bool { return isTransient(ctx, err) })
+	if err != nil {
+		slog.Error("PortaOne request failed", "instance", c.name, "method", method, "error", err)
+		return nil, err
+	}
+
+	slog.Debug("Received PortaOne response", "instance", c.name, "method", method, "statusCode", resp.StatusCode())
+
+	return resp, nil
+}
+
+// decodeFault converts a failed PortaOne reply into an *APIError.
+func decodeFault(method string, statusCode int, body []byte) error {
+	apiErr := &APIError{Method: method, StatusCode: statusCode}
+	if err := json.Unmarshal(body, apiErr); err != nil {
+		slog.Error("PortaOne returned an undecodable error", "method", method, "status_code", statusCode, "body", string(body))
+	} else {
+		slog.Error("PortaOne returned a fault", "method", method, "status_code", statusCode, "faultcode", apiErr.FaultCode, "faultstring", apiErr.FaultString)
+	}
+	return apiErr
+}
+
+// login performs the PortaOne login and stores the session
+func (c *portaOneClient) login(ctx context.Context) (string, error) {
+	resp, err := c.post(ctx, methodLogin, "", loginRequest{
+		Login:    c.config.Username,
+		Password: c.config.Password,
+	}, false)
 	if err != nil {
-		slog.Error("PortaOne request failed", "error", err)
-		return "", fmt.Errorf("PortaOne request failed: %w", err)
+		return "", err
 	}
 
-	if resp.StatusCode() != 200 {
-		slog.Error("PortaOne returned non-200 status code", "status_code", resp.StatusCode())
-		return "", fmt.Errorf("PortaOne returned non-200 status code: %d", resp.StatusCode())
+	if resp.StatusCode() != http.StatusOK {
+		return "", decodeFault(methodLogin, resp.StatusCode(), resp.Body())
 	}
 
-	var result map[string]interface{}
+	var result loginResponse
 	if err = json.Unmarshal(resp.Body(), &result); err != nil {
 		slog.Error("Failed to parse PortaOne response", "error", err)
 		return "", fmt.Errorf("failed to parse PortaOne response: %w", err)
 	}
 
-	sessionID, ok := result["session_id"].(string)
-	if !ok {
+	if result.SessionID == "" {
 		slog.Error("session_id not found in PortaOne response")
 		return "", fmt.Errorf("session_id not found in PortaOne response")
 	}
 
 	// Save session to Redis
-	if err = c.redis.Set(ctx, portaOneSessionKey, sessionID, sessionTimeout); err != nil {
+	if err = c.redis.Set(ctx, c.sessionKey, result.SessionID, sessionTimeout); err != nil {
 		slog.Error("Failed to save session to Redis", "error", err)
 		return "", fmt.Errorf("failed to save session to Redis: %w", err)
 	}
 
-	slog.Info("Successfully created session", "sessionID", sessionID)
-	return sessionID, nil
+	slog.Info("Successfully created session", "instance", c.name)
+	return result.SessionID, nil
 }
@@ -0,0 +1,232 @@
+package portaone
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Rafin000/call-recording-service-v2/internal/common"
+	goredis "github.com/go-redis/redis/v8"
+)
+
+// memRedis is an in-memory RedisClient. Eval stands in for the lock scripts:
+// with the token alone it releases, with a TTL as well it refreshes.
+type memRedis struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+func newMemRedis() *memRedis {
+	return &memRedis{values: map[string]string{}}
+}
+
+func (r *memRedis) GetClient() *goredis.Client { return nil }
+func (r *memRedis) Close() error               { return nil }
+
+func (r *memRedis) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.values[key] = value.(string)
+	return nil
+}
+
+func (r *memRedis) Get(ctx context.Context, key string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	value, ok := r.values[key]
+	if !ok {
+		return "", goredis.Nil
+	}
+	return value, nil
+}
+
+func (r *memRedis) Del(ctx context.Context, keys ...string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, key := range keys {
+		delete(r.values, key)
+	}
+	return nil
+}
+
+func (r *memRedis) Exists(ctx context.Context, keys ...string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, key := range keys {
+		if _, ok := r.values[key]; ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *memRedis) TTL(ctx context.Context, key string) (time.Duration, error) { return 0, nil }
+
+func (r *memRedis) Expire(ctx context.Context, key string, expiration time.Duration) error {
+	return nil
+}
+
+func (r *memRedis) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.values[key]; ok {
+		return false, nil
+	}
+	r.values[key] = value.(string)
+	return true, nil
+}
+
+func (r *memRedis) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.values[keys[0]] != args[0] {
+		return int64(0), nil
+	}
+	if len(args) == 1 {
+		delete(r.values, keys[0])
+	}
+	return int64(1), nil
+}
+
+// replayServer answers Session/login and replays the Customer/get_customer_xdrs
+// replies in testdata page by page, going by offset alone. Like PortaOne it
+// pays no attention to params it doesn't know. It records the params of every
+// get_customer_xdrs call.
+func replayServer(t *testing.T, pages ...string) (*httptest.Server, func() []map[string]interface{}) {
+	t.Helper()
+
+	replies := make([][]byte, len(pages))
+	for i, page := range pages {
+		body, err := os.ReadFile("testdata/" + page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		replies[i] = body
+	}
+
+	var mu sync.Mutex
+	var calls []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case restPath + "/" + methodLogin:
+			w.Write([]byte(`{"session_id":"replayed"}`))
+		case restPath + "/" + methodGetCustomerXDRs:
+			var params map[string]interface{}
+			if err := json.Unmarshal([]byte(r.PostFormValue("params")), &params); err != nil {
+				t.Errorf("invalid params: %v", err)
+			}
+			mu.Lock()
+			calls = append(calls, params)
+			mu.Unlock()
+
+			limit, _ := params["limit"].(float64)
+			offset, _ := params["offset"].(float64)
+			page := 0
+			if limit > 0 {
+				page = int(offset / limit)
+			}
+			if page >= len(replies) {
+				w.Write([]byte(`{"xdr_list":[]}`))
+				return
+			}
+			w.Write(replies[page])
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []map[string]interface{} {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]map[string]interface{}(nil), calls...)
+	}
+}
+
+func newTestClient(t *testing.T, baseURL string, config common.PortaOneInstanceConfig) PortaOneClient {
+	t.Helper()
+
+	config.BaseURL = baseURL
+	config.Username, config.Password = "test", "test"
+	client, err := NewPortaOneClient(common.PortaOneDefaultInstance, config, newMemRedis())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestGetCustomerXDR(t *testing.T) {
+	tests := []struct {
+		name  string
+		iXDR  int64
+		found bool
+		calls int
+	}{
+		{name: "first page", iXDR: 7001001, found: true, calls: 1},
+		{name: "later page", iXDR: 7001003, found: true, calls: 2},
+		{name: "another customer's", iXDR: 7009999, found: false, calls: 2},
+	}
+
+	day := time.Date(2026, 1, 10, 15, 4, 5, 0, time.UTC)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, calls := replayServer(t, "get_customer_xdrs_page1.json", "get_customer_xdrs_page2.json")
+			client := newTestClient(t, server.URL, common.PortaOneInstanceConfig{PageSize: 2})
+
+			xdr, err := client.GetCustomerXDR(context.Background(), 1001, tt.iXDR, day)
+			if err != nil {
+				t.Fatalf("GetCustomerXDR: %v", err)
+			}
+			if tt.found && (xdr == nil || xdr.IXDR != tt.iXDR) {
+				t.Fatalf("got %+v, want i_xdr %d", xdr, tt.iXDR)
+			}
+			if !tt.found && xdr != nil {
+				t.Fatalf("got i_xdr %d, want none", xdr.IXDR)
+			}
+
+			got := calls()
+			if len(got) != tt.calls {
+				t.Fatalf("made %d get_customer_xdrs calls, want %d", len(got), tt.calls)
+			}
+			for _, params := range got {
+				if _, ok := params["i_xdr"]; ok {
+					t.Errorf("sent undocumented i_xdr filter: %v", params)
+				}
+				if params["i_customer"] != float64(1001) {
+					t.Errorf("searched i_customer %v, want 1001", params["i_customer"])
+				}
+				if params["from_date"] != "2026-01-10 00:00:00" || params["to_date"] != "2026-01-10 23:59:59" {
+					t.Errorf("searched %v to %v, want the whole of 2026-01-10", params["from_date"], params["to_date"])
+				}
+			}
+		})
+	}
+}
+
+func TestGetCustomerXDRFault(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == restPath+"/"+methodLogin {
+			w.Write([]byte(`{"session_id":"replayed"}`))
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"faultcode":"Server.Customer.not_found","faultstring":"Customer not found"}`))
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, server.URL, common.PortaOneInstanceConfig{})
+	_, err := client.GetCustomerXDR(context.Background(), 1001, 7001001, time.Now())
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.FaultCode != "Server.Customer.not_found" {
+		t.Fatalf("got %v, want the PortaOne fault", err)
+	}
+}
@@ -0,0 +1,458 @@
+// Package portaonesim is a fake PortaOne REST server for development and
+// integration testing. It implements the subset of the API this service
+// uses, serves XDRs and recordings from fixture files, and can inject
+// faults and latency on demand.
+package portaonesim
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Rafin000/call-recording-service-v2/internal/infra/portaone"
+)
+
+const (
+	dateTimeLayout = "2006-01-02 15:04:05"
+
+	methodLogin            = "Session/login"
+	methodGetCustomerXDRs  = "Customer/get_customer_xdrs"
+	methodGetCallRecording = "CDR/get_call_recording"
+
+	faultAuthFailed = "Server.Session.check_auth.auth_failed"
+	faultNotFound   = "Client.CDR.get_call_recording.not_found"
+)
+
+// Options configures a simulator.
+type Options struct {
+	// Username and Password are the credentials accepted by Session/login.
+	Username string
+	Password string
+	// FixturesDir holds xdrs.json and an optional recordings/<i_xdr>.wav per XDR.
+	FixturesDir string
+	// SessionTTL is how long an issued session stays valid. Zero means forever.
+	SessionTTL time.Duration
+	// Latency is added to every request.
+	Latency time.Duration
+	// MaxPageSize rejects get_customer_xdrs calls that would return more XDRs
+	// than this in one reply, as PortaOne does for large replies. Zero means unlimited.
+	MaxPageSize int
+}
+
+// Fault describes a failure to inject into a PortaOne method.
+type Fault struct {
+	// StatusCode of the fault reply; 500 when zero, as PortaOne does.
+	StatusCode  int    `json:"status_code"`
+	FaultCode   string `json:"faultcode"`
+	FaultString string `json:"faultstring"`
+	// Drop closes the connection without replying, simulating a network error.
+	Drop bool `json:"drop"`
+	// Times limits how many requests fail; zero means until cleared.
+	Times int `json:"times"`
+}
+
+// fixtureXDR is an XDR entry of xdrs.json.
+type fixtureXDR struct {
+	ICustomer int `json:"i_customer"`
+	// ConnectOffset places the call relative to simulator start (e.g. "-20h"),
+	// so fixtures always fall into "yesterday" or "today".
+	ConnectOffset string `json:"connect_offset,omitempty"`
+	portaone.XDR
+}
+
+// Server is a fake PortaOne REST API. It implements http.Handler.
+type Server struct {
+	opts    Options
+	started time.Time
+
+	mu       sync.Mutex
+	xdrs     []fixtureXDR
+	sessions map[string]time.Time
+	faults   map[string]*Fault
+	latency  map[string]time.Duration
+}
+
+// New creates a simulator seeded from opts.FixturesDir.
+func New(opts Options) (*Server, error) {
+	s := &Server{
+		opts:     opts,
+		started:  time.Now().UTC(),
+		sessions: make(map[string]time.Time),
+		faults:   make(map[string]*Fault),
+		latency:  make(map[string]time.Duration),
+	}
+
+	if opts.FixturesDir != "" {
+		if err := s.loadFixtures(filepath.Join(opts.FixturesDir, "xdrs.json")); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// loadFixtures reads the XDR fixtures and resolves relative connect times.
+func (s *Server) loadFixtures(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read fixtures: %w", err)
+	}
+
+	var xdrs []fixtureXDR
+	if err := json.Unmarshal(data, &xdrs); err != nil {
+		return fmt.Errorf("failed to parse fixtures %s: %w", path, err)
+	}
+
+	for i := range xdrs {
+		if xdrs[i].ConnectOffset == "" {
+			continue
+		}
+		offset, err := time.ParseDuration(xdrs[i].ConnectOffset)
+		if err != nil {
+			return fmt.Errorf("fixture i_xdr %d: invalid connect_offset: %w", xdrs[i].IXDR, err)
+		}
+		setCallTimes(&xdrs[i].XDR, s.started.Add(offset))
+	}
+
+	s.xdrs = xdrs
+	slog.Info("PortaOne simulator loaded fixtures", "path", path, "xdrs", len(xdrs))
+	return nil
+}
+
+// setCallTimes fills the connect and disconnect fields of an XDR.
+func setCallTimes(xdr *portaone.XDR, connect time.Time) {
+	disconnect := connect.Add(time.Duration(xdr.ChargedQuantity) * time.Second)
+	xdr.ConnectTime = connect.Format(dateTimeLayout)
+	xdr.DisconnectTime = disconnect.Format(dateTimeLayout)
+	xdr.UnixConnectTime = connect.Unix()
+	xdr.UnixDisconnectTime = disconnect.Unix()
+}
+
+// AddXDR adds an XDR for a customer. A zero connect time is taken from UnixConnectTime.
+func (s *Server) AddXDR(iCustomer int, xdr portaone.XDR) {
+	if xdr.ConnectTime == "" {
+		setCallTimes(&xdr, time.Unix(xdr.UnixConnectTime, 0).UTC())
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.xdrs = append(s.xdrs, fixtureXDR{ICustomer: iCustomer, XDR: xdr})
+}
+
+// InjectFault makes the given method (e.g. "CDR/get_call_recording") fail.
+// An empty method applies to every method.
+func (s *Server) InjectFault(method string, fault Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults[method] = &fault
+}
+
+// ClearFaults removes all injected faults.
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = make(map[string]*Fault)
+}
+
+// SetLatency delays every reply of the given method. An empty method applies to every method.
+func (s *Server) SetLatency(method string, latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency[method] = latency
+}
+
+// ExpireSessions invalidates every issued session, as PortaOne does on restart.
+func (s *Server) ExpireSessions() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions = make(map[string]time.Time)
+}
+
+// ServeHTTP routes /rest/<Service>/<method> calls and the /_sim control endpoints.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/_sim/") {
+		s.serveControl(w, r)
+		return
+	}
+
+	method := strings.TrimPrefix(r.URL.Path, "/rest/")
+	if method == r.URL.Path || r.Method != http.MethodPost {
+		http.NotFound(w, r)
+		return
+	}
+
+	slog.Debug("PortaOne simulator request", "method", method)
+
+	if !s.delay(r, method) {
+		return
+	}
+	if s.injectFault(w, method) {
+		return
+	}
+
+	req, err := parseRequest(r)
+	if err != nil {
+		writeFault(w, http.StatusInternalServerError, "Client.request.invalid", err.Error())
+		return
+	}
+
+	if method != methodLogin && !s.validSession(req.AuthInfo.SessionID) {
+		writeFault(w, http.StatusInternalServerError, faultAuthFailed, "Authentication failed")
+		return
+	}
+
+	switch method {
+	case methodLogin:
+		s.login(w, req)
+	case methodGetCustomerXDRs:
+		s.getCustomerXDRs(w, req)
+	case methodGetCallRecording:
+		s.getCallRecording(w, req)
+	default:
+		writeFault(w, http.StatusInternalServerError, "Client.method.unknown", "Unsupported method "+method)
+	}
+}
+
+// delay sleeps for the configured latency. It returns false if the client went away.
+func (s *Server) delay(r *http.Request, method string) bool {
+	s.mu.Lock()
+	latency := s.opts.Latency + s.latency[""] + s.latency[method]
+	s.mu.Unlock()
+
+	if latency <= 0 {
+		return true
+	}
+
+	select {
+	case <-time.After(latency):
+		return true
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+// injectFault replies with a pending injected fault, if any, and reports whether it did.
+func (s *Server) injectFault(w http.ResponseWriter, method string) bool {
+	s.mu.Lock()
+	key := method
+	fault, ok := s.faults[key]
+	if !ok {
+		key = ""
+		fault, ok = s.faults[key]
+	}
+	if ok && fault.Times > 0 {
+		fault.Times--
+		if fault.Times == 0 {
+			delete(s.faults, key)
+		}
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		return false
+	}
+
+	if fault.Drop {
+		if hijacker, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hijacker.Hijack(); err == nil {
+				conn.Close()
+				return true
+			}
+		}
+	}
+
+	statusCode := fault.StatusCode
+	if statusCode == 0 {
+		statusCode = http.StatusInternalServerError
+	}
+	writeFault(w, statusCode, fault.FaultCode, fault.FaultString)
+	return true
+}
+
+func (s *Server) validSession(sessionID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	issued, ok := s.sessions[sessionID]
+	if !ok {
+		return false
+	}
+	if s.opts.SessionTTL > 0 && time.Since(issued) > s.opts.SessionTTL {
+		delete(s.sessions, sessionID)
+		return false
+	}
+	return true
+}
+
+func (s *Server) login(w http.ResponseWriter, req *request) {
+	var params struct {
+		Login    string `json:"login"`
+		Password string `json:"password"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		writeFault(w, http.StatusInternalServerError, "Client.request.invalid", err.Error())
+		return
+	}
+
+	if params.Login != s.opts.Username || params.Password != s.opts.Password {
+		writeFault(w, http.StatusInternalServerError, "Server.Session.auth_failed", "Invalid login or password")
+		return
+	}
+
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	sessionID := hex.EncodeToString(buf)
+
+	s.mu.Lock()
+	s.sessions[sessionID] = time.Now()
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]string{"session_id": sessionID})
+}
+
+func (s *Server) getCustomerXDRs(w http.ResponseWriter, req *request) {
+	var params portaone.GetCustomerXDRsRequest
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		writeFault(w, http.StatusInternalServerError, "Client.request.invalid", err.Error())
+		return
+	}
+
+	from, err := time.Parse(dateTimeLayout, params.FromDate)
+	if err != nil {
+		writeFault(w, http.StatusInternalServerError, "Client.request.invalid", "Invalid from_date")
+		return
+	}
+	to, err := time.Parse(dateTimeLayout, params.ToDate)
+	if err != nil {
+		writeFault(w, http.StatusInternalServerError, "Client.request.invalid", "Invalid to_date")
+		return
+	}
+
+	s.mu.Lock()
+	xdrList := []portaone.XDR{}
+	for _, xdr := range s.xdrs {
+		connect := time.Unix(xdr.UnixConnectTime, 0)
+		if xdr.ICustomer == params.ICustomer && !connect.Before(from) && !connect.After(to) {
+			xdrList = append(xdrList, xdr.XDR)
+		}
+	}
+	s.mu.Unlock()
+
+	xdrList = paginate(xdrList, params.Offset, params.Limit)
+	if s.opts.MaxPageSize > 0 && len(xdrList) > s.opts.MaxPageSize {
+		writeFault(w, http.StatusInternalServerError, "Server.Customer.get_customer_xdrs.too_many_records", "Too many records, use limit and offset")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, portaone.GetCustomerXDRsResponse{XDRList: xdrList})
+}
+
+// paginate applies limit and offset.
+func paginate(xdrList []portaone.XDR, offset, limit int) []portaone.XDR {
+	if offset >= len(xdrList) {
+		return []portaone.XDR{}
+	}
+	xdrList = xdrList[offset:]
+
+	if limit > 0 && limit < len(xdrList) {
+		xdrList = xdrList[:limit]
+	}
+	return xdrList
+}
+
+func (s *Server) getCallRecording(w http.ResponseWriter, req *request) {
+	var params portaone.GetCallRecordingRequest
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		writeFault(w, http.StatusInternalServerError, "Client.request.invalid", err.Error())
+		return
+	}
+
+	xdr, ok := s.findXDR(params.IXDR)
+	if !ok {
+		writeFault(w, http.StatusInternalServerError, faultNotFound, "Recording not found")
+		return
+	}
+
+	// Prefer a recorded fixture, otherwise synthesize a tone as long as the call
+	if s.opts.FixturesDir != "" {
+		path := filepath.Join(s.opts.FixturesDir, "recordings", fmt.Sprintf("%d.wav", params.IXDR))
+		if data, err := os.ReadFile(path); err == nil {
+			w.Header().Set("Content-Type", "audio/wav")
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write(data)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "audio/wav")
+	w.WriteHeader(http.StatusOK)
+	if err := writeToneWAV(w, time.Duration(xdr.ChargedQuantity)*time.Second); err != nil {
+		slog.Error("PortaOne simulator failed to write recording", "i_xdr", params.IXDR, "error", err)
+	}
+}
+
+func (s *Server) findXDR(iXDR int64) (portaone.XDR, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, xdr := range s.xdrs {
+		if xdr.IXDR == iXDR {
+			return xdr.XDR, true
+		}
+	}
+	return portaone.XDR{}, false
+}
+
+// serveControl handles the /_sim endpoints used to steer a running simulator.
+//
+//	POST   /_sim/faults?method=CDR/get_call_recording  {"faultcode": "...", "times": 2}
+//	DELETE /_sim/faults
+//	POST   /_sim/latency?method=...&duration=2s
+//	POST   /_sim/expire_sessions
+func (s *Server) serveControl(w http.ResponseWriter, r *http.Request) {
+	method := r.URL.Query().Get("method")
+
+	switch {
+	case r.URL.Path == "/_sim/faults" && r.Method == http.MethodPost:
+		var fault Fault
+		if err := json.NewDecoder(r.Body).Decode(&fault); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.InjectFault(method, fault)
+	case r.URL.Path == "/_sim/faults" && r.Method == http.MethodDelete:
+		s.ClearFaults()
+	case r.URL.Path == "/_sim/latency" && r.Method == http.MethodPost:
+		latency, err := time.ParseDuration(r.URL.Query().Get("duration"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.SetLatency(method, latency)
+	case r.URL.Path == "/_sim/expire_sessions" && r.Method == http.MethodPost:
+		s.ExpireSessions()
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeFault(w http.ResponseWriter, statusCode int, faultCode, faultString string) {
+	writeJSON(w, statusCode, portaone.APIError{FaultCode: faultCode, FaultString: faultString})
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(body)
+}
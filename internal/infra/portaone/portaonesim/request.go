@@ -0,0 +1,43 @@
+package portaonesim
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// request is a decoded PortaOne call. PortaOne accepts both form-encoded
+// auth_info/params fields and a JSON body carrying the same keys.
+type request struct {
+	AuthInfo struct {
+		SessionID string `json:"session_id"`
+	} `json:"auth_info"`
+	Params json.RawMessage `json:"params"`
+}
+
+func parseRequest(r *http.Request) (*request, error) {
+	var req request
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return nil, fmt.Errorf("invalid JSON body: %w", err)
+		}
+	} else {
+		if err := r.ParseForm(); err != nil {
+			return nil, fmt.Errorf("invalid form body: %w", err)
+		}
+		if authInfo := r.PostForm.Get("auth_info"); authInfo != "" {
+			if err := json.Unmarshal([]byte(authInfo), &req.AuthInfo); err != nil {
+				return nil, fmt.Errorf("invalid auth_info: %w", err)
+			}
+		}
+		req.Params = json.RawMessage(r.PostForm.Get("params"))
+	}
+
+	if len(req.Params) == 0 {
+		req.Params = json.RawMessage("{}")
+	}
+
+	return &req, nil
+}
@@ -0,0 +1,56 @@
+package portaonesim
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+	"time"
+)
+
+const (
+	toneSampleRate = 8000
+	toneFrequency  = 440
+	toneAmplitude  = 8000
+)
+
+// writeToneWAV writes a mono 16-bit PCM WAV containing a sine tone.
+func writeToneWAV(w io.Writer, duration time.Duration) error {
+	if duration < time.Second {
+		duration = time.Second
+	}
+
+	samples := int(duration.Seconds() * toneSampleRate)
+	dataSize := uint32(samples * 2)
+
+	bw := bufio.NewWriter(w)
+	header := []interface{}{
+		[4]byte{'R', 'I', 'F', 'F'},
+		36 + dataSize,
+		[4]byte{'W', 'A', 'V', 'E'},
+		[4]byte{'f', 'm', 't', ' '},
+		uint32(16),                 // fmt chunk size
+		uint16(1),                  // PCM
+		uint16(1),                  // channels
+		uint32(toneSampleRate),     // sample rate
+		uint32(toneSampleRate * 2), // byte rate
+		uint16(2),                  // block align
+		uint16(16),                 // bits per sample
+		[4]byte{'d', 'a', 't', 'a'},
+		dataSize,
+	}
+	for _, field := range header {
+		if err := binary.Write(bw, binary.LittleEndian, field); err != nil {
+			return err
+		}
+	}
+
+	for i := 0; i < samples; i++ {
+		sample := int16(toneAmplitude * math.Sin(2*math.Pi*toneFrequency*float64(i)/toneSampleRate))
+		if err := binary.Write(bw, binary.LittleEndian, sample); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
@@ -0,0 +1,91 @@
+package portaone
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+
+	"github.com/Rafin000/call-recording-service-v2/internal/common"
+	"github.com/Rafin000/call-recording-service-v2/internal/infra/redis"
+)
+
+// Registry holds one PortaOne client per configured instance and resolves
+// which of them serves a given user or customer.
+type Registry interface {
+	// Default returns the client of the inline (default) instance.
+	Default() PortaOneClient
+	// Client returns the client of a named instance. An empty name means the default instance.
+	Client(instance string) (PortaOneClient, error)
+	// Resolve picks the client for a customer. An explicit instance (e.g. from the
+	// user document) wins, then the portaone.customers mapping, then the default.
+	Resolve(instance string, iCustomer string) (PortaOneClient, error)
+	// Instances lists the configured instance names.
+	Instances() []string
+}
+
+type registry struct {
+	clients   map[string]PortaOneClient
+	customers map[string]string
+}
+
+// NewRegistry creates a client for every PortaOne instance in the config.
+func NewRegistry(config common.PortaOneConfig, redisClient redis.RedisClient) (Registry, error) {
+	r := &registry{
+		clients:   make(map[string]PortaOneClient, len(config.Instances)+1),
+		customers: config.Customers,
+	}
+
+	defaultClient, err := NewPortaOneClient(common.PortaOneDefaultInstance, config.PortaOneInstanceConfig, redisClient)
+	if err != nil {
+		return nil, err
+	}
+	r.clients[common.PortaOneDefaultInstance] = defaultClient
+
+	for name, instanceConfig := range config.Instances {
+		client, err := NewPortaOneClient(name, instanceConfig, redisClient)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create PortaOne client %q: %w", name, err)
+		}
+		r.clients[name] = client
+	}
+
+	return r, nil
+}
+
+func (r *registry) Default() PortaOneClient {
+	return r.clients[common.PortaOneDefaultInstance]
+}
+
+func (r *registry) Client(instance string) (PortaOneClient, error) {
+	if instance == "" {
+		return r.Default(), nil
+	}
+
+	client, ok := r.clients[instance]
+	if !ok {
+		return nil, fmt.Errorf("unknown PortaOne instance %q", instance)
+	}
+	return client, nil
+}
+
+func (r *registry) Resolve(instance string, iCustomer string) (PortaOneClient, error) {
+	if instance == "" && iCustomer != "" {
+		instance = r.customers[iCustomer]
+	}
+
+	client, err := r.Client(instance)
+	if err != nil {
+		slog.Error("Failed to resolve PortaOne instance", "instance", instance, "i_customer", iCustomer, "error", err)
+		return nil, err
+	}
+	return client, nil
+}
+
+func (r *registry) Instances() []string {
+	names := make([]string, 0, len(r.clients))
+	for name := range r.clients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,257 @@
+package portaone_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Rafin000/call-recording-service-v2/internal/common"
+	"github.com/Rafin000/call-recording-service-v2/internal/infra/portaone"
+	"github.com/Rafin000/call-recording-service-v2/internal/infra/portaone/portaonesim"
+	"github.com/Rafin000/call-recording-service-v2/internal/infra/resilience"
+)
+
+// simServer runs a simulator seeded from the repo's fixtures and counts the
+// requests it receives per method.
+type simServer struct {
+	*portaonesim.Server
+	URL string
+
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func newSimServer(t *testing.T) *simServer {
+	t.Helper()
+
+	sim, err := portaonesim.New(portaonesim.Options{Username: "test", Password: "test", FixturesDir: "../../../fixtures/portaone"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &simServer{Server: sim, calls: map[string]int{}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.calls[strings.TrimPrefix(r.URL.Path, "/rest/")]++
+		s.mu.Unlock()
+		sim.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	s.URL = server.URL
+
+	return s
+}
+
+func (s *simServer) callCount(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[method]
+}
+
+func newSimClient(t *testing.T, s *simServer, config common.PortaOneInstanceConfig) portaone.PortaOneClient {
+	t.Helper()
+
+	config.BaseURL = s.URL
+	config.Username, config.Password = "test", "test"
+	if config.Retry.InitialBackoff == 0 {
+		config.Retry.InitialBackoff = time.Millisecond
+	}
+	client, err := portaone.NewPortaOneClient(t.Name(), config, portaone.NewMemRedis())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// dayRequest lists the XDRs of customer 1001 over the last two days.
+func dayRequest() portaone.GetCustomerXDRsRequest {
+	now := time.Now().UTC()
+	return portaone.GetCustomerXDRsRequest{
+		ICustomer: 1001,
+		FromDate:  now.Add(-48 * time.Hour).Format("2006-01-02 15:04:05"),
+		ToDate:    now.Add(time.Hour).Format("2006-01-02 15:04:05"),
+	}
+}
+
+func TestSimGetCallRecording(t *testing.T) {
+	s := newSimServer(t)
+	client := newSimClient(t, s, common.PortaOneInstanceConfig{})
+
+	recording, err := client.GetCallRecording(context.Background(), portaone.GetCallRecordingRequest{IXDR: 900001})
+	if err != nil {
+		t.Fatalf("GetCallRecording: %v", err)
+	}
+	defer recording.Body.Close()
+
+	data, err := io.ReadAll(recording.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recording.ContentType != "audio/wav" || len(data) < 44 || string(data[:4]) != "RIFF" {
+		t.Errorf("got %d bytes of %q, want a WAV file", len(data), recording.ContentType)
+	}
+
+	_, err = client.GetCallRecording(context.Background(), portaone.GetCallRecordingRequest{IXDR: 1})
+	var apiErr *portaone.APIError
+	if !errors.As(err, &apiErr) || portaone.IsUnavailable(err) {
+		t.Errorf("got %v, want a PortaOne fault for an unknown XDR", err)
+	}
+}
+
+func TestSimSessionRelogin(t *testing.T) {
+	s := newSimServer(t)
+	client := newSimClient(t, s, common.PortaOneInstanceConfig{})
+	ctx := context.Background()
+	if _, err := client.GetSessionID(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	s.ExpireSessions()
+	if _, err := client.GetCustomerXDRs(ctx, dayRequest()); err != nil {
+		t.Fatalf("GetCustomerXDRs after the session expired: %v", err)
+	}
+	if got := s.callCount("Session/login"); got != 2 {
+		t.Errorf("logged in %d times, want a second login after the session expired", got)
+	}
+	if got := s.callCount("Customer/get_customer_xdrs"); got != 2 {
+		t.Errorf("made %d get_customer_xdrs calls, want the rejected one and its retry", got)
+	}
+}
+
+func TestSimRetry(t *testing.T) {
+	tests := []struct {
+		name      string
+		fault     portaonesim.Fault
+		wantErr   bool
+		wantCalls int
+	}{
+		{name: "transient fault is retried", fault: portaonesim.Fault{StatusCode: http.StatusServiceUnavailable, Times: 2}, wantCalls: 3},
+		{name: "dropped connection is retried", fault: portaonesim.Fault{Drop: true, Times: 1}, wantCalls: 2},
+		{name: "retries run out", fault: portaonesim.Fault{StatusCode: http.StatusBadGateway, Times: 5}, wantErr: true, wantCalls: 3},
+		{name: "PortaOne fault is not retried", fault: portaonesim.Fault{FaultCode: "Server.Customer.not_found", FaultString: "Customer not found", Times: 1}, wantErr: true, wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSimServer(t)
+			client := newSimClient(t, s, common.PortaOneInstanceConfig{Retry: common.RetryConfig{MaxAttempts: 3}})
+			if _, err := client.GetSessionID(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			s.InjectFault("Customer/get_customer_xdrs", tt.fault)
+			_, err := client.GetCustomerXDRs(context.Background(), dayRequest())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if got := s.callCount("Customer/get_customer_xdrs"); got != tt.wantCalls {
+				t.Errorf("made %d calls, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestSimCircuitBreaker(t *testing.T) {
+	s := newSimServer(t)
+	client := newSimClient(t, s, common.PortaOneInstanceConfig{
+		Retry:          common.RetryConfig{MaxAttempts: 1},
+		CircuitBreaker: common.CircuitBreakerConfig{FailureThreshold: 2, OpenTimeout: 100 * time.Millisecond},
+	})
+	ctx := context.Background()
+	if _, err := client.GetSessionID(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	s.InjectFault("Customer/get_customer_xdrs", portaonesim.Fault{StatusCode: http.StatusServiceUnavailable})
+	for i := 0; i < 2; i++ {
+		if _, err := client.GetCustomerXDRs(ctx, dayRequest()); !portaone.IsUnavailable(err) {
+			t.Fatalf("call %d: got %v, want PortaOne unavailable", i+1, err)
+		}
+	}
+
+	_, err := client.GetCustomerXDRs(ctx, dayRequest())
+	if !errors.Is(err, resilience.ErrCircuitOpen) {
+		t.Fatalf("got %v, want the circuit open", err)
+	}
+	if got := s.callCount("Customer/get_customer_xdrs"); got != 2 {
+		t.Errorf("made %d calls, want none while the circuit is open", got)
+	}
+
+	s.ClearFaults()
+	time.Sleep(150 * time.Millisecond)
+	if _, err := client.GetCustomerXDRs(ctx, dayRequest()); err != nil {
+		t.Fatalf("after the circuit reopened: %v", err)
+	}
+}
+
+func TestSimConcurrentLogin(t *testing.T) {
+	s := newSimServer(t)
+	client := newSimClient(t, s, common.PortaOneInstanceConfig{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.GetSessionID(context.Background()); err != nil {
+				t.Errorf("GetSessionID: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := s.callCount("Session/login"); got != 1 {
+		t.Fatalf("logged in %d times for concurrent callers, want 1", got)
+	}
+}
+
+func TestSimLoginOutlivesFirstCaller(t *testing.T) {
+	s := newSimServer(t)
+	client := newSimClient(t, s, common.PortaOneInstanceConfig{})
+	s.SetLatency("Session/login", 100*time.Millisecond)
+
+	// The caller that starts the login gives up while it is in flight
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	first := make(chan error, 1)
+	go func() {
+		_, err := client.GetSessionID(ctx)
+		first <- err
+	}()
+	time.Sleep(5 * time.Millisecond)
+
+	if _, err := client.GetSessionID(context.Background()); err != nil {
+		t.Fatalf("GetSessionID of the waiting caller: %v", err)
+	}
+	if err := <-first; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v for the caller that gave up, want its deadline", err)
+	}
+	if got := s.callCount("Session/login"); got != 1 {
+		t.Errorf("logged in %d times, want the one login shared", got)
+	}
+}
+
+func TestSimGetCustomerXDRs(t *testing.T) {
+	s := newSimServer(t)
+	client := newSimClient(t, s, common.PortaOneInstanceConfig{PageSize: 2})
+
+	var iXDRs []int64
+	err := client.ForEachCustomerXDR(context.Background(), dayRequest(), func(xdr portaone.XDR) error {
+		iXDRs = append(iXDRs, xdr.IXDR)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ForEachCustomerXDR: %v", err)
+	}
+	if len(iXDRs) != 3 {
+		t.Fatalf("got XDRs %v, want the 3 of customer 1001", iXDRs)
+	}
+	if got := s.callCount("Customer/get_customer_xdrs"); got != 2 {
+		t.Errorf("fetched %d pages, want 2", got)
+	}
+}
@@ -0,0 +1,146 @@
+package portaone
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// APIError is a fault returned by the PortaOne REST API.
+type APIError struct {
+	Method      string `json:"-"`
+	StatusCode  int    `json:"-"`
+	FaultCode   string `json:"faultcode"`
+	FaultString string `json:"faultstring"`
+}
+
+func (e *APIError) Error() string {
+	if e.FaultCode == "" {
+		return fmt.Sprintf("PortaOne %s returned status %d", e.Method, e.StatusCode)
+	}
+	return fmt.Sprintf("PortaOne %s returned fault %s: %s", e.Method, e.FaultCode, e.FaultString)
+}
+
+// IsSessionFault reports whether err means PortaOne no longer accepts the
+// session it was called with, so that logging in again may succeed.
+func IsSessionFault(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	if apiErr.StatusCode == http.StatusUnauthorized {
+		return true
+	}
+
+	code := strings.ToLower(apiErr.FaultCode)
+	return strings.Contains(code, "check_auth") ||
+		strings.Contains(code, "auth_failed") ||
+		strings.Contains(code, "session.alert_you_must_log_in")
+}
+
+// XDR is a single call detail record as returned by PortaOne.
+type XDR struct {
+	IXDR               int64   `json:"i_xdr"`
+	IAccount           int64   `json:"i_account"`
+	AccountID          string  `json:"account_id"`
+	CLI                string  `json:"CLI"`
+	CLD                string  `json:"CLD"`
+	ConnectTime        string  `json:"connect_time"`
+	DisconnectTime     string  `json:"disconnect_time"`
+	UnixConnectTime    int64   `json:"unix_connect_time"`
+	UnixDisconnectTime int64   `json:"unix_disconnect_time"`
+	ChargedAmount      float64 `json:"charged_amount"`
+	ChargedQuantity    int64   `json:"charged_quantity"`
+	IService           int     `json:"i_service"`
+	IDest              int64   `json:"i_dest"`
+	Country            string  `json:"country"`
+	Subdivision        string  `json:"subdivision"`
+	Description        string  `json:"description"`
+	BillStatus         string  `json:"bill_status"`
+	H323ConfID         string  `json:"h323_conf_id"`
+}
+
+// GetCustomerXDRsRequest holds the params of Customer/get_customer_xdrs.
+type GetCustomerXDRsRequest struct {
+	ICustomer     int    `json:"i_customer"`
+	FromDate      string `json:"from_date"`
+	ToDate        string `json:"to_date"`
+	BillingModel  int    `json:"billing_model,omitempty"`
+	CallRecording int    `json:"call_recording,omitempty"`
+	Limit         int    `json:"limit,omitempty"`
+	Offset        int    `json:"offset,omitempty"`
+}
+
+// GetCustomerXDRsResponse is the reply of Customer/get_customer_xdrs.
+type GetCustomerXDRsResponse struct {
+	XDRList []XDR `json:"xdr_list"`
+}
+
+// GetCallRecordingRequest holds the params of CDR/get_call_recording.
+type GetCallRecordingRequest struct {
+	IXDR int64 `json:"i_xdr"`
+}
+
+// CallRecording is the audio stream returned by CDR/get_call_recording.
+// The caller must close Body.
+type CallRecording struct {
+	Body          io.ReadCloser
+	ContentType   string
+	ContentLength int64
+}
+
+// GetCustomerInfoRequest holds the params of Customer/get_customer_info.
+type GetCustomerInfoRequest struct {
+	ICustomer int `json:"i_customer"`
+}
+
+// CustomerInfo describes a PortaOne customer.
+type CustomerInfo struct {
+	ICustomer   int     `json:"i_customer"`
+	Name        string  `json:"name"`
+	CompanyName string  `json:"companyname"`
+	Email       string  `json:"email"`
+	Currency    string  `json:"iso_4217"`
+	Status      string  `json:"status"`
+	Balance     float64 `json:"balance"`
+}
+
+// GetCustomerInfoResponse is the reply of Customer/get_customer_info.
+type GetCustomerInfoResponse struct {
+	CustomerInfo CustomerInfo `json:"customer_info"`
+}
+
+// GetAccountListRequest holds the params of Account/get_account_list.
+type GetAccountListRequest struct {
+	ICustomer int `json:"i_customer"`
+	Limit     int `json:"limit,omitempty"`
+	Offset    int `json:"offset,omitempty"`
+}
+
+// Account describes a PortaOne account belonging to a customer.
+type Account struct {
+	IAccount  int64  `json:"i_account"`
+	ICustomer int    `json:"i_customer"`
+	ID        string `json:"id"`
+	Status    string `json:"status"`
+	Blocked   string `json:"blocked"`
+}
+
+// GetAccountListResponse is the reply of Account/get_account_list.
+type GetAccountListResponse struct {
+	AccountList []Account `json:"account_list"`
+}
+
+// loginRequest holds the params of Session/login.
+type loginRequest struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+}
+
+// loginResponse is the reply of Session/login.
+type loginResponse struct {
+	SessionID string `json:"session_id"`
+}
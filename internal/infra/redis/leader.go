@@ -0,0 +1,111 @@
+package redis
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// LeaderElector campaigns for a lease in Redis so that only one replica acts
+// as leader at a time. The leader renews the lease every third of its TTL; if
+// it dies or loses Redis, the lease expires and another replica takes over.
+type LeaderElector struct {
+	lock *Lock
+	key  string
+	ttl  time.Duration
+
+	mu     sync.Mutex
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewLeaderElector creates an elector for the lease on key.
+func NewLeaderElector(client RedisClient, key string, ttl time.Duration) *LeaderElector {
+	return &LeaderElector{
+		lock: NewLock(client, key, ttl),
+		key:  key,
+		ttl:  ttl,
+	}
+}
+
+// Run campaigns until ctx is done, then gives the lease up if it holds it.
+func (e *LeaderElector) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		e.campaign(ctx)
+
+		select {
+		case <-ctx.Done():
+			if e.IsLeader() {
+				e.demote("shutting down")
+				if err := e.lock.Release(context.WithoutCancel(ctx)); err != nil {
+					slog.Error("Failed to release leader lease", "key", e.key, "error", err)
+				}
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// campaign renews the lease when leading and tries to take it otherwise.
+func (e *LeaderElector) campaign(ctx context.Context) {
+	if e.IsLeader() {
+		ok, err := e.lock.Refresh(ctx)
+		switch {
+		case err != nil:
+			// Without Redis we can't tell whether another replica took over,
+			// so stop leading rather than risk two leaders
+			e.demote("lease renewal failed: " + err.Error())
+		case !ok:
+			e.demote("lease lost")
+		}
+		return
+	}
+
+	ok, err := e.lock.TryAcquire(ctx)
+	if err != nil {
+		slog.Error("Failed to campaign for leadership", "key", e.key, "error", err)
+		return
+	}
+	if ok {
+		e.promote(ctx)
+	}
+}
+
+func (e *LeaderElector) promote(ctx context.Context) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.ctx, e.cancel = context.WithCancel(ctx)
+	slog.Info("Elected leader", "key", e.key)
+}
+
+func (e *LeaderElector) demote(reason string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.cancel != nil {
+		e.cancel()
+	}
+	e.ctx, e.cancel = nil, nil
+	slog.Warn("No longer leader", "key", e.key, "reason", reason)
+}
+
+// IsLeader reports whether this replica currently holds the lease.
+func (e *LeaderElector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.ctx != nil
+}
+
+// LeaderContext returns a context that is cancelled as soon as leadership is
+// lost, and false if this replica is not the leader.
+func (e *LeaderElector) LeaderContext() (context.Context, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.ctx, e.ctx != nil
+}
@@ -0,0 +1,57 @@
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// Lua scripts that only touch the key while it still holds our token, so an
+// expired lock that someone else has since taken over is never released or extended.
+const (
+	releaseScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) else return 0 end`
+	refreshScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("PEXPIRE", KEYS[1], ARGV[2]) else return 0 end`
+)
+
+// Lock is a lease on a Redis key shared by every replica. It is held until
+// released or until its TTL runs out without a refresh.
+type Lock struct {
+	client RedisClient
+	key    string
+	token  string
+	ttl    time.Duration
+}
+
+// NewLock creates a lock on key. Each Lock carries its own random token.
+func NewLock(client RedisClient, key string, ttl time.Duration) *Lock {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+
+	return &Lock{
+		client: client,
+		key:    key,
+		token:  hex.EncodeToString(buf),
+		ttl:    ttl,
+	}
+}
+
+// TryAcquire takes the lock if nobody holds it. It does not wait.
+func (l *Lock) TryAcquire(ctx context.Context) (bool, error) {
+	return l.client.SetNX(ctx, l.key, l.token, l.ttl)
+}
+
+// Refresh extends the lease by the lock TTL. It returns false if the lock was lost.
+func (l *Lock) Refresh(ctx context.Context) (bool, error) {
+	n, err := l.client.Eval(ctx, refreshScript, []string{l.key}, l.token, l.ttl.Milliseconds())
+	if err != nil {
+		return false, err
+	}
+	return n == int64(1), nil
+}
+
+// Release gives the lock up if it is still ours.
+func (l *Lock) Release(ctx context.Context) error {
+	_, err := l.client.Eval(ctx, releaseScript, []string{l.key}, l.token)
+	return err
+}
@@ -19,6 +19,8 @@ type RedisClient interface {
 	Exists(ctx context.Context, keys ...string) (bool, error)
 	TTL(ctx context.Context, key string) (time.Duration, error)
 	Expire(ctx context.Context, key string, expiration time.Duration) error
+	SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error)
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error)
 }
 
 // redisClient handles Redis operations
@@ -82,3 +84,11 @@ func (r *redisClient) TTL(ctx context.Context, key string) (time.Duration, error
 func (r *redisClient) Expire(ctx context.Context, key string, expiration time.Duration) error {
 	return r.client.Expire(ctx, key, expiration).Err()
 }
+
+func (r *redisClient) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error) {
+	return r.client.SetNX(ctx, key, value, expiration).Result()
+}
+
+func (r *redisClient) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	return r.client.Eval(ctx, script, keys, args...).Result()
+}
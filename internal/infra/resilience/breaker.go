@@ -0,0 +1,186 @@
+package resilience
+
+import (
+	"errors"
+	"expvar"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Rafin000/call-recording-service-v2/internal/common"
+)
+
+const (
+	defaultFailureThreshold = 5
+	defaultOpenTimeout      = 30 * time.Second
+)
+
+// ErrCircuitOpen is returned without calling the operation while the breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// breakerMetrics is published at /debug/vars as circuit_breakers.<name>.
+var breakerMetrics = expvar.NewMap("circuit_breakers")
+
+// State is the state of a CircuitBreaker.
+type State int
+
+const (
+	StateClosed State = iota
+	StateOpen
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// CircuitBreaker fails fast after consecutive failures. Once OpenTimeout has
+// passed it lets a single trial call through (half-open); success closes the
+// circuit again, failure re-opens it.
+type CircuitBreaker struct {
+	name             string
+	failureThreshold int
+	openTimeout      time.Duration
+
+	mu            sync.Mutex
+	state         State
+	failures      int
+	openedAt      time.Time
+	trialInFlight bool
+
+	metrics  *expvar.Map
+	stateVar *expvar.String
+}
+
+// NewCircuitBreaker creates a closed breaker, filling unset values with defaults.
+func NewCircuitBreaker(name string, cfg common.CircuitBreakerConfig) *CircuitBreaker {
+	b := &CircuitBreaker{
+		name:             name,
+		failureThreshold: cfg.FailureThreshold,
+		openTimeout:      cfg.OpenTimeout,
+	}
+	if b.failureThreshold <= 0 {
+		b.failureThreshold = defaultFailureThreshold
+	}
+	if b.openTimeout <= 0 {
+		b.openTimeout = defaultOpenTimeout
+	}
+
+	// Reuse the metrics of an earlier breaker with the same name
+	if existing, ok := breakerMetrics.Get(name).(*expvar.Map); ok {
+		b.metrics = existing
+	} else {
+		b.metrics = new(expvar.Map).Init()
+		breakerMetrics.Set(name, b.metrics)
+	}
+	b.stateVar = new(expvar.String)
+	b.stateVar.Set(StateClosed.String())
+	b.metrics.Set("state", b.stateVar)
+
+	return b
+}
+
+// State returns the current state of the breaker.
+func (b *CircuitBreaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance()
+	return b.state
+}
+
+// Execute runs fn unless the circuit is open. Errors for which isFailure
+// returns true count towards opening the circuit.
+func (b *CircuitBreaker) Execute(fn func() error, isFailure func(error) bool) error {
+	if !b.allow() {
+		b.metrics.Add("rejected_total", 1)
+		return ErrCircuitOpen
+	}
+
+	err := fn()
+	b.record(err != nil && isFailure(err))
+	return err
+}
+
+// allow reports whether a call may proceed and claims the half-open trial slot.
+func (b *CircuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance()
+
+	switch b.state {
+	case StateOpen:
+		return false
+	case StateHalfOpen:
+		if b.trialInFlight {
+			return false
+		}
+		b.trialInFlight = true
+	}
+	return true
+}
+
+// record updates the breaker with the outcome of a call.
+func (b *CircuitBreaker) record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateHalfOpen {
+		b.trialInFlight = false
+		if failed {
+			b.transition(StateOpen)
+		} else {
+			b.transition(StateClosed)
+		}
+		return
+	}
+
+	if !failed {
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == StateClosed && b.failures >= b.failureThreshold {
+		b.transition(StateOpen)
+	}
+}
+
+// advance moves an open breaker to half-open once the open timeout has passed.
+// Must be called with b.mu held.
+func (b *CircuitBreaker) advance() {
+	if b.state == StateOpen && time.Since(b.openedAt) >= b.openTimeout {
+		b.transition(StateHalfOpen)
+	}
+}
+
+// transition changes state and publishes it. Must be called with b.mu held.
+func (b *CircuitBreaker) transition(state State) {
+	if b.state == state {
+		return
+	}
+
+	slog.Warn("Circuit breaker changed state", "breaker", b.name, "from", b.state.String(), "to", state.String())
+
+	b.state = state
+	b.failures = 0
+	if state == StateOpen {
+		b.openedAt = time.Now()
+	}
+
+	b.stateVar.Set(state.String())
+	switch state {
+	case StateOpen:
+		b.metrics.Add("opened_total", 1)
+	case StateHalfOpen:
+		b.metrics.Add("half_opened_total", 1)
+	case StateClosed:
+		b.metrics.Add("closed_total", 1)
+	}
+}
@@ -0,0 +1,70 @@
+package resilience
+
+import (
+	"context"
+	"log/slog"
+	"math/rand"
+	"time"
+
+	"github.com/Rafin000/call-recording-service-v2/internal/common"
+)
+
+const (
+	defaultMaxAttempts    = 3
+	defaultInitialBackoff = 200 * time.Millisecond
+	defaultMaxBackoff     = 5 * time.Second
+)
+
+// Retrier re-runs an operation with bounded exponential backoff and full jitter.
+type Retrier struct {
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+// NewRetrier creates a Retrier, filling unset values with defaults.
+func NewRetrier(cfg common.RetryConfig) *Retrier {
+	r := &Retrier{
+		maxAttempts:    cfg.MaxAttempts,
+		initialBackoff: cfg.InitialBackoff,
+		maxBackoff:     cfg.MaxBackoff,
+	}
+	if r.maxAttempts <= 0 {
+		r.maxAttempts = defaultMaxAttempts
+	}
+	if r.initialBackoff <= 0 {
+		r.initialBackoff = defaultInitialBackoff
+	}
+	if r.maxBackoff <= 0 {
+		r.maxBackoff = defaultMaxBackoff
+	}
+	return r
+}
+
+// Do calls fn until it succeeds, returns an error retryable rejects, the
+// attempts are used up or ctx is done. It returns the last error of fn.
+func (r *Retrier) Do(ctx context.Context, name string, fn func() error, retryable func(error) bool) error {
+	backoff := r.initialBackoff
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= r.maxAttempts || !retryable(err) {
+			return err
+		}
+
+		// Full jitter keeps concurrent callers from retrying in lockstep
+		wait := time.Duration(rand.Int63n(int64(backoff)) + 1)
+		slog.Warn("Retrying after transient error", "operation", name, "attempt", attempt, "wait", wait, "error", err)
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return err
+		}
+
+		backoff *= 2
+		if backoff > r.maxBackoff {
+			backoff = r.maxBackoff
+		}
+	}
+}
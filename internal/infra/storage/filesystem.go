@@ -0,0 +1,242 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// uploadTempPrefix marks files still being written; List skips them.
+const uploadTempPrefix = ".upload-"
+
+// filesystemStore keeps recordings as files under a root directory, for
+// on-prem installs archiving to a NAS and for running without object storage.
+// Content types are derived from the key's extension.
+type filesystemStore struct {
+	root string
+}
+
+// NewFilesystemStore creates a RecordingStore rooted at root, creating the
+// directory if needed.
+func NewFilesystemStore(root string) (RecordingStore, error) {
+	if root == "" {
+		return nil, fmt.Errorf("filesystem storage root is required")
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(root, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create storage root: %w", err)
+	}
+	return &filesystemStore{root: root}, nil
+}
+
+// path maps a key to a file under the root. Cleaning the key as an absolute
+// path first keeps ".." from escaping the root.
+func (s *filesystemStore) path(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if clean == "/" {
+		return "", fmt.Errorf("invalid key %q", key)
+	}
+	return filepath.Join(s.root, filepath.FromSlash(clean)), nil
+}
+
+// Put writes body to a temporary file next to the target and renames it into
+// place, so readers never see a partial recording.
+func (s *filesystemStore) Put(ctx context.Context, key string, body io.Reader, opts PutOptions) (*ObjectInfo, error) {
+	target, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create directory for %s: %w", key, err)
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(target), uploadTempPrefix+"*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", key, err)
+	}
+	defer os.Remove(file.Name())
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(file, hash), contextReader{ctx: ctx, r: body})
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", key, err)
+	}
+
+	if err := os.Rename(file.Name(), target); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", key, err)
+	}
+
+	info, err := s.Stat(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	info.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return info, nil
+}
+
+func (s *filesystemStore) Get(ctx context.Context, key string, rng *ByteRange) (*Object, error) {
+	name, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, fsError(key, err)
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fsError(key, err)
+	}
+
+	object := &Object{ObjectInfo: s.info(key, stat), Body: file}
+	if rng == nil {
+		return object, nil
+	}
+
+	if rng.Start < 0 || rng.Start >= stat.Size() {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", key, ErrInvalidRange)
+	}
+	end := rng.End
+	if end < 0 || end >= stat.Size() {
+		end = stat.Size() - 1
+	}
+	if _, err := file.Seek(rng.Start, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fsError(key, err)
+	}
+
+	object.Range = &ByteRange{Start: rng.Start, End: end}
+	object.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(file, end-rng.Start+1), file}
+	return object, nil
+}
+
+func (s *filesystemStore) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	name, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := os.Stat(name)
+	if err != nil {
+		return nil, fsError(key, err)
+	}
+	if stat.IsDir() {
+		return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+	}
+
+	info := s.info(key, stat)
+	return &info, nil
+}
+
+func (s *filesystemStore) Delete(ctx context.Context, key string) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fsError(key, err)
+	}
+	return nil
+}
+
+func (s *filesystemStore) List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error {
+	// Only walk the directory the prefix points into
+	dir := s.root
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		var err error
+		if dir, err = s.path(prefix[:i]); err != nil {
+			return err
+		}
+	}
+
+	err := filepath.WalkDir(dir, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), uploadTempPrefix) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.root, name)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		stat, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		return fn(s.info(key, stat))
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s *filesystemStore) info(key string, stat fs.FileInfo) ObjectInfo {
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	return ObjectInfo{
+		Key:          key,
+		Size:         stat.Size(),
+		ContentType:  contentType,
+		ETag:         fmt.Sprintf(`"%x-%x"`, stat.ModTime().UnixNano(), stat.Size()),
+		LastModified: stat.ModTime(),
+	}
+}
+
+func fsError(key string, err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%s: %w", key, ErrNotFound)
+	}
+	return fmt.Errorf("failed to access %s: %w", key, err)
+}
+
+// contextReader stops a copy once ctx is done, as the S3 uploader does.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
@@ -0,0 +1,269 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"time"
+
+	"github.com/Rafin000/call-recording-service-v2/internal/common"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// checksumMetadataKey is the S3 user metadata key holding an object's SHA-256.
+const checksumMetadataKey = "sha256"
+
+// uploadPartSize is the size of each multipart upload part, and so the most a
+// single upload buffers in memory per part in flight.
+const uploadPartSize = manager.MinUploadPartSize
+
+// s3Store keeps recordings in an S3 bucket.
+type s3Store struct {
+	client   *s3.Client
+	uploader *manager.Uploader
+	bucket   string
+}
+
+// NewS3Store creates a RecordingStore on the configured S3 bucket. A custom
+// endpoint is addressed path-style, as S3-compatible stores expect.
+func NewS3Store(cfg common.AppSettings) RecordingStore {
+	client := newS3Client(cfg)
+	return &s3Store{
+		client: client,
+		uploader: manager.NewUploader(client, func(u *manager.Uploader) {
+			u.PartSize = uploadPartSize
+			u.Concurrency = 2
+		}),
+		bucket: cfg.S3_BUCKET_NAME,
+	}
+}
+
+// defaultS3Region signs requests when no region is configured, which is all
+// most S3-compatible stores need.
+const defaultS3Region = "us-east-1"
+
+func newS3Client(cfg common.AppSettings) *s3.Client {
+	region := cfg.AWS_REGION
+	if region == "" {
+		region = defaultS3Region
+	}
+
+	awsCfg := aws.Config{
+		Region: region,
+		Credentials: credentials.NewStaticCredentialsProvider(
+			cfg.AWS_ACCESS_KEY,
+			cfg.AWS_SECRET_ACCESS_KEY,
+			"",
+		),
+	}
+
+	return s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		if cfg.S3_ENDPOINT_URL != "" {
+			o.BaseEndpoint = aws.String(cfg.S3_ENDPOINT_URL)
+			o.UsePathStyle = true
+		}
+	})
+}
+
+// byteCounter is an io.Writer that only counts what is written to it.
+type byteCounter int64
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	*c += byteCounter(len(p))
+	return len(p), nil
+}
+
+// Put streams body to S3, computing its size and SHA-256 as the bytes pass
+// through. Small objects go up in a single PutObject, larger ones as a
+// multipart upload.
+func (s *s3Store) Put(ctx context.Context, key string, body io.Reader, opts PutOptions) (*ObjectInfo, error) {
+	hash := sha256.New()
+	var size byteCounter
+
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Body:   io.TeeReader(body, io.MultiWriter(hash, &size)),
+	}
+	if opts.ContentType != "" {
+		input.ContentType = aws.String(opts.ContentType)
+	}
+
+	if _, err := s.uploader.Upload(ctx, input); err != nil {
+		slog.Error("Failed to upload to S3", "error", err, "bucket", s.bucket, "key", key)
+		return nil, fmt.Errorf("failed to upload to S3: %w", err)
+	}
+
+	checksum := hex.EncodeToString(hash.Sum(nil))
+	etag, err := s.setChecksum(ctx, key, checksum, opts.ContentType)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("Uploaded to S3", "bucket", s.bucket, "key", key, "size", int64(size))
+	return &ObjectInfo{
+		Key:         key,
+		Size:        int64(size),
+		ContentType: opts.ContentType,
+		ETag:        etag,
+		SHA256:      checksum,
+	}, nil
+}
+
+// setChecksum stores the SHA-256 of an uploaded object in its metadata. The
+// hash is only known once the stream has been read, so the object is copied
+// onto itself server-side rather than re-uploaded.
+func (s *s3Store) setChecksum(ctx context.Context, key, checksum, contentType string) (string, error) {
+	input := &s3.CopyObjectInput{
+		Bucket:            aws.String(s.bucket),
+		Key:               aws.String(key),
+		CopySource:        aws.String(s.bucket + "/" + key),
+		Metadata:          map[string]string{checksumMetadataKey: checksum},
+		MetadataDirective: types.MetadataDirectiveReplace,
+	}
+	if contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+
+	output, err := s.client.CopyObject(ctx, input)
+	if err != nil {
+		return "", fmt.Errorf("failed to store checksum in S3 metadata: %w", err)
+	}
+	if output.CopyObjectResult == nil {
+		return "", nil
+	}
+	return aws.ToString(output.CopyObjectResult.ETag), nil
+}
+
+func (s *s3Store) Get(ctx context.Context, key string, rng *ByteRange) (*Object, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}
+	if rng != nil {
+		input.Range = aws.String(rng.header())
+	}
+
+	output, err := s.client.GetObject(ctx, input)
+	if err != nil {
+		return nil, s3Error(key, err)
+	}
+
+	object := &Object{
+		ObjectInfo: ObjectInfo{
+			Key:          key,
+			Size:         aws.ToInt64(output.ContentLength),
+			ContentType:  aws.ToString(output.ContentType),
+			ETag:         aws.ToString(output.ETag),
+			LastModified: aws.ToTime(output.LastModified),
+			SHA256:       output.Metadata[checksumMetadataKey],
+		},
+		Body: output.Body,
+	}
+
+	// A ranged reply reports the whole size in Content-Range
+	var start, end, total int64
+	if _, err := fmt.Sscanf(aws.ToString(output.ContentRange), "bytes %d-%d/%d", &start, &end, &total); err == nil {
+		object.Size = total
+		object.Range = &ByteRange{Start: start, End: end}
+	}
+
+	return object, nil
+}
+
+// SignedURL presigns a GetObject request for key.
+func (s *s3Store) SignedURL(ctx context.Context, key string, expires time.Duration, opts SignedURLOptions) (string, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}
+	if opts.Filename != "" {
+		input.ResponseContentDisposition = aws.String(mime.FormatMediaType("attachment", map[string]string{"filename": opts.Filename}))
+	}
+
+	request, err := s3.NewPresignClient(s.client).PresignGetObject(ctx, input, s3.WithPresignExpires(expires))
+	if err != nil {
+		return "", fmt.Errorf("failed to presign %s: %w", key, err)
+	}
+	return request.URL, nil
+}
+
+func (s *s3Store) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	output, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, s3Error(key, err)
+	}
+
+	return &ObjectInfo{
+		Key:          key,
+		Size:         aws.ToInt64(output.ContentLength),
+		ContentType:  aws.ToString(output.ContentType),
+		ETag:         aws.ToString(output.ETag),
+		LastModified: aws.ToTime(output.LastModified),
+		SHA256:       output.Metadata[checksumMetadataKey],
+	}, nil
+}
+
+func (s *s3Store) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return s3Error(key, err)
+	}
+	return nil
+}
+
+func (s *s3Store) List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error {
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return s3Error(prefix, err)
+		}
+		for _, object := range page.Contents {
+			err := fn(ObjectInfo{
+				Key:          aws.ToString(object.Key),
+				Size:         aws.ToInt64(object.Size),
+				ETag:         aws.ToString(object.ETag),
+				LastModified: aws.ToTime(object.LastModified),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// s3Error maps S3 errors onto the store's own, keeping the original as context.
+func s3Error(key string, err error) error {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "NoSuchKey", "NotFound":
+			return fmt.Errorf("%s: %w", key, ErrNotFound)
+		case "InvalidRange":
+			return fmt.Errorf("%s: %w", key, ErrInvalidRange)
+		}
+	}
+	return fmt.Errorf("S3 request for %s failed: %w", key, err)
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Rafin000/call-recording-service-v2/internal/common"
+)
+
+var (
+	// ErrNotFound is returned for a key that has no object.
+	ErrNotFound = errors.New("object not found")
+	// ErrInvalidRange is returned for a range that starts past the end of the object.
+	ErrInvalidRange = errors.New("range not satisfiable")
+)
+
+// RecordingStore is where archived recordings, and files derived from them,
+// are kept. Keys are slash-separated paths such as
+// "<instance>/<i_customer>/<date>/recording_<i_xdr>.wav".
+type RecordingStore interface {
+	// Put streams body to key, replacing any existing object, and returns what
+	// was stored including its size and SHA-256.
+	Put(ctx context.Context, key string, body io.Reader, opts PutOptions) (*ObjectInfo, error)
+	// Get opens an object, or only the bytes in rng when it is not nil. The
+	// caller must close the returned body.
+	Get(ctx context.Context, key string, rng *ByteRange) (*Object, error)
+	// Stat describes an object without reading it.
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	// Delete removes an object. Deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+	// List calls fn for every object whose key starts with prefix, in key
+	// order, until fn returns an error.
+	List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error
+}
+
+// URLSigner is implemented by stores that can hand out time-limited URLs
+// for reading an object directly, without going through this service.
+type URLSigner interface {
+	SignedURL(ctx context.Context, key string, expires time.Duration, opts SignedURLOptions) (string, error)
+}
+
+// SignedURLOptions shape the response to a signed URL.
+type SignedURLOptions struct {
+	// Filename makes the response a download saved under this name.
+	Filename string
+}
+
+// PutOptions describe the object being stored.
+type PutOptions struct {
+	ContentType string
+}
+
+// ObjectInfo describes a stored object. SHA256 is only set where the backend
+// keeps it with the object.
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+	SHA256       string
+}
+
+// ByteRange selects bytes Start to End of an object, inclusive. A negative End
+// reads to the end of the object.
+type ByteRange struct {
+	Start int64
+	End   int64
+}
+
+// header formats the range as an HTTP Range header value.
+func (r ByteRange) header() string {
+	if r.End < 0 {
+		return fmt.Sprintf("bytes=%d-", r.Start)
+	}
+	return fmt.Sprintf("bytes=%d-%d", r.Start, r.End)
+}
+
+// Object is an open stored object. Size is the size of the whole object;
+// Range is the part Body holds, or nil when it holds all of it.
+type Object struct {
+	ObjectInfo
+	Range *ByteRange
+	Body  io.ReadCloser
+}
+
+// NewRecordingStore creates the store selected by storage.backend.
+func NewRecordingStore(cfg common.AppConfig) (RecordingStore, error) {
+	switch cfg.Storage.Backend {
+	case "", common.StorageBackendS3:
+		return NewS3Store(cfg.App), nil
+	case common.StorageBackendFilesystem:
+		return NewFilesystemStore(cfg.Storage.Filesystem.Root)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Storage.Backend)
+	}
+}
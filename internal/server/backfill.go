@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Rafin000/call-recording-service-v2/internal/common"
+	"github.com/Rafin000/call-recording-service-v2/internal/cron"
+	"github.com/Rafin000/call-recording-service-v2/internal/domain"
+	"github.com/Rafin000/call-recording-service-v2/internal/infra/portaone"
+	"github.com/Rafin000/call-recording-service-v2/internal/infra/redis"
+	"github.com/Rafin000/call-recording-service-v2/internal/infra/storage"
+	"github.com/Rafin000/call-recording-service-v2/internal/tasks"
+)
+
+// RunBackfill connects to the service's dependencies and runs a backfill in the
+// foreground, logging its progress every progressInterval until it finishes or
+// ctx is cancelled. It does not start the HTTP server or the scheduler.
+func RunBackfill(ctx context.Context, opts tasks.BackfillOptions, progressInterval time.Duration) error {
+	cfg, err := common.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	setupSlogger(cfg.App)
+
+	startupCtx, cancel := context.WithTimeout(ctx, common.Timeouts.Server.Startup)
+	defer cancel()
+
+	redisClient, err := redis.NewRedisClient(startupCtx, cfg.Redis)
+	if err != nil {
+		return err
+	}
+
+	portaoneRegistry, err := portaone.NewRegistry(cfg.PortaOne, redisClient)
+	if err != nil {
+		return err
+	}
+
+	store, err := storage.NewRecordingStore(*cfg)
+	if err != nil {
+		return err
+	}
+
+	mongoDB, err := setupMongoDB(startupCtx, cfg.MongoDB)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := mongoDB.Client().Disconnect(context.Background()); err != nil {
+			slog.Error("failed to disconnect from MongoDB", "error", err)
+		}
+	}()
+
+	backup := tasks.NewBackup(domain.NewUserRepository(mongoDB), domain.NewXDRRepository(mongoDB), domain.NewBackupRunRepository(mongoDB), domain.NewRecordingRetryRepository(mongoDB), domain.NewBackfillRepository(mongoDB), store, portaoneRegistry, cfg.Backup)
+
+	// Days are those of the backup job unless the caller picked a zone
+	if opts.TimeZone == "" {
+		opts.TimeZone = cron.JobConfig(cfg.Jobs, common.JobBackup).TimeZone
+	}
+
+	backfill, err := backup.StartBackfill(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-backfill.Done():
+			progress := backfill.Progress()
+			if progress.State != tasks.BackfillCompleted {
+				return fmt.Errorf("backfill %s after %d of %d days (%d skipped)", progress.State, progress.DaysDone, progress.DaysTotal, progress.DaysSkipped)
+			}
+			if progress.Failed > 0 {
+				return fmt.Errorf("backfill finished with %d failed recordings; run it again to retry them", progress.Failed)
+			}
+			return nil
+		case <-ticker.C:
+			progress := backfill.Progress()
+			slog.Info("Backfill progress", "day", progress.CurrentDay, "days", fmt.Sprintf("%d/%d", progress.DaysDone, progress.DaysTotal),
+				"daysSkipped", progress.DaysSkipped, "xdrs", progress.XDRs, "archived", progress.Archived, "skipped", progress.Skipped,
+				"pending", progress.Pending, "failed", progress.Failed)
+		}
+	}
+}
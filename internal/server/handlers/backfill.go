@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Rafin000/call-recording-service-v2/internal/common"
+	"github.com/Rafin000/call-recording-service-v2/internal/cron"
+	"github.com/Rafin000/call-recording-service-v2/internal/tasks"
+	"github.com/gin-gonic/gin"
+)
+
+// backfillListLimit is how many of the most recent backfills GetBackfills lists.
+const backfillListLimit = 50
+
+type BackfillHandler struct {
+	jobManager *cron.JobManager
+}
+
+func NewBackfillHandler(jobManager *cron.JobManager) *BackfillHandler {
+	return &BackfillHandler{
+		jobManager: jobManager,
+	}
+}
+
+// backfillRequest is the body of StartBackfill. Dates are YYYY-MM-DD.
+type backfillRequest struct {
+	From       string   `json:"from" binding:"required"`
+	To         string   `json:"to"`
+	ICustomers []string `json:"i_customers"`
+	DryRun     bool     `json:"dry_run"`
+}
+
+// StartBackfill starts backing up a range of past days in the background.
+func (h *BackfillHandler) StartBackfill(c *gin.Context) {
+	var request backfillRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+
+	from, err := time.Parse("2006-01-02", request.From)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid from date, expected YYYY-MM-DD"})
+		return
+	}
+	to := from
+	if request.To != "" {
+		to, err = time.Parse("2006-01-02", request.To)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid to date, expected YYYY-MM-DD"})
+			return
+		}
+	}
+
+	backfill, err := h.jobManager.Backup.StartBackfill(h.jobManager.C, tasks.BackfillOptions{
+		From:       from,
+		To:         to,
+		TimeZone:   cron.JobConfig(h.jobManager.Jobs, common.JobBackup).TimeZone,
+		ICustomers: request.ICustomers,
+		DryRun:     request.DryRun,
+	})
+	if errors.Is(err, tasks.ErrBackfillRunning) {
+		c.JSON(http.StatusConflict, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": fmt.Sprintf("Invalid backfill: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"status": "success", "backfill": backfill.Progress()})
+}
+
+// GetBackfills lists the most recent backfills.
+func (h *BackfillHandler) GetBackfills(c *gin.Context) {
+	backfills, err := h.jobManager.Backup.Backfills(c.Request.Context(), backfillListLimit)
+	if err != nil {
+		slog.Error("Failed to list backfills", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to list backfills"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "backfills": backfills})
+}
+
+// GetBackfill reports the progress of one backfill.
+func (h *BackfillHandler) GetBackfill(c *gin.Context) {
+	progress, err := h.jobManager.Backup.BackfillProgress(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		slog.Error("Failed to get backfill", "id", c.Param("id"), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to get backfill"})
+		return
+	}
+	if progress == nil {
+		c.JSON(http.StatusNotFound, gin.H{"status": "error", "message": "Backfill not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "backfill": progress})
+}
+
+// CancelBackfill stops a running backfill. Running it again resumes it. Only
+// the replica running a backfill can cancel it.
+func (h *BackfillHandler) CancelBackfill(c *gin.Context) {
+	backfill := h.jobManager.Backup.Backfill(c.Param("id"))
+	if backfill == nil {
+		progress, err := h.jobManager.Backup.BackfillProgress(c.Request.Context(), c.Param("id"))
+		if err == nil && progress != nil && progress.State == tasks.BackfillRunning {
+			c.JSON(http.StatusConflict, gin.H{"status": "error", "message": "Backfill is running on another replica"})
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"status": "error", "message": "Backfill not found"})
+		return
+	}
+
+	backfill.Cancel()
+	c.JSON(http.StatusAccepted, gin.H{"status": "success", "backfill": backfill.Progress()})
+}
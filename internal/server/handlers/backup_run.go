@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Rafin000/call-recording-service-v2/internal/domain"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type BackupRunHandler struct {
+	backupRunRepo domain.BackupRunRepository
+}
+
+func NewBackupRunHandler(backupRunRepo domain.BackupRunRepository) *BackupRunHandler {
+	return &BackupRunHandler{
+		backupRunRepo: backupRunRepo,
+	}
+}
+
+// GetBackupRuns lists the most recent backup runs.
+func (h *BackupRunHandler) GetBackupRuns(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid limit"})
+		return
+	}
+	limit = min(limit, maxPageSize)
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	runs, err := h.backupRunRepo.ListBackupRuns(ctx, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to list backup runs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "backup_runs": runs})
+}
+
+// GetBackupRun returns a backup run with the number of its XDRs in each state.
+func (h *BackupRunHandler) GetBackupRun(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid backup run ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	run, err := h.backupRunRepo.GetBackupRun(ctx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to get backup run"})
+		return
+	}
+	if run == nil {
+		c.JSON(http.StatusNotFound, gin.H{"status": "error", "message": "Backup run not found"})
+		return
+	}
+
+	counts, err := h.backupRunRepo.CountBackupRunXDRs(ctx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to count backup run XDRs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "backup_run": run, "xdr_counts": counts})
+}
+
+// GetBackupRunXDRs lists the XDRs of a backup run. It defaults to the ones
+// still to be archived; ?state= takes a comma-separated list of states.
+func (h *BackupRunHandler) GetBackupRunXDRs(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid backup run ID"})
+		return
+	}
+
+	states := strings.Split(c.DefaultQuery("state", domain.BackupXDRPending+","+domain.BackupXDRFailed), ",")
+
+	var iCustomer *int
+	if value := c.Query("i_customer"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid i_customer"})
+			return
+		}
+		iCustomer = &parsed
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "500"))
+	if err != nil || limit < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid limit"})
+		return
+	}
+	limit = min(limit, maxPageSize)
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	items, err := h.backupRunRepo.ListBackupRunXDRs(ctx, id, iCustomer, states, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to list backup run XDRs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "xdrs": items})
+}
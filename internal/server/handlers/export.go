@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/Rafin000/call-recording-service-v2/internal/common"
+	"github.com/Rafin000/call-recording-service-v2/internal/domain"
+	"github.com/Rafin000/call-recording-service-v2/internal/infra/storage"
+	"github.com/Rafin000/call-recording-service-v2/internal/tasks"
+	"github.com/Rafin000/call-recording-service-v2/internal/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// exportLinkTTL is the lifetime of the download link handed out for a
+// finished export; polling the export hands out a fresh one.
+const exportLinkTTL = 15 * time.Minute
+
+type ExportHandler struct {
+	exporter *tasks.Exporter
+	store    storage.RecordingStore
+	config   common.AppConfig
+}
+
+func NewExportHandler(exporter *tasks.Exporter, store storage.RecordingStore, config common.AppConfig) *ExportHandler {
+	return &ExportHandler{
+		exporter: exporter,
+		store:    store,
+		config:   config,
+	}
+}
+
+// exportView is an export as shown to its owner, with a download link once
+// it is ready.
+type exportView struct {
+	*domain.RecordingExport
+	DownloadURL string `json:"download_url,omitempty"`
+}
+
+// DownloadRecordings zips the archived recordings of the calls matching a
+// /xdrs/historical filter, with a manifest.csv of their XDRs. Small downloads
+// are streamed straight back; larger ones are built in the background and
+// answered with 202 and the export to poll for a download link, the one
+// already being built if the same download was asked for before.
+func (h *ExportHandler) DownloadRecordings(c *gin.Context) {
+	iCustomer, ok := exportCustomer(c)
+	if !ok {
+		return
+	}
+
+	fromDate, toDate, err := historicalRange(c, time.Now().In(common.DefaultLocation))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+	filter := tasks.ExportFilter{ICustomer: iCustomer, From: fromDate, To: toDate}
+
+	summary, sync, err := h.exporter.Plan(c.Request.Context(), filter)
+	switch {
+	case errors.Is(err, tasks.ErrExportEmpty):
+		c.JSON(http.StatusNotFound, gin.H{"status": "error", "message": "No XDRs match the filter"})
+		return
+	case errors.Is(err, tasks.ErrExportTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"status": "error", "message": fmt.Sprintf("%v; narrow the date range", err)})
+		return
+	case err != nil:
+		slog.Error("Failed to plan recording download", "i_customer", iCustomer, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Error preparing download"})
+		return
+	}
+
+	if !sync {
+		export, err := h.exporter.Start(c.Request.Context(), filter, summary, c.GetString("email"))
+		if errors.Is(err, tasks.ErrExportBusy) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"status": "error", "message": "Too many downloads are being prepared; try again later"})
+			return
+		}
+		if err != nil {
+			slog.Error("Failed to start recording export", "i_customer", iCustomer, "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Error starting export"})
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"status": "success", "export": exportView{RecordingExport: export}})
+		return
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filter.Filename()}))
+	c.Status(http.StatusOK)
+
+	// Once the first bytes are out the status can't change, so a failure
+	// leaves a truncated ZIP the client will reject
+	if err := h.exporter.WriteZIP(c.Request.Context(), c.Writer, filter); err != nil {
+		slog.Error("Recording download interrupted", "i_customer", iCustomer, "error", err)
+		c.Abort()
+	}
+}
+
+// GetExport reports the state of a background export and, once it is ready,
+// a short-lived link to download it.
+func (h *ExportHandler) GetExport(c *gin.Context) {
+	export, ok := h.lookupExport(c)
+	if !ok {
+		return
+	}
+	if !mayAccessCustomer(c, export.ICustomer) {
+		callerCustomer, _ := customerFromContext(c)
+		slog.Warn("Denied access to recording export", "id", export.ID.Hex(), "owner_i_customer", export.ICustomer,
+			"i_customer", callerCustomer, "email", c.GetString("email"))
+		c.JSON(http.StatusForbidden, gin.H{"status": "error", "message": "You do not have access to this export"})
+		return
+	}
+
+	view := exportView{RecordingExport: export}
+	if export.State == domain.RecordingExportReady {
+		view.DownloadURL = h.downloadURL(c, export)
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "export": view})
+}
+
+// DownloadExport streams a finished export to the holder of a link issued by
+// GetExport. The signature stands in for the bearer token.
+func (h *ExportHandler) DownloadExport(c *gin.Context) {
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err == nil {
+		err = utils.VerifyExportDownload(c.Param("id"), expires, c.Query("signature"), h.config)
+	}
+	if err != nil {
+		message := "Invalid download link"
+		if errors.Is(err, utils.ErrLinkExpired) {
+			message = "Download link expired"
+		}
+		c.JSON(http.StatusForbidden, gin.H{"status": "error", "message": message})
+		return
+	}
+
+	export, ok := h.lookupExport(c)
+	if !ok {
+		return
+	}
+	if export.State != domain.RecordingExportReady {
+		c.JSON(http.StatusConflict, gin.H{"status": "error", "message": "Export is not ready"})
+		return
+	}
+
+	filter := tasks.ExportFilter{ICustomer: export.ICustomer, From: export.FromDate, To: export.ToDate}
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filter.Filename()}))
+	served, err := serveStoredObject(c.Request.Context(), c, h.store, export.Key, "application/zip")
+	if !served {
+		slog.Error("Export missing from storage", "id", export.ID.Hex(), "key", export.Key, "error", err)
+		c.Writer.Header().Del("Content-Disposition")
+		c.JSON(http.StatusNotFound, gin.H{"status": "error", "message": "Export not found"})
+	}
+}
+
+// lookupExport loads the export named by the :id param, answering the request
+// itself if there is none.
+func (h *ExportHandler) lookupExport(c *gin.Context) (*domain.RecordingExport, bool) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid export ID"})
+		return nil, false
+	}
+
+	export, err := h.exporter.Get(c.Request.Context(), id)
+	if err != nil {
+		slog.Error("Failed to get recording export", "id", id.Hex(), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Error fetching export"})
+		return nil, false
+	}
+	if export == nil {
+		c.JSON(http.StatusNotFound, gin.H{"status": "error", "message": "Export not found"})
+		return nil, false
+	}
+	return export, true
+}
+
+// downloadURL links to a finished export: presigned on the store where it can,
+// otherwise signed for DownloadExport, which sits at .../exports/:id/file.
+func (h *ExportHandler) downloadURL(c *gin.Context, export *domain.RecordingExport) string {
+	filter := tasks.ExportFilter{ICustomer: export.ICustomer, From: export.FromDate, To: export.ToDate}
+	if signer, ok := h.store.(storage.URLSigner); ok {
+		signedURL, err := signer.SignedURL(c.Request.Context(), export.Key, exportLinkTTL, storage.SignedURLOptions{Filename: filter.Filename()})
+		if err == nil {
+			return signedURL
+		}
+		slog.Error("Failed to presign export, signing our own link instead", "id", export.ID.Hex(), "error", err)
+	}
+
+	expires := time.Now().Add(exportLinkTTL).Unix()
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("signature", utils.SignExportDownload(export.ID.Hex(), expires, h.config))
+
+	link := publicBaseURL(c, h.config)
+	link.Path = path.Join(link.Path, c.Request.URL.Path, "file")
+	link.RawQuery = query.Encode()
+	return link.String()
+}
+
+// exportCustomer picks whose recordings to download: the caller's own, or for
+// an admin the customer named by ?i_customer. It answers the request itself
+// when the caller can't download them.
+func exportCustomer(c *gin.Context) (int, bool) {
+	if requested := c.Query("i_customer"); requested != "" {
+		iCustomer, err := strconv.Atoi(requested)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid i_customer format"})
+			return 0, false
+		}
+		if !mayAccessCustomer(c, iCustomer) {
+			callerCustomer, _ := customerFromContext(c)
+			slog.Warn("Denied recording download for another customer", "requested_i_customer", iCustomer,
+				"i_customer", callerCustomer, "email", c.GetString("email"))
+			c.JSON(http.StatusForbidden, gin.H{"status": "error", "message": "You do not have access to this customer"})
+			return 0, false
+		}
+		return iCustomer, true
+	}
+
+	iCustomer, err := customerFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+		return 0, false
+	}
+	return iCustomer, true
+}
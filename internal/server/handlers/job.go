@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Rafin000/call-recording-service-v2/internal/cron"
+	"github.com/gin-gonic/gin"
+)
+
+type JobHandler struct {
+	jobManager *cron.JobManager
+}
+
+func NewJobHandler(jobManager *cron.JobManager) *JobHandler {
+	return &JobHandler{
+		jobManager: jobManager,
+	}
+}
+
+// triggerJobRequest is the optional body of TriggerJob.
+type triggerJobRequest struct {
+	Params cron.JobParams `json:"params"`
+}
+
+// GetJobs lists the scheduled jobs with their next run, and their running and
+// last run on this replica.
+func (h *JobHandler) GetJobs(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "success", "jobs": h.jobManager.ListJobs()})
+}
+
+// GetJob describes one job, including the live progress of its running run.
+func (h *JobHandler) GetJob(c *gin.Context) {
+	job, err := h.jobManager.GetJob(c.Param("name"))
+	if err != nil {
+		respondJobError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "job": job})
+}
+
+// TriggerJob starts a run of a job on this replica right away.
+func (h *JobHandler) TriggerJob(c *gin.Context) {
+	var request triggerJobRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
+	}
+
+	run, err := h.jobManager.TriggerJob(c.Param("name"), request.Params)
+	if err != nil {
+		respondJobError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"status": "success", "run": run.Info()})
+}
+
+// CancelJob cancels the running run of a job.
+func (h *JobHandler) CancelJob(c *gin.Context) {
+	run, err := h.jobManager.CancelJob(c.Param("name"))
+	if err != nil {
+		respondJobError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"status": "success", "run": run.Info()})
+}
+
+func respondJobError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, cron.ErrJobNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"status": "error", "message": "Job not found"})
+	case errors.Is(err, cron.ErrJobRunning), errors.Is(err, cron.ErrJobNotRunning):
+		c.JSON(http.StatusConflict, gin.H{"status": "error", "message": err.Error()})
+	case errors.Is(err, cron.ErrInvalidJobParams):
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": err.Error()})
+	}
+}
@@ -0,0 +1,5 @@
+package handlers
+
+// maxPageSize caps the page_size and limit query parameters of the listing
+// routes; larger values are clamped to it.
+const maxPageSize = 500
@@ -0,0 +1,322 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Rafin000/call-recording-service-v2/internal/common"
+	"github.com/Rafin000/call-recording-service-v2/internal/infra/portaone"
+	"github.com/Rafin000/call-recording-service-v2/internal/infra/storage"
+	"github.com/Rafin000/call-recording-service-v2/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// recordingContentType is served when the store doesn't know better; every
+// archived recording is a WAV file.
+const recordingContentType = "audio/wav"
+
+// defaultSignedURLTTL is the lifetime of a signed playback URL when
+// storage.signed_url_ttl is not set.
+const defaultSignedURLTTL = 5 * time.Minute
+
+// errUnsatisfiableRange is returned by parseRange for a range that lies
+// entirely past the end of the object.
+var errUnsatisfiableRange = errors.New("range not satisfiable")
+
+// GetRecordingURL issues a short-lived URL that plays one recording without an
+// Authorization header, for use as the source of an <audio> element. Archived
+// recordings in a store that can presign get a direct link to the store;
+// everything else gets a link to PlaySignedRecording signed with SECRET_KEY.
+func (h *XDRHandler) GetRecordingURL(c *gin.Context) {
+	iXdr, err := strconv.ParseInt(c.Param("i_xdr"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid i_xdr format"})
+		return
+	}
+
+	xdr, ok := h.authorizeXDR(c, iXdr)
+	if !ok {
+		return
+	}
+
+	ttl := h.config.Storage.SignedURLTTL
+	if ttl <= 0 {
+		ttl = defaultSignedURLTTL
+	}
+	expiresAt := time.Now().Add(ttl).Truncate(time.Second)
+
+	if signer, ok := h.store.(storage.URLSigner); ok && xdr.Archive != nil {
+		signedURL, err := signer.SignedURL(c.Request.Context(), xdr.Archive.S3Key, ttl, storage.SignedURLOptions{})
+		if err == nil {
+			c.JSON(http.StatusOK, gin.H{"status": "success", "url": signedURL, "expires_at": expiresAt.UTC()})
+			return
+		}
+		slog.Error("Failed to presign recording, signing our own link instead", "i_xdr", iXdr, "error", err)
+	}
+
+	// The link names the customer and the instance the XDR belongs to, in
+	// case the recording has to come from PortaOne
+	claims := utils.PlaybackClaims{
+		IXDR:      iXdr,
+		ICustomer: xdr.ICustomer,
+		Instance:  xdr.Instance,
+		Expires:   expiresAt.Unix(),
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "url": playbackURL(c, h.config, claims, utils.SignPlayback(claims, h.config)), "expires_at": expiresAt.UTC()})
+}
+
+// PlaySignedRecording streams a recording to the holder of a link issued by
+// GetRecordingURL. The signature stands in for the bearer token.
+func (h *XDRHandler) PlaySignedRecording(c *gin.Context) {
+	iXdr, err := strconv.ParseInt(c.Param("i_xdr"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid i_xdr format"})
+		return
+	}
+
+	claims := utils.PlaybackClaims{IXDR: iXdr, Instance: c.Query("instance")}
+	claims.Expires, err = strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err == nil && c.Query("i_customer") != "" {
+		claims.ICustomer, err = strconv.Atoi(c.Query("i_customer"))
+	}
+	if err == nil {
+		err = utils.VerifyPlayback(claims, c.Query("signature"), h.config)
+	}
+	if err != nil {
+		message := "Invalid playback link"
+		if errors.Is(err, utils.ErrLinkExpired) {
+			message = "Playback link expired"
+		}
+		c.JSON(http.StatusForbidden, gin.H{"status": "error", "message": message})
+		return
+	}
+
+	h.streamRecording(c, iXdr, claims.Instance)
+}
+
+// streamRecording serves a recording of the named instance from the archive,
+// or proxies it from that instance if it hasn't been archived.
+func (h *XDRHandler) streamRecording(c *gin.Context, iXdr int64, instance string) {
+	portaoneClient, err := h.portaone.Client(instance)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+
+	archive, err := h.xdrRepo.GetXDRArchive(c.Request.Context(), portaoneClient.Name(), iXdr)
+	if err != nil {
+		slog.Error("Failed to look up archived recording", "i_xdr", iXdr, "error", err)
+	}
+	if archive != nil {
+		// Long recordings take a while to stream, so this is bounded by the
+		// client going away rather than a timeout
+		served, err := serveStoredObject(c.Request.Context(), c, h.store, archive.S3Key, recordingContentType)
+		if served {
+			return
+		}
+		logArchiveFallback(iXdr, archive.S3Key, err)
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 1*time.Minute)
+	defer cancel()
+
+	recording, err := portaoneClient.GetCallRecording(ctx, portaone.GetCallRecordingRequest{IXDR: iXdr})
+	if err != nil {
+		c.JSON(portaOneErrorStatus(err), gin.H{"status": "error", "message": fmt.Sprintf("Failed to get call recording: %v", err)})
+		return
+	}
+	defer recording.Body.Close()
+
+	// Stream the recording back to the client
+	c.DataFromReader(http.StatusOK, recording.ContentLength, recording.ContentType, recording.Body, nil)
+}
+
+// serveStoredObject streams the object at key to the client, honouring Range,
+// If-Range and If-None-Match so players can seek and downloads can resume.
+// contentType is used when the store doesn't know the object's. It reports
+// false, having written nothing, if the object is not in the store.
+func serveStoredObject(ctx context.Context, c *gin.Context, store storage.RecordingStore, key, contentType string) (bool, error) {
+	info, err := store.Stat(ctx, key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if info.ContentType != "" && info.ContentType != "application/octet-stream" {
+		contentType = info.ContentType
+	}
+
+	// Headers are only set once we know we're answering from the archive
+	header := c.Writer.Header()
+	setHeaders := func() {
+		header.Set("Accept-Ranges", "bytes")
+		if info.ETag != "" {
+			header.Set("ETag", info.ETag)
+		}
+		if !info.LastModified.IsZero() {
+			header.Set("Last-Modified", info.LastModified.UTC().Format(http.TimeFormat))
+		}
+	}
+	unsatisfiable := func() {
+		setHeaders()
+		header.Set("Content-Range", fmt.Sprintf("bytes */%d", info.Size))
+		c.JSON(http.StatusRequestedRangeNotSatisfiable, gin.H{"status": "error", "message": "Requested range not satisfiable"})
+	}
+
+	if info.ETag != "" && etagMatches(c.GetHeader("If-None-Match"), info.ETag) {
+		setHeaders()
+		c.Status(http.StatusNotModified)
+		return true, nil
+	}
+
+	// A stale If-Range means the client's partial copy is outdated, so it
+	// gets the whole recording instead
+	var rng *storage.ByteRange
+	if ifRange := c.GetHeader("If-Range"); ifRange == "" || ifRange == info.ETag {
+		rng, err = parseRange(c.GetHeader("Range"), info.Size)
+		if errors.Is(err, errUnsatisfiableRange) {
+			unsatisfiable()
+			return true, nil
+		}
+		if err != nil {
+			// Malformed or multi-part ranges are ignored, as RFC 9110 allows
+			rng = nil
+		}
+	}
+
+	object, err := store.Get(ctx, key, rng)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			return false, nil
+		case errors.Is(err, storage.ErrInvalidRange):
+			unsatisfiable()
+			return true, nil
+		}
+		return false, err
+	}
+	defer object.Body.Close()
+
+	setHeaders()
+	status, length := http.StatusOK, object.Size
+	if object.Range != nil {
+		status, length = http.StatusPartialContent, object.Range.End-object.Range.Start+1
+		header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", object.Range.Start, object.Range.End, object.Size))
+	}
+
+	c.DataFromReader(status, length, contentType, object.Body, nil)
+	return true, nil
+}
+
+// parseRange parses a single-range Range header against an object of the
+// given size. It returns nil for an empty header.
+func parseRange(header string, size int64) (*storage.ByteRange, error) {
+	if header == "" {
+		return nil, nil
+	}
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return nil, fmt.Errorf("unsupported range %q", header)
+	}
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid range %q", header)
+	}
+
+	// "bytes=-N" is the last N bytes
+	if first == "" {
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid range %q", header)
+		}
+		if n == 0 || size == 0 {
+			return nil, errUnsatisfiableRange
+		}
+		return &storage.ByteRange{Start: max(size-n, 0), End: size - 1}, nil
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return nil, fmt.Errorf("invalid range %q", header)
+	}
+	end := size - 1
+	if last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+			return nil, fmt.Errorf("invalid range %q", header)
+		}
+		end = min(end, size-1)
+	}
+	if start >= size {
+		return nil, errUnsatisfiableRange
+	}
+	return &storage.ByteRange{Start: start, End: end}, nil
+}
+
+// etagMatches reports whether an If-None-Match header lists etag.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// logArchiveFallback notes a recording served by PortaOne although the
+// archive was expected to have it.
+func logArchiveFallback(iXDR int64, key string, err error) {
+	if err != nil {
+		slog.Error("Failed to read archived recording, falling back to PortaOne", "i_xdr", iXDR, "key", key, "error", err)
+		return
+	}
+	slog.Warn("Archived recording missing from storage, falling back to PortaOne", "i_xdr", iXDR, "key", key)
+}
+
+// playbackURL builds the link to PlaySignedRecording. The playback route sits
+// next to the one issuing the link: .../recording/:i_xdr/url and
+// .../recording/:i_xdr/play.
+func playbackURL(c *gin.Context, config common.AppConfig, claims utils.PlaybackClaims, signature string) string {
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(claims.Expires, 10))
+	if claims.ICustomer != 0 {
+		query.Set("i_customer", strconv.Itoa(claims.ICustomer))
+	}
+	if claims.Instance != "" {
+		query.Set("instance", claims.Instance)
+	}
+	query.Set("signature", signature)
+
+	link := publicBaseURL(c, config)
+	link.Path = path.Join(link.Path, path.Dir(c.Request.URL.Path), "play")
+	link.RawQuery = query.Encode()
+	return link.String()
+}
+
+// publicBaseURL is where links handed out by the service point: the
+// configured app.public_base_url or, without one, the host of the request.
+// X-Forwarded-* headers are not trusted, as any client can set them; a service
+// behind a proxy should have public_base_url set.
+func publicBaseURL(c *gin.Context, config common.AppConfig) *url.URL {
+	if config.App.PublicBaseURL != "" {
+		if base, err := url.Parse(config.App.PublicBaseURL); err == nil {
+			return base
+		}
+	}
+
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	return &url.URL{Scheme: scheme, Host: c.Request.Host}
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Rafin000/call-recording-service-v2/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+type RecordingRetryHandler struct {
+	retryRepo domain.RecordingRetryRepository
+}
+
+func NewRecordingRetryHandler(retryRepo domain.RecordingRetryRepository) *RecordingRetryHandler {
+	return &RecordingRetryHandler{
+		retryRepo: retryRepo,
+	}
+}
+
+// GetRecordingRetries lists the retry queue, optionally filtered by ?state=
+// (pending or dead).
+func (h *RecordingRetryHandler) GetRecordingRetries(c *gin.Context) {
+	state := c.Query("state")
+	if state != "" && state != domain.RecordingRetryPending && state != domain.RecordingRetryDead {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid state"})
+		return
+	}
+
+	currentPage, err := strconv.Atoi(c.DefaultQuery("current_page", "1"))
+	if err != nil || currentPage < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid current_page value"})
+		return
+	}
+
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", "50"))
+	if err != nil || pageSize < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid page_size value"})
+		return
+	}
+	pageSize = min(pageSize, maxPageSize)
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	retries, total, err := h.retryRepo.ListRecordingRetries(ctx, state, currentPage, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to list recording retries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":       "success",
+		"retries":      retries,
+		"total":        total,
+		"current_page": currentPage,
+		"page_size":    pageSize,
+	})
+}
+
+// RequeueRecordingRetry gives a queued recording, typically a dead one, a
+// fresh set of attempts starting with the next retry pass.
+func (h *RecordingRetryHandler) RequeueRecordingRetry(c *gin.Context) {
+	iXDR, err := strconv.ParseInt(c.Param("i_xdr"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid i_xdr"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	found, err := h.retryRepo.RequeueRecordingRetry(ctx, iXDR)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to requeue recording"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"status": "error", "message": "Recording is not in the retry queue"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Recording requeued"})
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Rafin000/call-recording-service-v2/internal/infra/storage"
+)
+
+// errInvalid stands for any error other than errUnsatisfiableRange.
+var errInvalid = errors.New("invalid range")
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		header  string
+		size    int64
+		want    *storage.ByteRange
+		wantErr error
+	}{
+		{header: "", size: 100},
+		{header: "bytes=0-", size: 100, want: &storage.ByteRange{Start: 0, End: 99}},
+		{header: "bytes=10-19", size: 100, want: &storage.ByteRange{Start: 10, End: 19}},
+		{header: "bytes= 10-19", size: 100, want: &storage.ByteRange{Start: 10, End: 19}},
+		{header: "bytes=90-200", size: 100, want: &storage.ByteRange{Start: 90, End: 99}},
+		{header: "bytes=-10", size: 100, want: &storage.ByteRange{Start: 90, End: 99}},
+		{header: "bytes=-500", size: 100, want: &storage.ByteRange{Start: 0, End: 99}},
+		{header: "bytes=100-", size: 100, wantErr: errUnsatisfiableRange},
+		{header: "bytes=-0", size: 100, wantErr: errUnsatisfiableRange},
+		{header: "bytes=-10", size: 0, wantErr: errUnsatisfiableRange},
+		{header: "bytes=0-", size: 0, wantErr: errUnsatisfiableRange},
+		{header: "bytes=20-10", size: 100, wantErr: errInvalid},
+		{header: "bytes=0-10,20-30", size: 100, wantErr: errInvalid},
+		{header: "bytes=a-10", size: 100, wantErr: errInvalid},
+		{header: "bytes=10", size: 100, wantErr: errInvalid},
+		{header: "items=0-10", size: 100, wantErr: errInvalid},
+	}
+
+	for _, tt := range tests {
+		got, err := parseRange(tt.header, tt.size)
+		switch {
+		case tt.wantErr == errInvalid:
+			if err == nil || errors.Is(err, errUnsatisfiableRange) {
+				t.Errorf("parseRange(%q, %d) error = %v, want invalid range", tt.header, tt.size, err)
+			}
+		case tt.wantErr != nil:
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("parseRange(%q, %d) error = %v, want %v", tt.header, tt.size, err, tt.wantErr)
+			}
+		case err != nil:
+			t.Errorf("parseRange(%q, %d) error = %v", tt.header, tt.size, err)
+		case (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want:
+			t.Errorf("parseRange(%q, %d) = %+v, want %+v", tt.header, tt.size, got, tt.want)
+		}
+	}
+}
@@ -117,10 +117,11 @@ func (h *UserHandler) Login(c *gin.Context) {
 	}
 
 	payloads := map[string]interface{}{
-		"email":      user.Email,
-		"role":       user.Role,
-		"name":       user.Name,
-		"i_customer": user.ICustomer,
+		"email":             user.Email,
+		"role":              user.Role,
+		"name":              user.Name,
+		"i_customer":        user.ICustomer,
+		"portaone_instance": user.PortaOneInstance,
 	}
 
 	accessToken, err := utils.GenerateAccessToken(payloads, h.config)
@@ -156,10 +157,11 @@ func (h *UserHandler) RefreshToken(c *gin.Context) {
 		return
 	}
 	payloads := map[string]interface{}{
-		"email":      user.Email,
-		"role":       user.Role,
-		"name":       user.Name,
-		"i_customer": user.ICustomer,
+		"email":             user.Email,
+		"role":              user.Role,
+		"name":              user.Name,
+		"i_customer":        user.ICustomer,
+		"portaone_instance": user.PortaOneInstance,
 	}
 
 	accessToken, err := utils.GenerateAccessToken(payloads, h.config)
@@ -233,6 +235,13 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 	if updateData.IsActive != nil {
 		updateFields["is_active"] = *updateData.IsActive
 	}
+	if updateData.PortaOneInstance != nil {
+		if _, ok := h.config.PortaOne.Instance(*updateData.PortaOneInstance); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Unknown PortaOne instance."})
+			return
+		}
+		updateFields["portaone_instance"] = *updateData.PortaOneInstance
+	}
 
 	// Include the updated timestamp
 	updateFields["updated_at"] = time.Now()
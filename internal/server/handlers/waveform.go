@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Rafin000/call-recording-service-v2/internal/domain"
+	"github.com/Rafin000/call-recording-service-v2/internal/infra/portaone"
+	"github.com/Rafin000/call-recording-service-v2/internal/infra/storage"
+	"github.com/Rafin000/call-recording-service-v2/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// waveformPoints is how many peaks a waveform is reduced to, enough for a
+// player spanning a wide screen.
+const waveformPoints = 2000
+
+// GetRecordingWaveform returns downsampled peaks of a recording for the web
+// player to draw without downloading it. The peaks of an archived recording
+// are computed once and stored next to it; a recording not archived yet is
+// read from PortaOne every time.
+func (h *XDRHandler) GetRecordingWaveform(c *gin.Context) {
+	iXdr, err := strconv.ParseInt(c.Param("i_xdr"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid i_xdr format"})
+		return
+	}
+
+	xdr, ok := h.authorizeXDR(c, iXdr)
+	if !ok {
+		return
+	}
+
+	// Like the recording itself, this is bounded by the client going away
+	ctx := c.Request.Context()
+
+	var waveform *utils.Waveform
+	if xdr.Archive != nil {
+		waveform, err = h.archivedWaveform(ctx, iXdr, xdr.Archive)
+		if errors.Is(err, storage.ErrNotFound) {
+			logArchiveFallback(iXdr, xdr.Archive.S3Key, nil)
+			waveform, err = nil, nil
+		}
+	}
+	if waveform == nil && err == nil {
+		waveform, err = h.portaOneWaveform(ctx, iXdr, xdr.Instance)
+	}
+
+	if err != nil {
+		var portaOneErr *portaOneRecordingError
+		switch {
+		case errors.Is(err, utils.ErrNotWAV) || errors.Is(err, utils.ErrUnsupportedCodec) || errors.Is(err, utils.ErrNoSamples):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"status": "error", "message": fmt.Sprintf("No waveform for this recording: %v", err)})
+		case errors.As(err, &portaOneErr):
+			c.JSON(portaOneErrorStatus(portaOneErr.err), gin.H{"status": "error", "message": fmt.Sprintf("Failed to get call recording: %v", portaOneErr.err)})
+		default:
+			slog.Error("Failed to compute recording waveform", "i_xdr", iXdr, "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Error computing waveform"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "waveform": waveform})
+}
+
+// archivedWaveform returns the peaks stored next to an archived recording,
+// computing and storing them if they are missing or older than the recording.
+// It returns storage.ErrNotFound if the recording itself is missing.
+func (h *XDRHandler) archivedWaveform(ctx context.Context, iXdr int64, archive *domain.XDRArchive) (*utils.Waveform, error) {
+	key := waveformKey(archive.S3Key)
+
+	if waveform, err := h.storedWaveform(ctx, key, archive.UploadedAt); err != nil {
+		slog.Error("Failed to read stored waveform, computing it again", "i_xdr", iXdr, "key", key, "error", err)
+	} else if waveform != nil {
+		return waveform, nil
+	}
+
+	recording, err := h.store.Get(ctx, archive.S3Key, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer recording.Body.Close()
+
+	waveform, err := utils.ComputeWaveform(recording.Body, recording.Size, waveformPoints)
+	if err != nil {
+		return nil, err
+	}
+
+	// Failing to store the peaks only costs computing them again next time
+	data, err := json.Marshal(waveform)
+	if err == nil {
+		_, err = h.store.Put(ctx, key, bytes.NewReader(data), storage.PutOptions{ContentType: "application/json"})
+	}
+	if err != nil {
+		slog.Error("Failed to store waveform", "i_xdr", iXdr, "key", key, "error", err)
+	}
+	return waveform, nil
+}
+
+// storedWaveform reads the peaks stored at key, or returns nil if there are
+// none computed since the recording was uploaded.
+func (h *XDRHandler) storedWaveform(ctx context.Context, key string, uploadedAt time.Time) (*utils.Waveform, error) {
+	object, err := h.store.Get(ctx, key, nil)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer object.Body.Close()
+
+	// Stores may keep modification times to the second only
+	if object.LastModified.Before(uploadedAt.Truncate(time.Second)) {
+		return nil, nil
+	}
+
+	var waveform utils.Waveform
+	if err := json.NewDecoder(object.Body).Decode(&waveform); err != nil {
+		return nil, err
+	}
+	return &waveform, nil
+}
+
+// portaOneRecordingError is a failure to fetch a recording from PortaOne, as
+// opposed to one reading it.
+type portaOneRecordingError struct{ err error }
+
+func (e *portaOneRecordingError) Error() string { return e.err.Error() }
+
+// portaOneWaveform computes the peaks of a recording streamed from the named
+// PortaOne instance.
+func (h *XDRHandler) portaOneWaveform(ctx context.Context, iXdr int64, instance string) (*utils.Waveform, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Minute)
+	defer cancel()
+
+	portaoneClient, err := h.portaone.Client(instance)
+	if err != nil {
+		return nil, err
+	}
+
+	recording, err := portaoneClient.GetCallRecording(ctx, portaone.GetCallRecordingRequest{IXDR: iXdr})
+	if err != nil {
+		return nil, &portaOneRecordingError{err: err}
+	}
+	defer recording.Body.Close()
+
+	return utils.ComputeWaveform(recording.Body, recording.ContentLength, waveformPoints)
+}
+
+// waveformKey is where the peaks of the recording at key are stored:
+// ".../recording_<i_xdr>.wav" has its peaks at ".../recording_<i_xdr>.waveform.json".
+func waveformKey(key string) string {
+	return strings.TrimSuffix(key, path.Ext(key)) + ".waveform.json"
+}
@@ -1,41 +1,46 @@
 package handlers
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log/slog"
 	"net/http"
-	"net/url"
 	"strconv"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/Rafin000/call-recording-service-v2/internal/common"
 	"github.com/Rafin000/call-recording-service-v2/internal/domain"
 	"github.com/Rafin000/call-recording-service-v2/internal/infra/portaone"
+	"github.com/Rafin000/call-recording-service-v2/internal/infra/storage"
 	"github.com/gin-gonic/gin"
 )
 
 type XDRHandler struct {
-	xdrRepo        domain.XDRRepository
-	portaoneClient portaone.PortaOneClient
+	xdrRepo  domain.XDRRepository
+	portaone portaone.Registry
+	store    storage.RecordingStore
+	config   common.AppConfig
+	misses   *lookupMisses
 }
 
-func NewXDRHandler(xdrRepo domain.XDRRepository, portaoneClient portaone.PortaOneClient) *XDRHandler {
+func NewXDRHandler(xdrRepo domain.XDRRepository, portaoneRegistry portaone.Registry, store storage.RecordingStore, config common.AppConfig) *XDRHandler {
 	return &XDRHandler{
-		xdrRepo:        xdrRepo,
-		portaoneClient: portaoneClient,
+		xdrRepo:  xdrRepo,
+		portaone: portaoneRegistry,
+		store:    store,
+		config:   config,
+		misses:   newLookupMisses(),
 	}
 }
 
 func (h *XDRHandler) GetXDR(c *gin.Context) {
 	// Get i_customer from the Gin context
-	iCustomer, exists := c.Get("i_customer")
-	if !exists {
-		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "i_customer is required"})
+	iCustomer, err := customerFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
 		return
 	}
 
@@ -44,196 +49,148 @@ func (h *XDRHandler) GetXDR(c *gin.Context) {
 
 	slog.Debug("Starting GetXDR request")
 
-	// First POST request - Login to PortaOne
-	sessionID, err := h.portaoneClient.GetSessionID(ctx)
+	portaoneClient, err := h.portaOneClientFor(c, iCustomer)
 	if err != nil {
-		slog.Debug("Failed to get session ID from PortaOne", "error", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to sign in to PortaOne"})
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": err.Error()})
 		return
 	}
-	slog.Debug("Session ID retrieved", "session_id", sessionID)
-
-	xdrURL := "https://pbwebsrv.intercloud.com.bd/rest/Customer/get_customer_xdrs"
 
 	// Calculate date range exactly as in Python version
-	today := time.Now().UTC().Add(6 * time.Hour)
+	today := time.Now().In(common.DefaultLocation)
 	tomorrow := today.Add(24 * time.Hour)
 
-	// Format dates to match Python exactly
-	fromDate := today.Format("2006-01-02") + " 00:00:00"
-	toDate := tomorrow.Format("2006-01-02") + " 23:59:59"
-
-	// Create auth_info JSON
-	authInfo := map[string]string{
-		"session_id": sessionID,
-	}
-	authInfoJSON, err := json.Marshal(authInfo)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to marshal auth_info"})
-		return
+	xdrRequest := portaone.GetCustomerXDRsRequest{
+		ICustomer:     iCustomer,
+		FromDate:      today.Format("2006-01-02") + " 00:00:00",
+		ToDate:        tomorrow.Format("2006-01-02") + " 23:59:59",
+		BillingModel:  1,
+		CallRecording: 1,
 	}
 
-	// Create params JSON with integer i_customer
-	params := map[string]interface{}{
-		"billing_model":  1,
-		"call_recording": 1,
-		"from_date":      fromDate,
-		"i_customer":     iCustomer, // Now passing as integer
-		"to_date":        toDate,
-	}
-	paramsJSON, err := json.Marshal(params)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to marshal params"})
-		return
-	}
+	// A single page when the caller asks for one
+	if c.Query("page_size") != "" {
+		page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+		if err != nil || page < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid page number"})
+			return
+		}
+		pageSize, err := strconv.Atoi(c.Query("page_size"))
+		if err != nil || pageSize < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid page size"})
+			return
+		}
+		pageSize = min(pageSize, maxPageSize)
 
-	// Create form values and encode them
-	formValues := url.Values{}
-	formValues.Set("auth_info", string(authInfoJSON))
-	formValues.Set("params", string(paramsJSON))
-	formData := formValues.Encode()
+		xdrRequest.Limit = pageSize
+		xdrRequest.Offset = (page - 1) * pageSize
 
-	slog.Debug("XDR request prepared",
-		"auth_info", string(authInfoJSON),
-		"params", string(paramsJSON))
+		xdrResponse, err := portaoneClient.GetCustomerXDRs(ctx, xdrRequest)
+		if err != nil {
+			c.JSON(portaOneErrorStatus(err), gin.H{"status": "error", "message": fmt.Sprintf("Failed to get XDRs: %v", err)})
+			return
+		}
 
-	// Create request
-	req, err := http.NewRequestWithContext(ctx, "POST", xdrURL, strings.NewReader(formData))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to create HTTP request"})
+		c.JSON(http.StatusOK, gin.H{
+			"xdr_list":  xdrResponse.XDRList,
+			"page":      page,
+			"page_size": pageSize,
+		})
 		return
 	}
 
-	// Set headers
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-
-	// Send the request
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": fmt.Sprintf("Request failed: %v", err)})
-		return
+	// Otherwise fetch the whole day page by page. The first page is held back
+	// until a second one arrives, so a day that fits in one page, or a failure
+	// on the first page, gets an ordinary reply with a status to match. Longer
+	// days are streamed so they never have to be held in memory; their status
+	// is committed with the first rows, so a failure on a later page is
+	// reported by "complete": false and an "error" field after the rows sent.
+	var first []portaone.XDR
+	started := false
+	count := 0
+	encoder := json.NewEncoder(c.Writer)
+	write := func(page []portaone.XDR) error {
+		for _, xdr := range page {
+			if count > 0 {
+				_, _ = c.Writer.WriteString(",")
+			}
+			count++
+			if err := encoder.Encode(xdr); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
-	defer resp.Body.Close()
 
-	// Check for successful response
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		slog.Debug("Error response from server", "status", resp.Status, "body", string(body))
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": fmt.Sprintf("Failed to get XDRs: %s", resp.Status)})
-		return
-	}
+	err = portaoneClient.ForEachCustomerXDRPage(ctx, xdrRequest, func(page []portaone.XDR) error {
+		if !started && first == nil {
+			first = page
+			return nil
+		}
+		if !started {
+			started = true
+			c.Header("Content-Type", "application/json; charset=utf-8")
+			c.Status(http.StatusOK)
+			_, _ = c.Writer.WriteString(`{"xdr_list":[`)
+			if err := write(first); err != nil {
+				return err
+			}
+		}
+		return write(page)
+	})
 
-	// Read and parse response body
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to read response body"})
+	if !started {
+		if err != nil {
+			c.JSON(portaOneErrorStatus(err), gin.H{"status": "error", "message": fmt.Sprintf("Failed to get XDRs: %v", err)})
+			return
+		}
+		if first == nil {
+			first = []portaone.XDR{}
+		}
+		c.JSON(http.StatusOK, gin.H{"xdr_list": first, "complete": true, "count": len(first)})
 		return
 	}
-	slog.Debug("Response received", "body", string(body))
 
-	var xdrResponse map[string]interface{}
-	err = json.Unmarshal(body, &xdrResponse)
+	trailer := gin.H{"complete": err == nil, "count": count}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to parse XDR response"})
-		return
+		slog.Error("XDR stream interrupted", "i_customer", iCustomer, "sent", count, "error", err)
+		trailer["error"] = fmt.Sprintf("Failed to get XDRs: %v", err)
 	}
-
-	c.JSON(http.StatusOK, xdrResponse)
+	trailerJSON, _ := json.Marshal(trailer)
+	// Splice the trailer fields into the object: `],"complete":...}`
+	_, _ = c.Writer.WriteString("]," + string(trailerJSON[1:]))
 }
 
+// GetCallRecording streams a recording from the archive, supporting range
+// requests so players can seek. Recordings that haven't been archived yet are
+// proxied from PortaOne.
 func (h *XDRHandler) GetCallRecording(c *gin.Context) {
-	ctx, cancel := context.WithTimeout(c.Request.Context(), 1*time.Minute)
-	defer cancel()
-
-	// Get session ID from PortaOne client
-	sessionID, err := h.portaoneClient.GetSessionID(ctx)
-	if err != nil || sessionID == "" {
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to sign in to PortaOne"})
-		return
-	}
-
 	// Get i_xdr from URL params
-	iXdr := c.Param("i_xdr")
-	if iXdr == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "i_xdr is required"})
-		return
-	}
-
-	recordingURL := "https://pbwebsrv.intercloud.com.bd/rest/CDR/get_call_recording"
-	recordingData := map[string]interface{}{
-		"auth_info": map[string]string{"session_id": sessionID},
-		"params": map[string]string{
-			"i_xdr": iXdr,
-		},
-	}
-
-	// Prepare the data as JSON
-	recordingDataBytes, err := json.Marshal(recordingData)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to marshal request data"})
-		return
-	}
-
-	// Make the POST request
-	resp, err := http.Post(recordingURL, "application/json", bytes.NewBuffer(recordingDataBytes))
+	iXdr, err := strconv.ParseInt(c.Param("i_xdr"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": err.Error()})
-		return
-	}
-	defer resp.Body.Close()
-
-	// Check for non-200 status codes
-	if resp.StatusCode != http.StatusOK {
-		c.JSON(resp.StatusCode, gin.H{"status": "error", "message": "Failed to get call recording", "response_code": resp.StatusCode})
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid i_xdr format"})
 		return
 	}
 
-	// Parse the response JSON
-	var recordingResponse map[string]interface{}
-	err = json.NewDecoder(resp.Body).Decode(&recordingResponse)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to parse call recording response"})
+	xdr, ok := h.authorizeXDR(c, iXdr)
+	if !ok {
 		return
 	}
 
-	// Send the response back to the client
-	c.JSON(http.StatusOK, recordingResponse)
+	h.streamRecording(c, iXdr, xdr.Instance)
 }
 
 // getXDRDumps handles fetching XDR dumps within a given date range
 func (h *XDRHandler) GetXDRDumps(c *gin.Context) {
 	// Get current time in UTC+6
-	currentTime := time.Now().UTC().Add(6 * time.Hour)
+	currentTime := time.Now().In(common.DefaultLocation)
 	currentTimeStr := currentTime.Format("2006-01-02 15:04:05")
 	slog.Debug("Received GET request for XDRDumps", "time", currentTimeStr)
 
-	// Get i_customer from context and handle type assertion
-	iCustomerAny, exists := c.Get("i_customer")
-	if !exists {
-		slog.Debug("Error: i_customer is required", "time", currentTimeStr)
-		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "i_customer is required"})
-		return
-	}
-
-	// Convert iCustomer to int
-	var iCustomer int
-	switch v := iCustomerAny.(type) {
-	case int:
-		iCustomer = v
-	case float64:
-		iCustomer = int(v)
-	case string:
-		var err error
-		iCustomer, err = strconv.Atoi(v)
-		if err != nil {
-			slog.Debug("Error: invalid i_customer format", "error", err)
-			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid i_customer format"})
-			return
-		}
-	default:
-		slog.Debug("Error: invalid i_customer type", "type", fmt.Sprintf("%T", iCustomerAny))
-		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid i_customer type"})
+	// Get i_customer from context
+	iCustomer, err := customerFromContext(c)
+	if err != nil {
+		slog.Debug("Error: invalid i_customer", "error", err, "time", currentTimeStr)
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
 		return
 	}
 
@@ -251,48 +208,12 @@ func (h *XDRHandler) GetXDRDumps(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid page size"})
 		return
 	}
+	pageSize = min(pageSize, maxPageSize)
 
-	fromDateStr := c.Query("from_date")
-	toDateStr := c.Query("to_date")
-
-	slog.Debug("Parameters received",
-		"page", page,
-		"pageSize", pageSize,
-		"fromDate", fromDateStr,
-		"toDate", toDateStr)
-
-	// Define default dates
-	defaultFromDate := currentTime.AddDate(0, 0, -30)
-	defaultToDate := currentTime.AddDate(0, 0, 1)
-
-	// Parse dates
-	fromDate, err := h.parseDateTime(fromDateStr, true, defaultFromDate)
+	fromDate, toDate, err := historicalRange(c, currentTime)
 	if err != nil {
-		slog.Debug("Error parsing from_date", "error", err)
-		c.JSON(http.StatusBadRequest, gin.H{
-			"status":  "error",
-			"message": "Invalid date format. Use YYYY-MM-DD or YYYY-MM-DD HH:MM[:SS].",
-		})
-		return
-	}
-
-	toDate, err := h.parseDateTime(toDateStr, false, defaultToDate)
-	if err != nil {
-		slog.Debug("Error parsing to_date", "error", err)
-		c.JSON(http.StatusBadRequest, gin.H{
-			"status":  "error",
-			"message": "Invalid date format. Use YYYY-MM-DD or YYYY-MM-DD HH:MM[:SS].",
-		})
-		return
-	}
-
-	// Check if fromDate is after toDate
-	if fromDate.After(toDate) {
-		slog.Debug("Error: from_date cannot be after to_date")
-		c.JSON(http.StatusBadRequest, gin.H{
-			"status":  "error",
-			"message": "from_date cannot be after to_date",
-		})
+		slog.Debug("Error parsing date range", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
 		return
 	}
 
@@ -315,8 +236,27 @@ func (h *XDRHandler) GetXDRDumps(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// historicalRange parses the from_date and to_date of a historical query. They
+// default to the 30 days before now and the day after.
+func historicalRange(c *gin.Context, now time.Time) (time.Time, time.Time, error) {
+	fromDate, err := parseDateTime(c.Query("from_date"), true, now.AddDate(0, 0, -30))
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("Invalid date format. Use YYYY-MM-DD or YYYY-MM-DD HH:MM[:SS].")
+	}
+
+	toDate, err := parseDateTime(c.Query("to_date"), false, now.AddDate(0, 0, 1))
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("Invalid date format. Use YYYY-MM-DD or YYYY-MM-DD HH:MM[:SS].")
+	}
+
+	if fromDate.After(toDate) {
+		return time.Time{}, time.Time{}, errors.New("from_date cannot be after to_date")
+	}
+	return fromDate, toDate, nil
+}
+
 // parseDateTime attempts to parse a datetime string using multiple formats
-func (h *XDRHandler) parseDateTime(dateStr string, isStartDate bool, defaultDate time.Time) (time.Time, error) {
+func parseDateTime(dateStr string, isStartDate bool, defaultDate time.Time) (time.Time, error) {
 	if dateStr == "" {
 		return defaultDate, nil
 	}
@@ -366,7 +306,9 @@ func (h *XDRHandler) parseDateTime(dateStr string, isStartDate bool, defaultDate
 	return time.Time{}, fmt.Errorf("time data '%s' does not match any supported format: %v", dateStr, lastErr)
 }
 
-// getXDRByI_XDR handles fetching XDR data for a specific i_xdr
+// getXDRByI_XDR handles fetching XDR data for a specific i_xdr. Once the
+// recording is archived, archive.audio describes it and flags a duration at
+// odds with the call.
 func (h *XDRHandler) GetXDRByI_XDR(c *gin.Context) {
 	iXdrStr := c.Param("i_xdr")
 
@@ -377,11 +319,22 @@ func (h *XDRHandler) GetXDRByI_XDR(c *gin.Context) {
 		return
 	}
 
+	// Only backed up XDRs are served here, so there is nothing to look up on
+	// PortaOne
+	xdr, ok := h.storedXDR(c, int64(iXdr))
+	if !ok {
+		return
+	}
+	if xdr == nil {
+		c.JSON(http.StatusNotFound, gin.H{"status": "error", "message": "XDR not found"})
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(c.Request.Context(), common.Timeouts.User.Write)
 	defer cancel()
 
 	// Fetch the XDR data using the repository method
-	xdrData, err := h.xdrRepo.GetXDRByIXDR(ctx, iXdr)
+	xdrData, err := h.xdrRepo.GetXDRByIXDR(ctx, xdr.Instance, iXdr)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Error fetching XDR data"})
 		return
@@ -398,3 +351,218 @@ func (h *XDRHandler) GetXDRByI_XDR(c *gin.Context) {
 		"xdr_data": xdrData,
 	})
 }
+
+// customerFromContext returns the caller's i_customer set by the auth middleware.
+func customerFromContext(c *gin.Context) (int, error) {
+	iCustomerAny, exists := c.Get("i_customer")
+	if !exists {
+		return 0, errors.New("i_customer is required")
+	}
+
+	switch v := iCustomerAny.(type) {
+	case int:
+		return v, nil
+	case float64:
+		return int(v), nil
+	case string:
+		iCustomer, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, errors.New("Invalid i_customer format")
+		}
+		return iCustomer, nil
+	default:
+		return 0, errors.New("Invalid i_customer type")
+	}
+}
+
+// mayAccessCustomer reports whether the caller may see the XDRs of iCustomer:
+// admins may see every customer's, everyone else only their own.
+func mayAccessCustomer(c *gin.Context, iCustomer int) bool {
+	if c.GetString("role") == "admin" {
+		return true
+	}
+	callerCustomer, err := customerFromContext(c)
+	return err == nil && callerCustomer == iCustomer
+}
+
+// authorizeXDR checks that the caller may access an XDR and answers the request
+// itself when not. Ownership comes from the backed up xdr_list record or, for
+// XDRs not backed up yet, from looking the XDR up among the caller's customer's
+// XDRs on PortaOne. That lookup covers a single day, ?date= (YYYY-MM-DD) or
+// today, and XDRs it doesn't find are remembered for a while. The XDR returned
+// carries at least its instance and i_customer, which is 0 only for an admin
+// asking about an XDR we don't have.
+func (h *XDRHandler) authorizeXDR(c *gin.Context, iXdr int64) (*domain.XDR, bool) {
+	xdr, ok := h.storedXDR(c, iXdr)
+	if !ok || xdr != nil {
+		return xdr, ok
+	}
+
+	portaoneClient, err := h.callerPortaOne(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+		return nil, false
+	}
+	instance := portaoneClient.Name()
+
+	if c.GetString("role") == "admin" {
+		return &domain.XDR{Instance: instance, IXDR: iXdr}, true
+	}
+
+	iCustomer, err := customerFromContext(c)
+	if err != nil {
+		denyXDR(c, iXdr, 0)
+		return nil, false
+	}
+
+	day := time.Now().In(common.DefaultLocation)
+	if date := c.Query("date"); date != "" {
+		day, err = time.ParseInLocation("2006-01-02", date, common.DefaultLocation)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid date, expected YYYY-MM-DD"})
+			return nil, false
+		}
+	}
+
+	missKey := fmt.Sprintf("%s/%d/%d/%s", instance, iCustomer, iXdr, day.Format("2006-01-02"))
+	if h.misses.contains(missKey) {
+		denyXDR(c, iXdr, 0)
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+
+	found, err := portaoneClient.GetCustomerXDR(ctx, iCustomer, iXdr, day)
+	if err != nil {
+		slog.Error("Failed to look up XDR owner on PortaOne", "i_xdr", iXdr, "i_customer", iCustomer, "error", err)
+		c.JSON(portaOneErrorStatus(err), gin.H{"status": "error", "message": fmt.Sprintf("Failed to look up XDR: %v", err)})
+		return nil, false
+	}
+	if found == nil {
+		h.misses.add(missKey)
+		denyXDR(c, iXdr, 0)
+		return nil, false
+	}
+	return &domain.XDR{Instance: instance, IXDR: iXdr, ICustomer: iCustomer}, true
+}
+
+// storedXDR looks an XDR up in xdr_list on the caller's PortaOne instance (see
+// callerPortaOne) and checks the caller may access it, answering the request
+// itself when not. It returns nil, true if the XDR has not been backed up.
+func (h *XDRHandler) storedXDR(c *gin.Context, iXdr int64) (*domain.XDR, bool) {
+	portaoneClient, err := h.callerPortaOne(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+		return nil, false
+	}
+	instance := portaoneClient.Name()
+
+	xdr, err := h.xdrRepo.GetXDR(c.Request.Context(), instance, iXdr)
+	if err != nil {
+		slog.Error("Failed to look up XDR", "instance", instance, "i_xdr", iXdr, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Error fetching XDR data"})
+		return nil, false
+	}
+	if xdr != nil && !mayAccessCustomer(c, xdr.ICustomer) {
+		denyXDR(c, iXdr, xdr.ICustomer)
+		return nil, false
+	}
+	return xdr, true
+}
+
+// callerPortaOne resolves the PortaOne instance whose XDRs the caller asks
+// about: a customer's own instance, or for an admin the one named by
+// ?instance=, the default instance if none is.
+func (h *XDRHandler) callerPortaOne(c *gin.Context) (portaone.PortaOneClient, error) {
+	if c.GetString("role") == "admin" {
+		return h.portaone.Client(c.Query("instance"))
+	}
+	iCustomer, err := customerFromContext(c)
+	if err != nil {
+		return nil, err
+	}
+	return h.portaOneClientFor(c, iCustomer)
+}
+
+// denyXDR logs and rejects an attempt to access an XDR of another customer.
+// owner is 0 when the XDR is unknown to us.
+func denyXDR(c *gin.Context, iXdr int64, owner int) {
+	callerCustomer, _ := customerFromContext(c)
+	slog.Warn("Denied access to XDR",
+		"i_xdr", iXdr,
+		"owner_i_customer", owner,
+		"i_customer", callerCustomer,
+		"email", c.GetString("email"),
+		"path", c.FullPath())
+	c.JSON(http.StatusForbidden, gin.H{"status": "error", "message": "You do not have access to this XDR"})
+}
+
+// portaOneClientFor resolves the PortaOne instance serving the caller.
+// A zero iCustomer falls back to the default instance.
+func (h *XDRHandler) portaOneClientFor(c *gin.Context, iCustomer int) (portaone.PortaOneClient, error) {
+	return h.resolvePortaOne(c.GetString("portaone_instance"), iCustomer)
+}
+
+// resolvePortaOne resolves the PortaOne instance serving a customer, preferring
+// an explicit instance. A zero iCustomer falls back to the default instance.
+func (h *XDRHandler) resolvePortaOne(instance string, iCustomer int) (portaone.PortaOneClient, error) {
+	customer := ""
+	if iCustomer != 0 {
+		customer = strconv.Itoa(iCustomer)
+	}
+	return h.portaone.Resolve(instance, customer)
+}
+
+// portaOneErrorStatus maps a PortaOne client error to the status returned to our caller.
+// An unreachable PortaOne (open circuit, exhausted retries) is reported as 503.
+func portaOneErrorStatus(err error) int {
+	if portaone.IsUnavailable(err) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+const (
+	// lookupMissTTL is how long an XDR PortaOne didn't find is not looked up again.
+	lookupMissTTL = time.Minute
+	// maxLookupMisses bounds the XDRs remembered as not found.
+	maxLookupMisses = 10000
+)
+
+// lookupMisses remembers the XDR lookups on PortaOne that found nothing, so a
+// client retrying them doesn't page through a customer's XDRs every time.
+type lookupMisses struct {
+	mu      sync.Mutex
+	expires map[string]time.Time
+}
+
+func newLookupMisses() *lookupMisses {
+	return &lookupMisses{expires: make(map[string]time.Time)}
+}
+
+func (m *lookupMisses) contains(key string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	expires, ok := m.expires[key]
+	return ok && time.Now().Before(expires)
+}
+
+// add remembers a miss, sweeping expired misses once the map is full and
+// dropping the new one if that doesn't make room.
+func (m *lookupMisses) add(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if len(m.expires) >= maxLookupMisses {
+		for k, expires := range m.expires {
+			if !now.Before(expires) {
+				delete(m.expires, k)
+			}
+		}
+		if len(m.expires) >= maxLookupMisses {
+			return
+		}
+	}
+	m.expires[key] = now.Add(lookupMissTTL)
+}
@@ -44,6 +44,9 @@ func AdminTokenRequired(config common.AppConfig) gin.HandlerFunc {
 			if payload.ICustomer != nil {
 				c.Set("i_customer", *payload.ICustomer)
 			}
+			if payload.PortaOneInstance != "" {
+				c.Set("portaone_instance", payload.PortaOneInstance)
+			}
 		} else {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 			c.Abort()
@@ -101,6 +104,9 @@ func TokenRequired(config common.AppConfig) gin.HandlerFunc {
 
 			c.Set("i_customer", cleanedICustomer)
 		}
+		if payload.PortaOneInstance != "" {
+			c.Set("portaone_instance", payload.PortaOneInstance)
+		}
 		// Proceed with the next middleware/handler
 		c.Next()
 	}
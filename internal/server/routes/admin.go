@@ -0,0 +1,39 @@
+package routes
+
+import (
+	"github.com/Rafin000/call-recording-service-v2/internal/common"
+	"github.com/Rafin000/call-recording-service-v2/internal/cron"
+	"github.com/Rafin000/call-recording-service-v2/internal/domain"
+	"github.com/Rafin000/call-recording-service-v2/internal/server/handlers"
+	"github.com/Rafin000/call-recording-service-v2/internal/server/middlewares"
+	"github.com/gin-gonic/gin"
+)
+
+func registerAdminRoutes(rg *gin.RouterGroup, backupRunRepo domain.BackupRunRepository, retryRepo domain.RecordingRetryRepository, jobManager *cron.JobManager, config common.AppConfig) {
+	backfillHandler := handlers.NewBackfillHandler(jobManager)
+	backupRunHandler := handlers.NewBackupRunHandler(backupRunRepo)
+	retryHandler := handlers.NewRecordingRetryHandler(retryRepo)
+	jobHandler := handlers.NewJobHandler(jobManager)
+
+	// Routes that require Admin authentication
+	adminGroup := rg.Group("/")
+	adminGroup.Use(middlewares.AdminTokenRequired(config))
+	{
+		adminGroup.POST("/backfills", backfillHandler.StartBackfill)
+		adminGroup.GET("/backfills", backfillHandler.GetBackfills)
+		adminGroup.GET("/backfills/:id", backfillHandler.GetBackfill)
+		adminGroup.POST("/backfills/:id/cancel", backfillHandler.CancelBackfill)
+
+		adminGroup.GET("/backup_runs", backupRunHandler.GetBackupRuns)
+		adminGroup.GET("/backup_runs/:id", backupRunHandler.GetBackupRun)
+		adminGroup.GET("/backup_runs/:id/xdrs", backupRunHandler.GetBackupRunXDRs)
+
+		adminGroup.GET("/retries", retryHandler.GetRecordingRetries)
+		adminGroup.POST("/retries/:i_xdr/requeue", retryHandler.RequeueRecordingRetry)
+
+		adminGroup.GET("/jobs", jobHandler.GetJobs)
+		adminGroup.GET("/jobs/:name", jobHandler.GetJob)
+		adminGroup.POST("/jobs/:name/trigger", jobHandler.TriggerJob)
+		adminGroup.POST("/jobs/:name/cancel", jobHandler.CancelJob)
+	}
+}
@@ -2,15 +2,23 @@ package routes
 
 import (
 	"github.com/Rafin000/call-recording-service-v2/internal/common"
+	"github.com/Rafin000/call-recording-service-v2/internal/cron"
 	"github.com/Rafin000/call-recording-service-v2/internal/domain"
 	"github.com/Rafin000/call-recording-service-v2/internal/infra/portaone"
+	"github.com/Rafin000/call-recording-service-v2/internal/infra/storage"
+	"github.com/Rafin000/call-recording-service-v2/internal/tasks"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func InitRoutes(rg *gin.RouterGroup, mongoDB *mongo.Database, config *common.AppConfig, portaOneClient portaone.PortaOneClient) {
+func InitRoutes(rg *gin.RouterGroup, mongoDB *mongo.Database, config *common.AppConfig, portaoneRegistry portaone.Registry, store storage.RecordingStore, jobManager *cron.JobManager) {
 	userRepo := domain.NewUserRepository(mongoDB)
 	xdrRepo := domain.NewXDRRepository(mongoDB)
+	backupRunRepo := domain.NewBackupRunRepository(mongoDB)
+	retryRepo := domain.NewRecordingRetryRepository(mongoDB)
+	exportRepo := domain.NewRecordingExportRepository(mongoDB)
+
+	exporter := tasks.NewExporter(xdrRepo, exportRepo, store, config.Export)
 
 	registerAliveRoute(rg)
 
@@ -18,5 +26,8 @@ func InitRoutes(rg *gin.RouterGroup, mongoDB *mongo.Database, config *common.App
 	registerUserRoutes(userGroup, userRepo, *config)
 
 	xdrGroup := rg.Group("/xdrs")
-	registerXDRRoutes(xdrGroup, xdrRepo, portaOneClient, *config)
+	registerXDRRoutes(xdrGroup, xdrRepo, portaoneRegistry, store, exporter, *config)
+
+	adminGroup := rg.Group("/admin")
+	registerAdminRoutes(adminGroup, backupRunRepo, retryRepo, jobManager, *config)
 }
@@ -4,15 +4,16 @@ import (
 	"github.com/Rafin000/call-recording-service-v2/internal/common"
 	"github.com/Rafin000/call-recording-service-v2/internal/domain"
 	"github.com/Rafin000/call-recording-service-v2/internal/infra/portaone"
+	"github.com/Rafin000/call-recording-service-v2/internal/infra/storage"
 	"github.com/Rafin000/call-recording-service-v2/internal/server/handlers"
 	"github.com/Rafin000/call-recording-service-v2/internal/server/middlewares"
+	"github.com/Rafin000/call-recording-service-v2/internal/tasks"
 	"github.com/gin-gonic/gin"
 )
 
-// portaoneClient := portaone.NewPortaOneClient()
-
-func registerXDRRoutes(rg *gin.RouterGroup, xdrRepo domain.XDRRepository, portaoneClient portaone.PortaOneClient, config common.AppConfig) {
-	xdrHandler := handlers.NewXDRHandler(xdrRepo, portaoneClient)
+func registerXDRRoutes(rg *gin.RouterGroup, xdrRepo domain.XDRRepository, portaoneRegistry portaone.Registry, store storage.RecordingStore, exporter *tasks.Exporter, config common.AppConfig) {
+	xdrHandler := handlers.NewXDRHandler(xdrRepo, portaoneRegistry, store, config)
+	exportHandler := handlers.NewExportHandler(exporter, store, config)
 
 	// Routes that require normal user authentication
 	xdrGroup := rg.Group("/")
@@ -20,7 +21,15 @@ func registerXDRRoutes(rg *gin.RouterGroup, xdrRepo domain.XDRRepository, portao
 	{
 		xdrGroup.GET("/today", xdrHandler.GetXDR)
 		xdrGroup.GET("/recording/:i_xdr", xdrHandler.GetCallRecording)
+		xdrGroup.GET("/recording/:i_xdr/url", xdrHandler.GetRecordingURL)
+		xdrGroup.GET("/recording/:i_xdr/waveform", xdrHandler.GetRecordingWaveform)
 		xdrGroup.GET("/historical", xdrHandler.GetXDRDumps)
 		xdrGroup.GET("/historical/:i_xdr", xdrHandler.GetXDRByI_XDR)
+		xdrGroup.GET("/download", exportHandler.DownloadRecordings)
+		xdrGroup.GET("/exports/:id", exportHandler.GetExport)
 	}
+
+	// Signed playback and download links carry their own authorization
+	rg.GET("/recording/:i_xdr/play", xdrHandler.PlaySignedRecording)
+	rg.GET("/exports/:id/file", exportHandler.DownloadExport)
 }
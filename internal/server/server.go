@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"expvar"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -9,8 +10,10 @@ import (
 
 	"github.com/Rafin000/call-recording-service-v2/internal/common"
 	"github.com/Rafin000/call-recording-service-v2/internal/cron"
+	"github.com/Rafin000/call-recording-service-v2/internal/domain"
 	"github.com/Rafin000/call-recording-service-v2/internal/infra/portaone"
 	"github.com/Rafin000/call-recording-service-v2/internal/infra/redis"
+	"github.com/Rafin000/call-recording-service-v2/internal/infra/storage"
 	"github.com/Rafin000/call-recording-service-v2/internal/server/middlewares"
 	"github.com/Rafin000/call-recording-service-v2/internal/server/routes"
 	"github.com/gin-gonic/gin"
@@ -21,13 +24,14 @@ import (
 )
 
 type Server struct {
-	Router         *gin.Engine
-	httpServer     *http.Server
-	DB             *mongo.Database
-	Config         *common.AppConfig
-	Redis          *redis.RedisClient
-	PortaOneClient *portaone.PortaOneClient
-	JobManager     *cron.JobManager
+	Router     *gin.Engine
+	httpServer *http.Server
+	DB         *mongo.Database
+	Config     *common.AppConfig
+	Redis      *redis.RedisClient
+	PortaOne   portaone.Registry
+	Store      storage.RecordingStore
+	JobManager *cron.JobManager
 }
 
 func NewServer(ctx context.Context) (*Server, error) {
@@ -44,8 +48,14 @@ func NewServer(ctx context.Context) (*Server, error) {
 		return nil, err
 	}
 
-	// Setup PortaOne client
-	portaOneClient, err := portaone.NewPortaOneClient(cfg.PortaOne, redisClient)
+	// Setup PortaOne clients, one per configured instance
+	portaoneRegistry, err := portaone.NewRegistry(cfg.PortaOne, redisClient)
+	if err != nil {
+		return nil, err
+	}
+
+	// Setup the storage backend recordings are archived to
+	store, err := storage.NewRecordingStore(*cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -59,16 +69,17 @@ func NewServer(ctx context.Context) (*Server, error) {
 	router := setupRouter(cfg.App)
 
 	// Initialize JobManager
-	jobManager := cron.NewJobManager(ctx, mongoDB, portaOneClient, cfg.App)
+	jobManager := cron.NewJobManager(ctx, mongoDB, redisClient, portaoneRegistry, store, *cfg)
 	jobManager.RegisterJobs()
 
 	s := &Server{
-		Router:         router,
-		DB:             mongoDB,
-		Config:         cfg,
-		Redis:          &redisClient,
-		PortaOneClient: &portaOneClient,
-		JobManager:     jobManager,
+		Router:     router,
+		DB:         mongoDB,
+		Config:     cfg,
+		Redis:      &redisClient,
+		PortaOne:   portaoneRegistry,
+		Store:      store,
+		JobManager: jobManager,
 		httpServer: &http.Server{
 			Addr:    cfg.App.ServerAddress,
 			Handler: router,
@@ -104,9 +115,11 @@ func (s *Server) Start() error {
 // setupRoutes initializes all API routes for the server.
 func (s *Server) setupRoutes() {
 	s.Router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+	// Runtime metrics, including circuit breaker states, for admins only
+	s.Router.GET("/debug/vars", middlewares.AdminTokenRequired(*s.Config), gin.WrapH(expvar.Handler()))
 
 	apiGroup := s.Router.Group("/api/v1")
-	routes.InitRoutes(apiGroup, s.DB, s.Config, *s.PortaOneClient)
+	routes.InitRoutes(apiGroup, s.DB, s.Config, s.PortaOne, s.Store, s.JobManager)
 }
 
 // setupMiddlewares adds all necessary middlewares to the Gin router.
@@ -156,18 +169,28 @@ func setupMongoDB(ctx context.Context, mongoDBConfig common.MongoDBConfig) (*mon
 		return nil, fmt.Errorf("failed to ping MongoDB: %w", err)
 	}
 
-	return client.Database(mongoDBConfig.Database), nil
+	db := client.Database(mongoDBConfig.Database)
+
+	// Missing indexes make queries slow, not wrong, so they don't stop startup
+	if err := domain.EnsureIndexes(ctx, db); err != nil {
+		slog.Error("Failed to create MongoDB indexes", "error", err)
+	}
+
+	return db, nil
 }
 
-// Shutdown gracefully stops the server, closing the database connection and stopping the HTTP server.
-// For MongoDB
+// Shutdown gracefully stops the server, stopping the HTTP server and the jobs and closing the database connection.
+// Requests and jobs are given until ctx is done to finish before MongoDB is disconnected.
 func (s *Server) Shutdown(ctx context.Context) error {
+	httpErr := s.httpServer.Shutdown(ctx)
+	s.JobManager.Stop(ctx)
+
 	if err := s.DB.Client().Disconnect(ctx); err != nil {
 		slog.Error("failed to disconnect from MongoDB", "error", err)
 	}
 
-	if err := s.httpServer.Shutdown(ctx); err != nil {
-		return fmt.Errorf("server shutdown failed: %w", err)
+	if httpErr != nil {
+		return fmt.Errorf("server shutdown failed: %w", httpErr)
 	}
 
 	return nil
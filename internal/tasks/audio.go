@@ -0,0 +1,76 @@
+package tasks
+
+import (
+	"bytes"
+	"math"
+
+	"github.com/Rafin000/call-recording-service-v2/internal/domain"
+	"github.com/Rafin000/call-recording-service-v2/internal/utils"
+)
+
+const (
+	// A recording starts at answer and may be cut short or padded a little,
+	// so its duration is only flagged when it is off from the call by more
+	// than the larger of these.
+	durationTolerance         = 2.0
+	durationToleranceFraction = 0.05
+)
+
+// headerBuffer keeps the first bytes written to it and discards the rest, to
+// catch the header of a recording as it streams by.
+type headerBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *headerBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); room > 0 {
+		b.Buffer.Write(p[:min(room, len(p))])
+	}
+	return len(p), nil
+}
+
+// recordingAudio reads the audio metadata of a recording of the given size
+// from its header, and checks its duration against the XDR it belongs to,
+// which may be nil if unknown.
+func recordingAudio(header []byte, size int64, xdr *domain.XDR) (*domain.RecordingAudio, error) {
+	wav, err := utils.ReadWAVHeader(bytes.NewReader(header), size)
+	if err != nil {
+		return nil, err
+	}
+
+	audio := &domain.RecordingAudio{
+		Codec:         wav.Codec(),
+		SampleRate:    wav.SampleRate,
+		Channels:      wav.Channels,
+		BitsPerSample: wav.BitsPerSample,
+		Duration:      math.Round(wav.Duration().Seconds()*1000) / 1000,
+		DataSize:      wav.DataSize,
+	}
+	if xdr != nil {
+		audio.DurationMismatch = durationMismatch(audio.Duration, xdr)
+	}
+	return audio, nil
+}
+
+// durationMismatch lists what a recording's duration in seconds disagrees
+// with. charged_quantity is rounded up to the billing increment, so only a
+// recording running longer than what was billed is flagged against it.
+func durationMismatch(duration float64, xdr *domain.XDR) []string {
+	var mismatch []string
+
+	if xdr.UnixConnectTime > 0 && xdr.UnixDisconnectTime >= xdr.UnixConnectTime {
+		call := float64(xdr.UnixDisconnectTime - xdr.UnixConnectTime)
+		if math.Abs(duration-call) > max(durationTolerance, call*durationToleranceFraction) {
+			mismatch = append(mismatch, domain.AudioMismatchCallDuration)
+		}
+	}
+
+	if charged := float64(xdr.ChargedQuantity); charged > 0 {
+		if duration-charged > max(durationTolerance, charged*durationToleranceFraction) {
+			mismatch = append(mismatch, domain.AudioMismatchChargedQuantity)
+		}
+	}
+
+	return mismatch
+}
@@ -0,0 +1,391 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Rafin000/call-recording-service-v2/internal/common"
+	"github.com/Rafin000/call-recording-service-v2/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxBackfillDays bounds the range of a single backfill.
+const maxBackfillDays = 366
+
+// Backfill states. A backfill is interrupted when the process running it went
+// away before it finished.
+const (
+	BackfillRunning     = "running"
+	BackfillCompleted   = "completed"
+	BackfillCancelled   = "cancelled"
+	BackfillInterrupted = "interrupted"
+)
+
+const (
+	// backfillSaveInterval is how often the progress of a running backfill
+	// is stored.
+	backfillSaveInterval = 30 * time.Second
+	// backfillStaleAfter is how long a stored running backfill may go
+	// without an update before it is taken for interrupted.
+	backfillStaleAfter = 5 * time.Minute
+)
+
+// ErrBackfillRunning is returned when a backfill is started while another one
+// is still running.
+var ErrBackfillRunning = errors.New("a backfill is already running")
+
+// BackfillOptions selects what a backfill archives.
+type BackfillOptions struct {
+	// From and To are the first and last day to back up, inclusive. Only
+	// their dates count.
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	// TimeZone is the IANA zone the days are counted in, DefaultTimeZone
+	// when empty. It should be the backup job's.
+	TimeZone string `json:"time_zone"`
+	// ICustomers limits the backfill to these customers; empty means all.
+	ICustomers []string `json:"i_customers,omitempty"`
+	// DryRun only counts the recordings that would be archived.
+	DryRun bool `json:"dry_run"`
+}
+
+// Validate normalises From and To to the start of their days in TimeZone and
+// checks the range.
+func (o *BackfillOptions) Validate() error {
+	if o.From.IsZero() || o.To.IsZero() {
+		return fmt.Errorf("from and to are required")
+	}
+
+	if o.TimeZone == "" {
+		o.TimeZone = common.DefaultTimeZone
+	}
+	location, err := time.LoadLocation(o.TimeZone)
+	if err != nil {
+		return fmt.Errorf("invalid time_zone: %w", err)
+	}
+	o.From = time.Date(o.From.Year(), o.From.Month(), o.From.Day(), 0, 0, 0, 0, location)
+	o.To = time.Date(o.To.Year(), o.To.Month(), o.To.Day(), 0, 0, 0, 0, location)
+
+	if o.To.Before(o.From) {
+		return fmt.Errorf("to must not be before from")
+	}
+	if o.To.After(time.Now()) {
+		return fmt.Errorf("to must not be in the future")
+	}
+	if days := o.days(); days > maxBackfillDays {
+		return fmt.Errorf("range of %d days exceeds the maximum of %d", days, maxBackfillDays)
+	}
+	return nil
+}
+
+// days counts the days in the range. Rounding allows for days that are not
+// 24 hours long at DST changes.
+func (o BackfillOptions) days() int {
+	return int(o.To.Sub(o.From).Round(24*time.Hour)/(24*time.Hour)) + 1
+}
+
+// BackfillProgress is a snapshot of a backfill. DaysSkipped counts the days
+// left alone because another process was backing them up or a completed run
+// had already covered them.
+type BackfillProgress struct {
+	ID          string          `json:"id"`
+	State       string          `json:"state"`
+	Options     BackfillOptions `json:"options"`
+	StartedAt   time.Time       `json:"started_at"`
+	FinishedAt  *time.Time      `json:"finished_at,omitempty"`
+	DaysTotal   int             `json:"days_total"`
+	DaysDone    int             `json:"days_done"`
+	DaysSkipped int             `json:"days_skipped"`
+	CurrentDay  string          `json:"current_day,omitempty"`
+	BackupStats
+}
+
+// Backfill is a backup over a range of past days, running in the background.
+// Backfills are safe to repeat: recordings already archived are skipped, so
+// running an interrupted backfill again resumes it.
+type Backfill struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	stats  runStats
+
+	mu       sync.Mutex
+	progress BackfillProgress
+}
+
+// Progress returns the current state of the backfill.
+func (f *Backfill) Progress() BackfillProgress {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	progress := f.progress
+	progress.BackupStats = f.stats.snapshot()
+	return progress
+}
+
+// Cancel stops the backfill. Recordings in flight are abandoned and picked up
+// again when the same backfill is run later.
+func (f *Backfill) Cancel() {
+	f.cancel()
+}
+
+// Done is closed once the backfill has stopped.
+func (f *Backfill) Done() <-chan struct{} {
+	return f.done
+}
+
+// StartBackfill validates opts and starts backing up the requested days, one
+// day at a time, in the background. Only one backfill runs at a time.
+func (b *Backup) StartBackfill(ctx context.Context, opts BackfillOptions) (*Backfill, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	b.backfillMu.Lock()
+	defer b.backfillMu.Unlock()
+
+	for _, backfill := range b.backfills {
+		if backfill.Progress().State == BackfillRunning {
+			return nil, ErrBackfillRunning
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	backfill := &Backfill{
+		cancel: cancel,
+		done:   make(chan struct{}),
+		progress: BackfillProgress{
+			ID:        primitive.NewObjectID().Hex(),
+			State:     BackfillRunning,
+			Options:   opts,
+			StartedAt: time.Now(),
+			DaysTotal: opts.days(),
+		},
+	}
+	b.backfills[backfill.progress.ID] = backfill
+	b.saveBackfill(ctx, backfill.Progress())
+
+	go b.backfill(ctx, backfill)
+
+	return backfill, nil
+}
+
+// Backfill returns a backfill started by this process, or nil.
+func (b *Backup) Backfill(id string) *Backfill {
+	b.backfillMu.Lock()
+	defer b.backfillMu.Unlock()
+	return b.backfills[id]
+}
+
+// BackfillProgress returns the progress of a backfill, whichever process ran
+// it, or nil if there is no such backfill.
+func (b *Backup) BackfillProgress(ctx context.Context, id string) (*BackfillProgress, error) {
+	if backfill := b.Backfill(id); backfill != nil {
+		progress := backfill.Progress()
+		return &progress, nil
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, nil
+	}
+	stored, err := b.backfillRepo.GetBackfill(ctx, objectID)
+	if err != nil || stored == nil {
+		return nil, err
+	}
+	progress := storedBackfillProgress(*stored)
+	return &progress, nil
+}
+
+// Backfills returns the progress of the most recent backfills, whichever
+// process ran them, newest first. Those of this process are current; the
+// others are as last stored.
+func (b *Backup) Backfills(ctx context.Context, limit int) ([]BackfillProgress, error) {
+	stored, err := b.backfillRepo.ListBackfills(ctx, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	b.backfillMu.Lock()
+	defer b.backfillMu.Unlock()
+
+	progress := make([]BackfillProgress, 0, len(stored)+len(b.backfills))
+	for _, backfill := range b.backfills {
+		progress = append(progress, backfill.Progress())
+	}
+	for _, backfill := range stored {
+		if _, ok := b.backfills[backfill.ID.Hex()]; !ok {
+			progress = append(progress, storedBackfillProgress(backfill))
+		}
+	}
+	sort.Slice(progress, func(i, j int) bool {
+		return progress[i].StartedAt.After(progress[j].StartedAt)
+	})
+	if limit > 0 && len(progress) > limit {
+		progress = progress[:limit]
+	}
+	return progress, nil
+}
+
+// saveBackfill stores the progress of a backfill. Failures are logged: the
+// backfill itself goes on regardless.
+func (b *Backup) saveBackfill(ctx context.Context, progress BackfillProgress) {
+	id, _ := primitive.ObjectIDFromHex(progress.ID)
+	err := b.backfillRepo.SaveBackfill(context.WithoutCancel(ctx), domain.Backfill{
+		ID:          id,
+		State:       progress.State,
+		From:        progress.Options.From,
+		To:          progress.Options.To,
+		TimeZone:    progress.Options.TimeZone,
+		ICustomers:  progress.Options.ICustomers,
+		DryRun:      progress.Options.DryRun,
+		DaysTotal:   progress.DaysTotal,
+		DaysDone:    progress.DaysDone,
+		DaysSkipped: progress.DaysSkipped,
+		CurrentDay:  progress.CurrentDay,
+		XDRs:        progress.XDRs,
+		Archived:    progress.Archived,
+		Skipped:     progress.Skipped,
+		Pending:     progress.Pending,
+		Failed:      progress.Failed,
+		Queued:      progress.Queued,
+		StartedAt:   progress.StartedAt,
+		UpdatedAt:   time.Now(),
+		FinishedAt:  progress.FinishedAt,
+	})
+	if err != nil {
+		slog.Error("Failed to save backfill progress", "id", progress.ID, "error", err)
+	}
+}
+
+// storedBackfillProgress is the progress of a backfill as stored. A running
+// backfill that stopped being updated is reported as interrupted.
+func storedBackfillProgress(stored domain.Backfill) BackfillProgress {
+	progress := BackfillProgress{
+		ID:    stored.ID.Hex(),
+		State: stored.State,
+		Options: BackfillOptions{
+			From:       stored.From,
+			To:         stored.To,
+			TimeZone:   stored.TimeZone,
+			ICustomers: stored.ICustomers,
+			DryRun:     stored.DryRun,
+		},
+		StartedAt:   stored.StartedAt,
+		FinishedAt:  stored.FinishedAt,
+		DaysTotal:   stored.DaysTotal,
+		DaysDone:    stored.DaysDone,
+		DaysSkipped: stored.DaysSkipped,
+		CurrentDay:  stored.CurrentDay,
+		BackupStats: BackupStats{
+			XDRs:     stored.XDRs,
+			Archived: stored.Archived,
+			Skipped:  stored.Skipped,
+			Pending:  stored.Pending,
+			Failed:   stored.Failed,
+			Queued:   stored.Queued,
+		},
+	}
+	if progress.State == BackfillRunning && time.Since(stored.UpdatedAt) > backfillStaleAfter {
+		progress.State = BackfillInterrupted
+	}
+	return progress
+}
+
+// keepSaving stores the progress of a running backfill every
+// backfillSaveInterval until stop is closed.
+func (b *Backup) keepSaving(ctx context.Context, backfill *Backfill, stop <-chan struct{}) {
+	ticker := time.NewTicker(backfillSaveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			b.saveBackfill(ctx, backfill.Progress())
+		}
+	}
+}
+
+func (b *Backup) backfill(ctx context.Context, backfill *Backfill) {
+	defer close(backfill.done)
+	defer backfill.cancel()
+
+	stopSaving := make(chan struct{})
+	go b.keepSaving(ctx, backfill, stopSaving)
+
+	opts := backfill.progress.Options
+	customers := b.backfillCustomers(ctx, opts.ICustomers)
+
+	for day := opts.From; !day.After(opts.To) && ctx.Err() == nil; day = day.AddDate(0, 0, 1) {
+		window := dayWindow(day)
+
+		backfill.mu.Lock()
+		backfill.progress.CurrentDay = window.date
+		backfill.mu.Unlock()
+
+		processed := b.run(ctx, window, backfillScope(opts.ICustomers), customers, opts.DryRun, &backfill.stats)
+
+		if ctx.Err() == nil {
+			backfill.mu.Lock()
+			if processed {
+				backfill.progress.DaysDone++
+			} else {
+				backfill.progress.DaysSkipped++
+			}
+			backfill.mu.Unlock()
+		}
+	}
+
+	finishedAt := time.Now()
+	backfill.mu.Lock()
+	backfill.progress.FinishedAt = &finishedAt
+	backfill.progress.CurrentDay = ""
+	backfill.progress.State = BackfillCompleted
+	if ctx.Err() != nil {
+		backfill.progress.State = BackfillCancelled
+	}
+	backfill.mu.Unlock()
+
+	close(stopSaving)
+	progress := backfill.Progress()
+	b.saveBackfill(ctx, progress)
+	slog.Info("Backfill finished", "id", progress.ID, "state", progress.State, "days", progress.DaysDone,
+		"daysSkipped", progress.DaysSkipped, "xdrs", progress.XDRs, "archived", progress.Archived, "skipped", progress.Skipped,
+		"pending", progress.Pending, "failed", progress.Failed)
+}
+
+// backfillCustomers returns the customers to back up. Requested customers
+// without a user keep the instance the registry maps them to.
+func (b *Backup) backfillCustomers(ctx context.Context, iCustomers []string) []backupCustomer {
+	customers := iCustomerList(b.userRepo, ctx)
+	if len(iCustomers) == 0 {
+		return customers
+	}
+
+	known := make(map[string]backupCustomer, len(customers))
+	for _, customer := range customers {
+		known[customer.ICustomer] = customer
+	}
+
+	selected := make([]backupCustomer, 0, len(iCustomers))
+	seen := make(map[string]bool, len(iCustomers))
+	for _, iCustomer := range iCustomers {
+		if seen[iCustomer] {
+			continue
+		}
+		seen[iCustomer] = true
+
+		customer, ok := known[iCustomer]
+		if !ok {
+			customer = backupCustomer{ICustomer: iCustomer}
+		}
+		selected = append(selected, customer)
+	}
+	return selected
+}
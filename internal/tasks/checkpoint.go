@@ -0,0 +1,317 @@
+package tasks
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Rafin000/call-recording-service-v2/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// scopeAll is the checkpoint scope of a run over every customer.
+const scopeAll = "all"
+
+// customersScope identifies the customer set of a run, so that only a run over
+// the same customers resumes it.
+func customersScope(iCustomers []string) string {
+	if len(iCustomers) == 0 {
+		return scopeAll
+	}
+	sorted := append([]string(nil), iCustomers...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
+
+// backfillScope is the checkpoint scope of a backfill over iCustomers. It is
+// kept apart from the scheduled job's, so neither resumes the other's runs.
+func backfillScope(iCustomers []string) string {
+	return "backfill:" + customersScope(iCustomers)
+}
+
+// Bounds on resuming a run.
+const (
+	// runHeartbeat is how often a run records that it is still going.
+	runHeartbeat = time.Minute
+	// runStaleAfter is how long a running run may go quiet before it is taken
+	// for dead, its process gone, and resumed.
+	runStaleAfter = 5 * runHeartbeat
+	// A run still unfinished after this many attempts or this long is
+	// abandoned, and the next run over its window starts afresh.
+	maxRunAttempts = 5
+	maxRunAge      = 48 * time.Hour
+)
+
+// checkpoint persists the progress of a backup run in backup_runs so an
+// interrupted run can continue where it stopped. A nil checkpoint (dry runs)
+// records nothing. Write failures are logged and otherwise ignored: archiving
+// is idempotent, so a lost checkpoint only costs repeated work.
+type checkpoint struct {
+	repo domain.BackupRunRepository
+	id   primitive.ObjectID
+	stop chan struct{}
+
+	mu        sync.Mutex
+	customers map[string]string
+}
+
+// startCheckpoint resumes the latest run over the same window and scope, or
+// creates a new one for customers. A completed run is reopened rather than
+// replaced while its window is open, so the frequent passes over today share
+// one run. It returns the customers the run covers. It reports false,
+// starting nothing, if the run is still going in another process or a
+// completed run already covered the whole window and every customer.
+func startCheckpoint(ctx context.Context, repo domain.BackupRunRepository, window backupWindow, scope string, customers []backupCustomer) (*checkpoint, []backupCustomer, bool) {
+	existing, err := repo.FindLatestBackupRun(ctx, window.startTime, window.endTime, scope)
+	if err != nil {
+		slog.Error("Failed to look up earlier backup run, starting a new one", "error", err)
+	}
+
+	if existing != nil {
+		switch {
+		case existing.State == domain.BackupRunCompleted && coveredWindow(existing, window) && !hasNewCustomers(existing, customers):
+			slog.Debug("Backup run already covered the window", "run", existing.ID.Hex(), "date", window.date, "scope", scope)
+			return nil, nil, false
+		case existing.State == domain.BackupRunCompleted:
+			cp, resumed := resumeCheckpoint(ctx, repo, window, existing, customers)
+			return cp, resumed, true
+		case existing.State == domain.BackupRunRunning && time.Since(existing.UpdatedAt) < runStaleAfter:
+			slog.Warn("Backup run is in progress elsewhere, leaving the window to it", "run", existing.ID.Hex(),
+				"date", window.date, "scope", scope, "updatedAt", existing.UpdatedAt)
+			return nil, nil, false
+		case existing.Attempts >= maxRunAttempts || time.Since(existing.StartedAt) > maxRunAge:
+			slog.Warn("Abandoning backup run that would not finish, starting over", "run", existing.ID.Hex(),
+				"date", window.date, "scope", scope, "attempts", existing.Attempts, "startedAt", existing.StartedAt)
+			if err := repo.SetBackupRunState(ctx, existing.ID, domain.BackupRunAbandoned); err != nil {
+				slog.Error("Failed to checkpoint backup run", "run", existing.ID.Hex(), "error", err)
+			}
+		default:
+			cp, resumed := resumeCheckpoint(ctx, repo, window, existing, customers)
+			return cp, resumed, true
+		}
+	}
+
+	now := time.Now()
+	run := domain.BackupRun{
+		StartTime: window.startTime,
+		EndTime:   window.endTime,
+		Date:      window.date,
+		Scope:     scope,
+		State:     domain.BackupRunRunning,
+		Attempts:  1,
+		Customers: make(map[string]domain.BackupRunCustomer, len(customers)),
+		StartedAt: now,
+		UpdatedAt: now,
+	}
+	for _, customer := range customers {
+		run.Customers[customer.ICustomer] = domain.BackupRunCustomer{
+			Instance:  customer.Instance,
+			State:     domain.BackupCustomerPending,
+			UpdatedAt: now,
+		}
+	}
+
+	id, err := repo.CreateBackupRun(ctx, run)
+	if err != nil {
+		slog.Error("Failed to create backup run, continuing without checkpoints", "error", err)
+		return nil, customers, true
+	}
+
+	return newCheckpoint(repo, id, run.Customers), customers, true
+}
+
+// coveredWindow reports whether a completed run finished after its window
+// closed, so it saw every call of the window.
+func coveredWindow(run *domain.BackupRun, window backupWindow) bool {
+	return run.FinishedAt != nil && run.FinishedAt.After(window.end)
+}
+
+// hasNewCustomers reports whether any of customers is missing from run.
+func hasNewCustomers(run *domain.BackupRun, customers []backupCustomer) bool {
+	for _, customer := range customers {
+		if _, ok := run.Customers[customer.ICustomer]; !ok {
+			return true
+		}
+	}
+	return false
+}
+
+// resumeCheckpoint picks up an unfinished run, or reopens a completed one.
+// Customers added since it started join it. While its window is still open,
+// or if a completed run finished before the window closed, every customer is
+// listed again, so calls made since the run started are backed up too;
+// recordings already archived are skipped.
+func resumeCheckpoint(ctx context.Context, repo domain.BackupRunRepository, window backupWindow, existing *domain.BackupRun, customers []backupCustomer) (*checkpoint, []backupCustomer) {
+	now := time.Now()
+	reopen := existing.State == domain.BackupRunCompleted
+	open := now.Before(window.end) || (reopen && !coveredWindow(existing, window))
+	changed := make(map[string]domain.BackupRunCustomer)
+
+	if open {
+		for iCustomer, customer := range existing.Customers {
+			if customer.State != domain.BackupCustomerPending {
+				changed[iCustomer] = domain.BackupRunCustomer{Instance: customer.Instance, State: domain.BackupCustomerPending, UpdatedAt: now}
+			}
+		}
+	}
+	for _, customer := range customers {
+		current, ok := existing.Customers[customer.ICustomer]
+		if update, reopened := changed[customer.ICustomer]; reopened {
+			current = update
+		}
+		if !ok {
+			current = domain.BackupRunCustomer{State: domain.BackupCustomerPending}
+		}
+		if !ok || current.Instance != customer.Instance {
+			current.Instance, current.UpdatedAt = customer.Instance, now
+			changed[customer.ICustomer] = current
+		}
+	}
+
+	merged := make(map[string]domain.BackupRunCustomer, len(existing.Customers)+len(changed))
+	for iCustomer, customer := range existing.Customers {
+		merged[iCustomer] = customer
+	}
+	for iCustomer, customer := range changed {
+		merged[iCustomer] = customer
+	}
+
+	resume, attempt := repo.ResumeBackupRun, existing.Attempts+1
+	if reopen {
+		resume, attempt = repo.ReopenBackupRun, 1
+	}
+	if err := resume(ctx, existing.ID, changed); err != nil {
+		slog.Error("Failed to checkpoint backup run", "run", existing.ID.Hex(), "error", err)
+	}
+
+	resumed := make([]backupCustomer, 0, len(merged))
+	for iCustomer, customer := range merged {
+		resumed = append(resumed, backupCustomer{ICustomer: iCustomer, Instance: customer.Instance})
+	}
+	slog.Info("Resuming backup run", "run", existing.ID.Hex(), "startedAt", existing.StartedAt,
+		"attempt", attempt, "customers", len(resumed), "reopened", reopen, "windowOpen", open)
+	return newCheckpoint(repo, existing.ID, merged), resumed
+}
+
+// newCheckpoint tracks a run with the given customers and keeps it marked as
+// alive until it finishes.
+func newCheckpoint(repo domain.BackupRunRepository, id primitive.ObjectID, customers map[string]domain.BackupRunCustomer) *checkpoint {
+	cp := &checkpoint{repo: repo, id: id, stop: make(chan struct{}), customers: make(map[string]string, len(customers))}
+	for iCustomer, customer := range customers {
+		cp.customers[iCustomer] = customer.State
+	}
+	go cp.keepAlive()
+	return cp
+}
+
+// keepAlive touches the run every runHeartbeat until it finishes, so other
+// processes can tell it from one whose process died.
+func (cp *checkpoint) keepAlive() {
+	ticker := time.NewTicker(runHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-cp.stop:
+			return
+		case <-ticker.C:
+			if err := cp.repo.TouchBackupRun(context.Background(), cp.id); err != nil {
+				slog.Error("Failed to checkpoint backup run", "run", cp.id.Hex(), "error", err)
+			}
+		}
+	}
+}
+
+func (cp *checkpoint) customerState(iCustomer string) string {
+	if cp == nil {
+		return domain.BackupCustomerPending
+	}
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	return cp.customers[iCustomer]
+}
+
+func (cp *checkpoint) setCustomerState(ctx context.Context, iCustomer, state string) {
+	if cp == nil {
+		return
+	}
+	cp.mu.Lock()
+	cp.customers[iCustomer] = state
+	cp.mu.Unlock()
+
+	if err := cp.repo.SetBackupRunCustomerState(context.WithoutCancel(ctx), cp.id, iCustomer, state); err != nil {
+		slog.Error("Failed to checkpoint customer", "run", cp.id.Hex(), "iCustomer", iCustomer, "state", state, "error", err)
+	}
+}
+
+// addXDR records a listed XDR as pending.
+func (cp *checkpoint) addXDR(ctx context.Context, iCustomer int, iXDR int64) {
+	if cp == nil {
+		return
+	}
+	err := cp.repo.AddBackupRunXDR(ctx, domain.BackupRunXDR{
+		RunID:     cp.id,
+		IXDR:      iXDR,
+		ICustomer: iCustomer,
+		State:     domain.BackupXDRPending,
+		UpdatedAt: time.Now(),
+	})
+	if err != nil {
+		slog.Error("Failed to checkpoint XDR", "run", cp.id.Hex(), "i_xdr", iXDR, "error", err)
+	}
+}
+
+func (cp *checkpoint) setXDRState(ctx context.Context, iXDR int64, state string, cause error) {
+	if cp == nil {
+		return
+	}
+	errMessage := ""
+	if cause != nil {
+		errMessage = cause.Error()
+	}
+	if err := cp.repo.SetBackupRunXDRState(context.WithoutCancel(ctx), cp.id, iXDR, state, errMessage); err != nil {
+		slog.Error("Failed to checkpoint XDR", "run", cp.id.Hex(), "i_xdr", iXDR, "state", state, "error", err)
+	}
+}
+
+// unfinishedXDRs returns the XDRs of a customer still to be archived.
+func (cp *checkpoint) unfinishedXDRs(ctx context.Context, iCustomer int) ([]domain.BackupRunXDR, error) {
+	return cp.repo.ListBackupRunXDRs(ctx, cp.id, &iCustomer, []string{domain.BackupXDRPending, domain.BackupXDRFailed}, 0)
+}
+
+// finish records the final state of the run: completed once every customer
+// is done or failed, otherwise left to be resumed. A completed run drops the
+// XDRs it archived or skipped and keeps only those that failed or were queued.
+func (cp *checkpoint) finish(ctx context.Context) {
+	if cp == nil {
+		return
+	}
+	close(cp.stop)
+
+	state := domain.BackupRunCompleted
+	cp.mu.Lock()
+	for _, customerState := range cp.customers {
+		if customerState != domain.BackupCustomerDone && customerState != domain.BackupCustomerFailed {
+			state = domain.BackupRunIncomplete
+			break
+		}
+	}
+	cp.mu.Unlock()
+	if ctx.Err() != nil {
+		state = domain.BackupRunCancelled
+	}
+
+	if err := cp.repo.SetBackupRunState(context.WithoutCancel(ctx), cp.id, state); err != nil {
+		slog.Error("Failed to checkpoint backup run", "run", cp.id.Hex(), "state", state, "error", err)
+	}
+
+	if state == domain.BackupRunCompleted {
+		done := []string{domain.BackupXDRArchived, domain.BackupXDRSkipped}
+		if err := cp.repo.DeleteBackupRunXDRs(context.WithoutCancel(ctx), cp.id, done); err != nil {
+			slog.Error("Failed to prune backup run XDRs", "run", cp.id.Hex(), "error", err)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package tasks
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Rafin000/call-recording-service-v2/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// testDay is a day whose backup window has closed.
+var testDay = time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC)
+
+func timeAt(t time.Time) *time.Time { return &t }
+
+func TestRunResumesCheckpoint(t *testing.T) {
+	tests := []struct {
+		name string
+		// earlier is the unfinished run left over the window, if any.
+		earlier        *domain.BackupRun
+		wantListCalls  int
+		wantRecordings int
+		wantState      string
+		wantAttempts   int
+		wantNewRun     bool
+		wantSkipped    bool
+	}{
+		{
+			name:           "no earlier run",
+			wantListCalls:  1,
+			wantRecordings: 3,
+			wantNewRun:     true,
+		},
+		{
+			name:           "interrupted run",
+			earlier:        &domain.BackupRun{State: domain.BackupRunRunning, Attempts: 1, UpdatedAt: time.Now().Add(-2 * runStaleAfter)},
+			wantRecordings: 2,
+			wantState:      domain.BackupRunCompleted,
+			wantAttempts:   2,
+		},
+		{
+			name:         "run still going elsewhere",
+			earlier:      &domain.BackupRun{State: domain.BackupRunRunning, Attempts: 1, UpdatedAt: time.Now()},
+			wantState:    domain.BackupRunRunning,
+			wantAttempts: 1,
+			wantSkipped:  true,
+		},
+		{
+			name:           "run that would not finish",
+			earlier:        &domain.BackupRun{State: domain.BackupRunIncomplete, Attempts: maxRunAttempts, UpdatedAt: time.Now().Add(-time.Hour)},
+			wantListCalls:  1,
+			wantRecordings: 3,
+			wantState:      domain.BackupRunAbandoned,
+			wantAttempts:   maxRunAttempts,
+			wantNewRun:     true,
+		},
+		{
+			name:         "completed run that covered the window",
+			earlier:      &domain.BackupRun{State: domain.BackupRunCompleted, Attempts: 2, FinishedAt: timeAt(testDay.Add(25 * time.Hour))},
+			wantState:    domain.BackupRunCompleted,
+			wantAttempts: 2,
+			wantSkipped:  true,
+		},
+		{
+			name:           "completed run that finished before the window closed",
+			earlier:        &domain.BackupRun{State: domain.BackupRunCompleted, Attempts: 2, FinishedAt: timeAt(testDay.Add(12 * time.Hour))},
+			wantListCalls:  1,
+			wantRecordings: 3,
+			wantState:      domain.BackupRunCompleted,
+			wantAttempts:   1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tb := newTestBackup(t)
+			for i := int64(1); i <= 3; i++ {
+				tb.addCall(i, testDay.Add(time.Duration(i)*time.Hour))
+			}
+			window := dayWindow(testDay)
+			ctx := context.Background()
+
+			// The earlier run listed all three XDRs and archived the first
+			var earlierID primitive.ObjectID
+			if tt.earlier != nil {
+				run := *tt.earlier
+				run.StartTime, run.EndTime, run.Date, run.Scope = window.startTime, window.endTime, window.date, scopeAll
+				run.StartedAt = time.Now().Add(-time.Hour)
+				run.Customers = map[string]domain.BackupRunCustomer{"1001": {State: domain.BackupCustomerListed}}
+				earlierID, _ = tb.runs.CreateBackupRun(ctx, run)
+				tb.runs.mu.Lock()
+				tb.runs.runs[earlierID].UpdatedAt = run.UpdatedAt
+				tb.runs.mu.Unlock()
+
+				for i, state := range []string{domain.BackupXDRArchived, domain.BackupXDRPending, domain.BackupXDRFailed} {
+					_ = tb.runs.AddBackupRunXDR(ctx, domain.BackupRunXDR{RunID: earlierID, IXDR: int64(i + 1), ICustomer: 1001, State: state})
+				}
+			}
+
+			if processed := tb.run(ctx, window, scopeAll, []backupCustomer{{ICustomer: "1001"}}, false, &runStats{}); processed == tt.wantSkipped {
+				t.Errorf("run reported processed %v, want %v", processed, !tt.wantSkipped)
+			}
+
+			if got := tb.portaOne.callCount("Customer/get_customer_xdrs"); got != tt.wantListCalls {
+				t.Errorf("listed XDRs %d times, want %d", got, tt.wantListCalls)
+			}
+			if got := tb.portaOne.callCount("CDR/get_call_recording"); got != tt.wantRecordings {
+				t.Errorf("fetched %d recordings, want %d", got, tt.wantRecordings)
+			}
+
+			if tt.earlier != nil {
+				earlier, _ := tb.runs.GetBackupRun(ctx, earlierID)
+				if earlier.State != tt.wantState || earlier.Attempts != tt.wantAttempts {
+					t.Errorf("earlier run is %s after %d attempts, want %s after %d",
+						earlier.State, earlier.Attempts, tt.wantState, tt.wantAttempts)
+				}
+				if earlier.State == domain.BackupRunCompleted && tt.wantRecordings > 0 {
+					if got := tb.runs.xdrState(earlierID, 1); got != "" {
+						t.Errorf("archived XDR left in the completed run as %q, want it pruned", got)
+					}
+				}
+			}
+
+			runs, _ := tb.runs.ListBackupRuns(ctx, 0)
+			newRuns := 0
+			for _, run := range runs {
+				if run.ID == earlierID {
+					continue
+				}
+				newRuns++
+				if run.State != domain.BackupRunCompleted || run.Attempts != 1 {
+					t.Errorf("new run is %s after %d attempts, want completed after 1", run.State, run.Attempts)
+				}
+			}
+			if (newRuns == 1) != tt.wantNewRun || newRuns > 1 {
+				t.Errorf("started %d new runs, want new run %v", newRuns, tt.wantNewRun)
+			}
+		})
+	}
+}
+
+func TestResumeCheckpointCustomers(t *testing.T) {
+	tests := []struct {
+		name string
+		end  time.Time
+		want map[string]domain.BackupRunCustomer
+	}{
+		{
+			name: "closed window keeps progress",
+			end:  time.Now().Add(-time.Hour),
+			want: map[string]domain.BackupRunCustomer{
+				"1001": {State: domain.BackupCustomerDone},
+				"1002": {State: domain.BackupCustomerListed},
+				"1003": {Instance: "second", State: domain.BackupCustomerPending},
+			},
+		},
+		{
+			name: "open window lists everyone again",
+			end:  time.Now().Add(time.Hour),
+			want: map[string]domain.BackupRunCustomer{
+				"1001": {State: domain.BackupCustomerPending},
+				"1002": {State: domain.BackupCustomerPending},
+				"1003": {Instance: "second", State: domain.BackupCustomerPending},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runs := newMemRuns()
+			ctx := context.Background()
+			id, _ := runs.CreateBackupRun(ctx, domain.BackupRun{
+				State:    domain.BackupRunIncomplete,
+				Attempts: 1,
+				Customers: map[string]domain.BackupRunCustomer{
+					"1001": {State: domain.BackupCustomerDone},
+					"1002": {State: domain.BackupCustomerListed},
+				},
+			})
+			existing, _ := runs.GetBackupRun(ctx, id)
+
+			// 1002 has since left and 1003 joined on another instance
+			cp, customers := resumeCheckpoint(ctx, runs, backupWindow{end: tt.end}, existing, []backupCustomer{{ICustomer: "1001"}, {ICustomer: "1003", Instance: "second"}})
+			close(cp.stop)
+
+			if len(customers) != len(tt.want) {
+				t.Errorf("resumed %d customers, want %d", len(customers), len(tt.want))
+			}
+			stored, _ := runs.GetBackupRun(ctx, id)
+			if stored.State != domain.BackupRunRunning || stored.Attempts != 2 {
+				t.Errorf("run is %s after %d attempts, want running after 2", stored.State, stored.Attempts)
+			}
+			for iCustomer, want := range tt.want {
+				got := stored.Customers[iCustomer]
+				if got.State != want.State || got.Instance != want.Instance {
+					t.Errorf("customer %s is %+v, want %+v", iCustomer, got, want)
+				}
+				if cp.customerState(iCustomer) != want.State {
+					t.Errorf("customer %s is checkpointed as %s, want %s", iCustomer, cp.customerState(iCustomer), want.State)
+				}
+			}
+		})
+	}
+}
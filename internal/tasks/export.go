@@ -0,0 +1,386 @@
+package tasks
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Rafin000/call-recording-service-v2/internal/common"
+	"github.com/Rafin000/call-recording-service-v2/internal/domain"
+	"github.com/Rafin000/call-recording-service-v2/internal/infra/storage"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultExportMaxBytes     = 2 << 30
+	defaultExportSyncMaxBytes = 100 << 20
+	defaultExportRetention    = 24 * time.Hour
+	defaultExportConcurrent   = 2
+
+	// maxExportXDRs bounds the XDRs, and so the manifest rows, in one download.
+	maxExportXDRs = 50000
+	// exportTimeout bounds building a background export. An export still
+	// running after this long was lost with the replica building it.
+	exportTimeout = 2 * time.Hour
+	// expiredExportBatch is how many expired exports one cleanup removes.
+	expiredExportBatch = 100
+
+	manifestName = "manifest.csv"
+)
+
+// Status of an XDR in the manifest of a download.
+const (
+	ManifestArchived    = "archived"
+	ManifestNotArchived = "not_archived"
+	ManifestMissing     = "missing"
+	ManifestOverSizeCap = "over_size_cap"
+)
+
+var (
+	// ErrExportEmpty is returned for a filter that matches no XDRs.
+	ErrExportEmpty = errors.New("no XDRs match the filter")
+	// ErrExportTooLarge is returned for a filter matching more than one
+	// download may hold.
+	ErrExportTooLarge = errors.New("too many recordings for one download")
+	// ErrExportBusy is returned when as many background exports as allowed
+	// are already being built.
+	ErrExportBusy = errors.New("too many exports being built")
+)
+
+// ExportFilter selects the XDRs of a download: a customer's calls connected
+// between From and To, inclusive.
+type ExportFilter struct {
+	ICustomer int
+	From      time.Time
+	To        time.Time
+}
+
+// Filename is the name a download of the filter is saved under.
+func (f ExportFilter) Filename() string {
+	return fmt.Sprintf("recordings_%d_%s_%s.zip", f.ICustomer, f.From.UTC().Format("20060102"), f.To.UTC().Format("20060102"))
+}
+
+// Exporter builds ZIP downloads of archived recordings with a CSV manifest of
+// their XDRs, either streamed straight to the client or, when large, built
+// in the background into the recording store.
+type Exporter struct {
+	xdrRepo    domain.XDRRepository
+	exportRepo domain.RecordingExportRepository
+	store      storage.RecordingStore
+	cfg        common.ExportConfig
+
+	// starting serializes Start, so concurrent requests for the same
+	// download share one export
+	starting sync.Mutex
+	// builds holds a slot for each background export being built
+	builds chan struct{}
+}
+
+// NewExporter creates an Exporter, filling in defaults for unset limits.
+func NewExporter(xdrRepo domain.XDRRepository, exportRepo domain.RecordingExportRepository, store storage.RecordingStore, cfg common.ExportConfig) *Exporter {
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = defaultExportMaxBytes
+	}
+	if cfg.SyncMaxBytes <= 0 {
+		cfg.SyncMaxBytes = min(defaultExportSyncMaxBytes, cfg.MaxBytes)
+	}
+	if cfg.Retention <= 0 {
+		cfg.Retention = defaultExportRetention
+	}
+	if cfg.MaxConcurrent <= 0 {
+		cfg.MaxConcurrent = defaultExportConcurrent
+	}
+
+	return &Exporter{
+		xdrRepo:    xdrRepo,
+		exportRepo: exportRepo,
+		store:      store,
+		cfg:        cfg,
+		builds:     make(chan struct{}, cfg.MaxConcurrent),
+	}
+}
+
+// Plan counts what a download of filter would hold and checks it against the
+// limits. It reports whether the download is small enough to stream directly.
+func (e *Exporter) Plan(ctx context.Context, filter ExportFilter) (*domain.XDRSummary, bool, error) {
+	summary, err := e.xdrRepo.SummarizeXDRs(ctx, filter.ICustomer, filter.From.Unix(), filter.To.Unix())
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to count XDRs: %w", err)
+	}
+
+	switch {
+	case summary.XDRs == 0:
+		return summary, false, ErrExportEmpty
+	case summary.XDRs > maxExportXDRs:
+		return summary, false, fmt.Errorf("%w: %d XDRs, at most %d per download", ErrExportTooLarge, summary.XDRs, maxExportXDRs)
+	case summary.RecordingBytes > e.cfg.MaxBytes:
+		return summary, false, fmt.Errorf("%w: %d bytes of recordings, at most %d per download", ErrExportTooLarge, summary.RecordingBytes, e.cfg.MaxBytes)
+	}
+
+	return summary, summary.RecordingBytes <= e.cfg.SyncMaxBytes, nil
+}
+
+// WriteZIP writes the archived recordings matching filter to w as a ZIP,
+// followed by a manifest.csv listing every matching XDR and whether its
+// recording is included. Recordings are stored uncompressed, as WAV barely
+// compresses, and are read from the store one at a time so memory use stays
+// flat. Recordings beyond the size cap are left out and marked as such.
+func (e *Exporter) WriteZIP(ctx context.Context, w io.Writer, filter ExportFilter) error {
+	xdrs, err := e.xdrRepo.ListXDRs(ctx, filter.ICustomer, filter.From.Unix(), filter.To.Unix(), maxExportXDRs)
+	if err != nil {
+		return fmt.Errorf("failed to list XDRs: %w", err)
+	}
+
+	archive := zip.NewWriter(w)
+	statuses := make([]string, len(xdrs))
+	files := make([]string, len(xdrs))
+	var written int64
+
+	for i, xdr := range xdrs {
+		if xdr.Archive == nil {
+			statuses[i] = ManifestNotArchived
+			continue
+		}
+		if written+xdr.Archive.Size > e.cfg.MaxBytes {
+			statuses[i] = ManifestOverSizeCap
+			continue
+		}
+
+		name := exportEntryName(xdr)
+		n, err := e.writeRecording(ctx, archive, name, xdr)
+		if errors.Is(err, storage.ErrNotFound) {
+			slog.Warn("Archived recording missing from storage, leaving it out of the download", "i_xdr", xdr.IXDR, "key", xdr.Archive.S3Key)
+			statuses[i] = ManifestMissing
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		written += n
+		statuses[i], files[i] = ManifestArchived, name
+	}
+
+	if err := writeManifest(archive, xdrs, statuses, files); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+// writeRecording copies one archived recording into the ZIP. Nothing is
+// written for a recording missing from the store.
+func (e *Exporter) writeRecording(ctx context.Context, archive *zip.Writer, name string, xdr domain.XDR) (int64, error) {
+	object, err := e.store.Get(ctx, xdr.Archive.S3Key, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer object.Body.Close()
+
+	entry, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Store,
+		Modified: time.Unix(xdr.UnixConnectTime, 0).UTC(),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := io.Copy(entry, object.Body)
+	if err != nil {
+		return n, fmt.Errorf("failed to add recording %d to download: %w", xdr.IXDR, err)
+	}
+	return n, nil
+}
+
+// exportEntryName places a recording in the ZIP the way it is laid out in the
+// archive, minus the instance and customer: "<date>/recording_<i_xdr>.wav".
+func exportEntryName(xdr domain.XDR) string {
+	if dir, name := path.Split(xdr.Archive.S3Key); dir != "" && name != "" {
+		return path.Base(dir) + "/" + name
+	}
+	return fmt.Sprintf("recording_%d.wav", xdr.IXDR)
+}
+
+var manifestHeader = []string{
+	"i_xdr", "i_account", "account_id", "CLI", "CLD", "connect_time", "disconnect_time",
+	"charged_quantity", "charged_amount", "country", "description", "bill_status",
+	"status", "file", "size", "sha256",
+}
+
+func writeManifest(archive *zip.Writer, xdrs []domain.XDR, statuses, files []string) error {
+	entry, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     manifestName,
+		Method:   zip.Deflate,
+		Modified: time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+
+	manifest := csv.NewWriter(entry)
+	if err := manifest.Write(manifestHeader); err != nil {
+		return err
+	}
+	for i, xdr := range xdrs {
+		var size, checksum string
+		if files[i] != "" {
+			size, checksum = strconv.FormatInt(xdr.Archive.Size, 10), xdr.Archive.SHA256
+		}
+		err := manifest.Write([]string{
+			strconv.FormatInt(xdr.IXDR, 10),
+			strconv.FormatInt(xdr.IAccount, 10),
+			xdr.AccountID,
+			xdr.CLI,
+			xdr.CLD,
+			xdr.ConnectTime,
+			xdr.DisconnectTime,
+			strconv.FormatInt(xdr.ChargedQuantity, 10),
+			strconv.FormatFloat(xdr.ChargedAmount, 'f', -1, 64),
+			xdr.Country,
+			xdr.Description,
+			xdr.BillStatus,
+			statuses[i],
+			files[i],
+			size,
+			checksum,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	manifest.Flush()
+	return manifest.Error()
+}
+
+// Start builds a download in the background into the recording store and
+// returns the export tracking it. A download of the same filter still being
+// built is returned instead of starting another, and ErrExportBusy is returned
+// if this replica is already building as many exports as allowed. Expired
+// exports are cleaned up first.
+func (e *Exporter) Start(ctx context.Context, filter ExportFilter, summary *domain.XDRSummary, createdBy string) (*domain.RecordingExport, error) {
+	e.deleteExpired(ctx)
+
+	e.starting.Lock()
+	defer e.starting.Unlock()
+
+	now := time.Now()
+	running, err := e.exportRepo.FindRunningRecordingExport(ctx, filter.ICustomer, filter.From, filter.To, now.Add(-exportTimeout))
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up running exports: %w", err)
+	}
+	if running != nil {
+		return running, nil
+	}
+
+	select {
+	case e.builds <- struct{}{}:
+	default:
+		return nil, ErrExportBusy
+	}
+
+	id := primitive.NewObjectID()
+	export := domain.RecordingExport{
+		ID:             id,
+		ICustomer:      filter.ICustomer,
+		FromDate:       filter.From,
+		ToDate:         filter.To,
+		State:          domain.RecordingExportRunning,
+		XDRs:           summary.XDRs,
+		Recordings:     summary.Recordings,
+		RecordingBytes: summary.RecordingBytes,
+		Key:            fmt.Sprintf("exports/%d/%s.zip", filter.ICustomer, id.Hex()),
+		CreatedBy:      createdBy,
+		CreatedAt:      now,
+		// Pushed back once the export finishes; until then this also covers
+		// cleaning up after an export that never does
+		ExpiresAt: now.Add(exportTimeout + e.cfg.Retention),
+	}
+	if _, err := e.exportRepo.CreateRecordingExport(ctx, export); err != nil {
+		<-e.builds
+		return nil, fmt.Errorf("failed to create export: %w", err)
+	}
+
+	go func() {
+		defer func() { <-e.builds }()
+		e.build(export, filter)
+	}()
+	return &export, nil
+}
+
+// build zips the recordings straight into the store through a pipe, so the
+// ZIP is never held in memory or on local disk.
+func (e *Exporter) build(export domain.RecordingExport, filter ExportFilter) {
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+
+	started := time.Now()
+	slog.Info("Recording export started", "id", export.ID.Hex(), "i_customer", export.ICustomer,
+		"xdrs", export.XDRs, "recordingBytes", export.RecordingBytes)
+
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(e.WriteZIP(ctx, writer, filter))
+	}()
+
+	stored, err := e.store.Put(ctx, export.Key, reader, storage.PutOptions{ContentType: "application/zip"})
+	// Unblocks the writer if the upload gave up early
+	reader.CloseWithError(err)
+
+	state, size, message := domain.RecordingExportReady, int64(0), ""
+	if err != nil {
+		state, message = domain.RecordingExportFailed, err.Error()
+		slog.Error("Recording export failed", "id", export.ID.Hex(), "error", err)
+	} else {
+		size = stored.Size
+		slog.Info("Recording export ready", "id", export.ID.Hex(), "size", size, "duration", time.Since(started))
+	}
+
+	expiresAt := time.Now().Add(e.cfg.Retention)
+	if err := e.exportRepo.FinishRecordingExport(context.WithoutCancel(ctx), export.ID, state, size, message, expiresAt); err != nil {
+		slog.Error("Failed to record export result", "id", export.ID.Hex(), "error", err)
+	}
+}
+
+// Get returns an export, or nil if it doesn't exist or has expired. An export
+// still running past exportTimeout is reported as failed: the replica building
+// it went away.
+func (e *Exporter) Get(ctx context.Context, id primitive.ObjectID) (*domain.RecordingExport, error) {
+	export, err := e.exportRepo.GetRecordingExport(ctx, id)
+	if err != nil || export == nil {
+		return nil, err
+	}
+	if time.Now().After(export.ExpiresAt) {
+		return nil, nil
+	}
+	if export.State == domain.RecordingExportRunning && time.Since(export.CreatedAt) > exportTimeout {
+		export.State, export.Error = domain.RecordingExportFailed, "export was interrupted"
+	}
+	return export, nil
+}
+
+// deleteExpired removes expired exports and their ZIPs.
+func (e *Exporter) deleteExpired(ctx context.Context) {
+	exports, err := e.exportRepo.ListExpiredRecordingExports(ctx, time.Now(), expiredExportBatch)
+	if err != nil {
+		slog.Error("Failed to list expired exports", "error", err)
+		return
+	}
+
+	for _, export := range exports {
+		if err := e.store.Delete(ctx, export.Key); err != nil {
+			slog.Error("Failed to delete expired export", "id", export.ID.Hex(), "key", export.Key, "error", err)
+			continue
+		}
+		if err := e.exportRepo.DeleteRecordingExport(ctx, export.ID); err != nil {
+			slog.Error("Failed to delete expired export", "id", export.ID.Hex(), "error", err)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package tasks
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Rafin000/call-recording-service-v2/internal/common"
+	"github.com/Rafin000/call-recording-service-v2/internal/domain"
+	"github.com/Rafin000/call-recording-service-v2/internal/infra/storage"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestWriteZIP(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewFilesystemStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	xdrs := &memXDRs{xdrs: make(map[int64]domain.XDR)}
+
+	// Four calls of 10 bytes under a 15 byte cap: archived but gone from the
+	// store, archived, not archived, and archived but past the cap
+	for i, status := range []string{ManifestMissing, ManifestArchived, ManifestNotArchived, ManifestOverSizeCap} {
+		iXDR := int64(i + 1)
+		xdr := domain.XDR{IXDR: iXDR, ICustomer: 1001, UnixConnectTime: testDay.Add(time.Duration(iXDR) * time.Hour).Unix()}
+		if status != ManifestNotArchived {
+			key := fmt.Sprintf("default/1001/2026-01-10/recording_%d.wav", iXDR)
+			xdr.Archive = &domain.XDRArchive{S3Key: key, Size: 10, SHA256: "sum"}
+			if status != ManifestMissing {
+				if _, err := store.Put(ctx, key, strings.NewReader(fmt.Sprintf("recording%d", iXDR)), storage.PutOptions{}); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		xdrs.xdrs[iXDR] = xdr
+	}
+
+	exporter := NewExporter(xdrs, nil, store, common.ExportConfig{MaxBytes: 15})
+	var buf bytes.Buffer
+	if err := exporter.WriteZIP(ctx, &buf, ExportFilter{ICustomer: 1001, From: testDay, To: testDay.Add(24 * time.Hour)}); err != nil {
+		t.Fatalf("WriteZIP: %v", err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("invalid ZIP: %v", err)
+	}
+	if len(archive.File) != 2 || archive.File[0].Name != "2026-01-10/recording_2.wav" || archive.File[1].Name != manifestName {
+		var names []string
+		for _, file := range archive.File {
+			names = append(names, file.Name)
+		}
+		t.Fatalf("got entries %v, want the one recording and the manifest", names)
+	}
+	if got := readZIPEntry(t, archive.File[0]); got != "recording2" {
+		t.Errorf("got recording %q, want %q", got, "recording2")
+	}
+
+	rows, err := csv.NewReader(strings.NewReader(readZIPEntry(t, archive.File[1]))).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid manifest: %v", err)
+	}
+	want := [][]string{
+		{"1", ManifestMissing, "", "", ""},
+		{"2", ManifestArchived, "2026-01-10/recording_2.wav", "10", "sum"},
+		{"3", ManifestNotArchived, "", "", ""},
+		{"4", ManifestOverSizeCap, "", "", ""},
+	}
+	if len(rows) != len(want)+1 || strings.Join(rows[0], ",") != strings.Join(manifestHeader, ",") {
+		t.Fatalf("got manifest %v, want a header and %d rows", rows, len(want))
+	}
+	for i, row := range rows[1:] {
+		got := []string{row[0], row[12], row[13], row[14], row[15]}
+		if strings.Join(got, ",") != strings.Join(want[i], ",") {
+			t.Errorf("manifest row %d: got %v, want %v", i+1, got, want[i])
+		}
+	}
+}
+
+func TestStartExport(t *testing.T) {
+	ctx := context.Background()
+	exports := &memExports{exports: make(map[primitive.ObjectID]domain.RecordingExport)}
+	store := &blockingStore{release: make(chan struct{})}
+	exporter := NewExporter(&memXDRs{xdrs: make(map[int64]domain.XDR)}, exports, store, common.ExportConfig{MaxConcurrent: 1})
+	january := ExportFilter{ICustomer: 1001, From: testDay, To: testDay.AddDate(0, 0, 30)}
+	february := ExportFilter{ICustomer: 1001, From: testDay.AddDate(0, 1, 0), To: testDay.AddDate(0, 1, 27)}
+	summary := &domain.XDRSummary{XDRs: 1}
+
+	first, err := exporter.Start(ctx, january, summary, "")
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	again, err := exporter.Start(ctx, january, summary, "")
+	if err != nil || again.ID != first.ID {
+		t.Fatalf("starting the same download again got %v, %v; want export %s", again, err, first.ID.Hex())
+	}
+	if _, err := exporter.Start(ctx, february, summary, ""); !errors.Is(err, ErrExportBusy) {
+		t.Fatalf("starting another download past the cap got %v, want ErrExportBusy", err)
+	}
+
+	// Once the first export is built there is room for another
+	close(store.release)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, err = exporter.Start(ctx, february, summary, "")
+		if !errors.Is(err, ErrExportBusy) || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("starting another download after the first finished got %v", err)
+	}
+	if got := exports.get(first.ID); got.State != domain.RecordingExportReady {
+		t.Errorf("first export is %s, want %s", got.State, domain.RecordingExportReady)
+	}
+}
+
+// blockingStore takes uploads, holding each until release is closed.
+type blockingStore struct {
+	storage.RecordingStore
+	release chan struct{}
+}
+
+func (s *blockingStore) Put(ctx context.Context, key string, body io.Reader, opts storage.PutOptions) (*storage.ObjectInfo, error) {
+	<-s.release
+	n, err := io.Copy(io.Discard, body)
+	if err != nil {
+		return nil, err
+	}
+	return &storage.ObjectInfo{Size: n}, nil
+}
+
+type memExports struct {
+	domain.RecordingExportRepository
+	mu      sync.Mutex
+	exports map[primitive.ObjectID]domain.RecordingExport
+}
+
+func (m *memExports) get(id primitive.ObjectID) domain.RecordingExport {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.exports[id]
+}
+
+func (m *memExports) CreateRecordingExport(ctx context.Context, export domain.RecordingExport) (primitive.ObjectID, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.exports[export.ID] = export
+	return export.ID, nil
+}
+
+func (m *memExports) FindRunningRecordingExport(ctx context.Context, iCustomer int, from, to, createdAfter time.Time) (*domain.RecordingExport, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, export := range m.exports {
+		if export.ICustomer == iCustomer && export.FromDate.Equal(from) && export.ToDate.Equal(to) &&
+			export.State == domain.RecordingExportRunning && export.CreatedAt.After(createdAfter) {
+			return &export, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *memExports) FinishRecordingExport(ctx context.Context, id primitive.ObjectID, state string, size int64, errMessage string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	export := m.exports[id]
+	export.State, export.Size, export.Error, export.ExpiresAt = state, size, errMessage, expiresAt
+	m.exports[id] = export
+	return nil
+}
+
+func (m *memExports) ListExpiredRecordingExports(ctx context.Context, now time.Time, limit int) ([]domain.RecordingExport, error) {
+	return nil, nil
+}
+
+func readZIPEntry(t *testing.T, file *zip.File) string {
+	t.Helper()
+
+	r, err := file.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
@@ -0,0 +1,460 @@
+package tasks
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Rafin000/call-recording-service-v2/internal/common"
+	"github.com/Rafin000/call-recording-service-v2/internal/domain"
+	"github.com/Rafin000/call-recording-service-v2/internal/infra/portaone"
+	"github.com/Rafin000/call-recording-service-v2/internal/infra/storage"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memXDRs keeps the archive state of xdr_list in memory, for XDRs of a single
+// instance. Methods the backup doesn't use are left to the embedded nil
+// interface.
+type memXDRs struct {
+	domain.XDRRepository
+
+	mu   sync.Mutex
+	xdrs map[int64]domain.XDR
+}
+
+func (r *memXDRs) UpsertXDR(ctx context.Context, xdr domain.XDR) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	xdr.Archive = r.xdrs[xdr.IXDR].Archive
+	r.xdrs[xdr.IXDR] = xdr
+	return nil
+}
+
+func (r *memXDRs) MarkXDRArchived(ctx context.Context, instance string, iXDR int64, archive domain.XDRArchive) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	xdr := r.xdrs[iXDR]
+	xdr.Archive = &archive
+	r.xdrs[iXDR] = xdr
+	return nil
+}
+
+func (r *memXDRs) GetXDRArchive(ctx context.Context, instance string, iXDR int64) (*domain.XDRArchive, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.xdrs[iXDR].Archive, nil
+}
+
+func (r *memXDRs) GetXDR(ctx context.Context, instance string, iXDR int64) (*domain.XDR, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	xdr, ok := r.xdrs[iXDR]
+	if !ok {
+		return nil, nil
+	}
+	return &xdr, nil
+}
+
+func (r *memXDRs) ListXDRs(ctx context.Context, iCustomer int, fromDateUnix, toDateUnix int64, limit int) ([]domain.XDR, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var xdrs []domain.XDR
+	for _, xdr := range r.xdrs {
+		if xdr.ICustomer == iCustomer && xdr.UnixConnectTime >= fromDateUnix && xdr.UnixConnectTime <= toDateUnix {
+			xdrs = append(xdrs, xdr)
+		}
+	}
+	sort.Slice(xdrs, func(i, j int) bool { return xdrs[i].UnixConnectTime < xdrs[j].UnixConnectTime })
+	return xdrs, nil
+}
+
+func (r *memXDRs) archived(iXDR int64) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.xdrs[iXDR].Archive != nil
+}
+
+// memRuns is an in-memory BackupRunRepository.
+type memRuns struct {
+	mu   sync.Mutex
+	runs map[primitive.ObjectID]*domain.BackupRun
+	xdrs map[primitive.ObjectID]map[int64]*domain.BackupRunXDR
+}
+
+func newMemRuns() *memRuns {
+	return &memRuns{runs: make(map[primitive.ObjectID]*domain.BackupRun), xdrs: make(map[primitive.ObjectID]map[int64]*domain.BackupRunXDR)}
+}
+
+func (r *memRuns) CreateBackupRun(ctx context.Context, run domain.BackupRun) (primitive.ObjectID, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	run.ID = primitive.NewObjectID()
+	r.runs[run.ID] = &run
+	return run.ID, nil
+}
+
+func (r *memRuns) GetBackupRun(ctx context.Context, id primitive.ObjectID) (*domain.BackupRun, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	run, ok := r.runs[id]
+	if !ok {
+		return nil, nil
+	}
+	copied := *run
+	copied.Customers = make(map[string]domain.BackupRunCustomer, len(run.Customers))
+	for iCustomer, customer := range run.Customers {
+		copied.Customers[iCustomer] = customer
+	}
+	return &copied, nil
+}
+
+func (r *memRuns) FindLatestBackupRun(ctx context.Context, startTime, endTime, scope string) (*domain.BackupRun, error) {
+	r.mu.Lock()
+	var latest *domain.BackupRun
+	for _, run := range r.runs {
+		if run.StartTime != startTime || run.EndTime != endTime || run.Scope != scope || run.State == domain.BackupRunAbandoned {
+			continue
+		}
+		if latest == nil || run.StartedAt.After(latest.StartedAt) {
+			latest = run
+		}
+	}
+	r.mu.Unlock()
+
+	if latest == nil {
+		return nil, nil
+	}
+	return r.GetBackupRun(ctx, latest.ID)
+}
+
+func (r *memRuns) ListBackupRuns(ctx context.Context, limit int) ([]domain.BackupRun, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var runs []domain.BackupRun
+	for _, run := range r.runs {
+		runs = append(runs, *run)
+	}
+	return runs, nil
+}
+
+func (r *memRuns) SetBackupRunCustomerState(ctx context.Context, id primitive.ObjectID, iCustomer, state string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	run := r.runs[id]
+	customer := run.Customers[iCustomer]
+	customer.State, customer.UpdatedAt = state, time.Now()
+	run.Customers[iCustomer] = customer
+	run.UpdatedAt = time.Now()
+	return nil
+}
+
+func (r *memRuns) SetBackupRunState(ctx context.Context, id primitive.ObjectID, state string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	run := r.runs[id]
+	run.State, run.UpdatedAt, run.FinishedAt = state, now, &now
+	return nil
+}
+
+func (r *memRuns) ResumeBackupRun(ctx context.Context, id primitive.ObjectID, customers map[string]domain.BackupRunCustomer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	run := r.runs[id]
+	for iCustomer, customer := range customers {
+		run.Customers[iCustomer] = customer
+	}
+	run.State, run.UpdatedAt, run.FinishedAt = domain.BackupRunRunning, time.Now(), nil
+	run.Attempts++
+	return nil
+}
+
+func (r *memRuns) ReopenBackupRun(ctx context.Context, id primitive.ObjectID, customers map[string]domain.BackupRunCustomer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	run := r.runs[id]
+	for iCustomer, customer := range customers {
+		run.Customers[iCustomer] = customer
+	}
+	run.State, run.UpdatedAt, run.FinishedAt = domain.BackupRunRunning, time.Now(), nil
+	run.Attempts = 1
+	return nil
+}
+
+func (r *memRuns) TouchBackupRun(ctx context.Context, id primitive.ObjectID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.runs[id].UpdatedAt = time.Now()
+	return nil
+}
+
+func (r *memRuns) AddBackupRunXDR(ctx context.Context, item domain.BackupRunXDR) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.xdrs[item.RunID] == nil {
+		r.xdrs[item.RunID] = make(map[int64]*domain.BackupRunXDR)
+	}
+	if _, ok := r.xdrs[item.RunID][item.IXDR]; !ok {
+		r.xdrs[item.RunID][item.IXDR] = &item
+	}
+	return nil
+}
+
+func (r *memRuns) SetBackupRunXDRState(ctx context.Context, id primitive.ObjectID, iXDR int64, state, errMessage string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if item, ok := r.xdrs[id][iXDR]; ok {
+		item.State, item.Error, item.UpdatedAt = state, errMessage, time.Now()
+	}
+	return nil
+}
+
+func (r *memRuns) ListBackupRunXDRs(ctx context.Context, id primitive.ObjectID, iCustomer *int, states []string, limit int) ([]domain.BackupRunXDR, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var items []domain.BackupRunXDR
+	for _, item := range r.xdrs[id] {
+		if iCustomer != nil && item.ICustomer != *iCustomer {
+			continue
+		}
+		for _, state := range states {
+			if item.State == state {
+				items = append(items, *item)
+				break
+			}
+		}
+	}
+	return items, nil
+}
+
+func (r *memRuns) CountBackupRunXDRs(ctx context.Context, id primitive.ObjectID) (map[string]int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	counts := make(map[string]int)
+	for _, item := range r.xdrs[id] {
+		counts[item.State]++
+	}
+	return counts, nil
+}
+
+func (r *memRuns) DeleteBackupRunXDRs(ctx context.Context, id primitive.ObjectID, states []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for iXDR, item := range r.xdrs[id] {
+		for _, state := range states {
+			if item.State == state {
+				delete(r.xdrs[id], iXDR)
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func (r *memRuns) xdrState(id primitive.ObjectID, iXDR int64) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if item, ok := r.xdrs[id][iXDR]; ok {
+		return item.State
+	}
+	return ""
+}
+
+// memRetries is an in-memory RecordingRetryRepository.
+type memRetries struct {
+	mu      sync.Mutex
+	retries map[int64]domain.RecordingRetry
+}
+
+func (r *memRetries) EnqueueRecordingRetry(ctx context.Context, retry domain.RecordingRetry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.retries[retry.IXDR]; ok {
+		existing.LastError, existing.UpdatedAt = retry.LastError, retry.UpdatedAt
+		retry = existing
+	}
+	r.retries[retry.IXDR] = retry
+	return nil
+}
+
+func (r *memRetries) GetRecordingRetry(ctx context.Context, iXDR int64) (*domain.RecordingRetry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	retry, ok := r.retries[iXDR]
+	if !ok {
+		return nil, nil
+	}
+	return &retry, nil
+}
+
+func (r *memRetries) ListDueRecordingRetries(ctx context.Context, now time.Time, limit int) ([]domain.RecordingRetry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var due []domain.RecordingRetry
+	for _, retry := range r.retries {
+		if retry.State == domain.RecordingRetryPending && !retry.NextAttemptAt.After(now) {
+			due = append(due, retry)
+		}
+	}
+	return due, nil
+}
+
+func (r *memRetries) ListRecordingRetries(ctx context.Context, state string, page, pageSize int) ([]domain.RecordingRetry, int64, error) {
+	return nil, 0, nil
+}
+
+func (r *memRetries) RecordRetryAttempt(ctx context.Context, iXDR int64, state string, attempts int, nextAttemptAt time.Time, lastError string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	retry := r.retries[iXDR]
+	retry.State, retry.Attempts, retry.NextAttemptAt, retry.LastError = state, attempts, nextAttemptAt, lastError
+	r.retries[iXDR] = retry
+	return nil
+}
+
+func (r *memRetries) RequeueRecordingRetry(ctx context.Context, iXDR int64) (bool, error) {
+	return false, nil
+}
+
+func (r *memRetries) DeleteRecordingRetry(ctx context.Context, iXDR int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.retries, iXDR)
+	return nil
+}
+
+// fakePortaOne is a single PortaOne instance serving the calls added to it,
+// standing in for both the registry and its client. Methods the backup
+// doesn't use are left to the embedded nil interface.
+type fakePortaOne struct {
+	portaone.PortaOneClient
+
+	mu    sync.Mutex
+	xdrs  map[int][]portaone.XDR
+	calls map[string]int
+	// recordingErr fails GetCallRecording recordingErrTimes times, or every
+	// time if that is 0.
+	recordingErr      error
+	recordingErrTimes int
+}
+
+func (p *fakePortaOne) Name() string { return common.PortaOneDefaultInstance }
+
+func (p *fakePortaOne) Default() portaone.PortaOneClient { return p }
+
+func (p *fakePortaOne) Client(instance string) (portaone.PortaOneClient, error) { return p, nil }
+
+func (p *fakePortaOne) Resolve(instance string, iCustomer string) (portaone.PortaOneClient, error) {
+	return p, nil
+}
+
+func (p *fakePortaOne) Instances() []string { return []string{common.PortaOneDefaultInstance} }
+
+func (p *fakePortaOne) ForEachCustomerXDR(ctx context.Context, req portaone.GetCustomerXDRsRequest, fn func(portaone.XDR) error) error {
+	from, _ := time.Parse("2006-01-02 15:04:05", req.FromDate)
+	to, _ := time.Parse("2006-01-02 15:04:05", req.ToDate)
+
+	p.mu.Lock()
+	p.calls["Customer/get_customer_xdrs"]++
+	var xdrs []portaone.XDR
+	for _, xdr := range p.xdrs[req.ICustomer] {
+		if xdr.UnixConnectTime >= from.Unix() && xdr.UnixConnectTime <= to.Unix() {
+			xdrs = append(xdrs, xdr)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, xdr := range xdrs {
+		if err := fn(xdr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *fakePortaOne) GetCallRecording(ctx context.Context, req portaone.GetCallRecordingRequest) (*portaone.CallRecording, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls["CDR/get_call_recording"]++
+
+	if p.recordingErr != nil {
+		err := p.recordingErr
+		if p.recordingErrTimes > 0 {
+			if p.recordingErrTimes--; p.recordingErrTimes == 0 {
+				p.recordingErr = nil
+			}
+		}
+		return nil, err
+	}
+
+	for _, xdrs := range p.xdrs {
+		for _, xdr := range xdrs {
+			if xdr.IXDR == req.IXDR {
+				data := silentWAV()
+				return &portaone.CallRecording{Body: io.NopCloser(bytes.NewReader(data)), ContentType: "audio/wav", ContentLength: int64(len(data))}, nil
+			}
+		}
+	}
+	return nil, &portaone.APIError{Method: "CDR/get_call_recording", StatusCode: 500, FaultCode: "Server.CDR.xdr_not_found", FaultString: "XDR not found"}
+}
+
+func (p *fakePortaOne) callCount(method string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.calls[method]
+}
+
+// silentWAV is a second of 8 kHz 16-bit mono silence.
+func silentWAV() []byte {
+	const dataSize = 16000
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(36+dataSize))
+	buf.WriteString("WAVEfmt ")
+	_ = binary.Write(&buf, binary.LittleEndian, []interface{}{uint32(16), uint16(1), uint16(1), uint32(8000), uint32(16000), uint16(2), uint16(16)})
+	buf.WriteString("data")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(dataSize))
+	buf.Write(make([]byte, dataSize))
+	return buf.Bytes()
+}
+
+// testBackup is a Backup wired to in-memory repositories, a filesystem store
+// and a fake PortaOne.
+type testBackup struct {
+	*Backup
+	portaOne *fakePortaOne
+	xdrs     *memXDRs
+	runs     *memRuns
+	retries  *memRetries
+}
+
+func newTestBackup(t *testing.T) *testBackup {
+	t.Helper()
+
+	tb := &testBackup{
+		portaOne: &fakePortaOne{xdrs: make(map[int][]portaone.XDR), calls: make(map[string]int)},
+		xdrs:     &memXDRs{xdrs: make(map[int64]domain.XDR)},
+		runs:     newMemRuns(),
+		retries:  &memRetries{retries: make(map[int64]domain.RecordingRetry)},
+	}
+
+	store, err := storage.NewFilesystemStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tb.Backup = NewBackup(nil, tb.xdrs, tb.runs, tb.retries, nil, store, tb.portaOne, common.BackupConfig{})
+	return tb
+}
+
+// addCall adds a call of customer 1001 with a recording.
+func (tb *testBackup) addCall(iXDR int64, connect time.Time) {
+	tb.portaOne.mu.Lock()
+	defer tb.portaOne.mu.Unlock()
+	tb.portaOne.xdrs[1001] = append(tb.portaOne.xdrs[1001], portaone.XDR{IXDR: iXDR, UnixConnectTime: connect.Unix(), ChargedQuantity: 1})
+}
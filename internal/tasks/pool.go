@@ -0,0 +1,75 @@
+package tasks
+
+import (
+	"context"
+	"sync"
+)
+
+// workerPool bounds how many items run at once, both overall and within each
+// group (one group per customer), so a single large customer cannot take
+// every worker.
+type workerPool struct {
+	global   chan struct{}
+	perGroup int
+}
+
+func newWorkerPool(workers, perGroup int) *workerPool {
+	if workers < 1 {
+		workers = 1
+	}
+	if perGroup < 1 || perGroup > workers {
+		perGroup = workers
+	}
+	return &workerPool{
+		global:   make(chan struct{}, workers),
+		perGroup: perGroup,
+	}
+}
+
+// Group returns a new group sharing the pool's global limit.
+func (p *workerPool) Group() *poolGroup {
+	return &poolGroup{
+		pool: p,
+		sem:  make(chan struct{}, p.perGroup),
+	}
+}
+
+type poolGroup struct {
+	pool *workerPool
+	sem  chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Go waits for a free slot in the group and in the pool, then runs fn in a
+// new goroutine. It returns ctx.Err() without running fn if ctx is done first.
+func (g *poolGroup) Go(ctx context.Context, fn func()) error {
+	select {
+	case g.sem <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case g.pool.global <- struct{}{}:
+	case <-ctx.Done():
+		<-g.sem
+		return ctx.Err()
+	}
+
+	g.wg.Add(1)
+	go func() {
+		defer func() {
+			<-g.pool.global
+			<-g.sem
+			g.wg.Done()
+		}()
+		fn()
+	}()
+
+	return nil
+}
+
+// Wait blocks until every fn started by the group has returned.
+func (g *poolGroup) Wait() {
+	g.wg.Wait()
+}
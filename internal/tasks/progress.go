@@ -0,0 +1,54 @@
+package tasks
+
+import "sync"
+
+// Progress lets whoever started a job watch it while it runs: the step it is
+// on and a snapshot of its counters. A nil *Progress ignores updates, so jobs
+// report unconditionally.
+type Progress struct {
+	mu    sync.Mutex
+	step  string
+	stats func() any
+}
+
+// ProgressSnapshot is the state of a job at one point in time.
+type ProgressSnapshot struct {
+	Step  string `json:"step,omitempty"`
+	Stats any    `json:"stats,omitempty"`
+}
+
+// SetStep records what the job is working on.
+func (p *Progress) SetStep(step string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.step = step
+}
+
+// SetStats registers the function that snapshots the job's counters. It must
+// be safe to call while the job runs.
+func (p *Progress) SetStats(stats func() any) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stats = stats
+}
+
+// Snapshot returns the current step and counters.
+func (p *Progress) Snapshot() ProgressSnapshot {
+	if p == nil {
+		return ProgressSnapshot{}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	snapshot := ProgressSnapshot{Step: p.step}
+	if p.stats != nil {
+		snapshot.Stats = p.stats()
+	}
+	return snapshot
+}
@@ -0,0 +1,174 @@
+package tasks
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/Rafin000/call-recording-service-v2/internal/domain"
+	"github.com/Rafin000/call-recording-service-v2/internal/infra/portaone"
+)
+
+const (
+	defaultRetryMaxAttempts    = 8
+	defaultRetryInitialBackoff = 5 * time.Minute
+	defaultRetryMaxBackoff     = 6 * time.Hour
+
+	// retryBatchSize bounds how many due retries one pass picks up.
+	retryBatchSize = 500
+)
+
+// isQueued reports whether a recording is in the retry queue, pending or dead.
+func (b *Backup) isQueued(ctx context.Context, iXDR int64) bool {
+	retry, err := b.retryRepo.GetRecordingRetry(ctx, iXDR)
+	if err != nil {
+		slog.Error("Failed to look up recording retry", "i_xdr", iXDR, "error", err)
+		return false
+	}
+	return retry != nil
+}
+
+// enqueueRetry hands a recording that failed to archive to the retry queue,
+// counting the failure as its first attempt. It reports whether it was queued.
+func (b *Backup) enqueueRetry(ctx context.Context, instance string, iCustomer int, date string, iXDR int64, cause error) bool {
+	now := time.Now()
+	retry := domain.RecordingRetry{
+		IXDR:          iXDR,
+		ICustomer:     iCustomer,
+		Instance:      instance,
+		Date:          date,
+		State:         domain.RecordingRetryPending,
+		Attempts:      1,
+		LastError:     cause.Error(),
+		NextAttemptAt: now.Add(b.retryBackoff(1)),
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if err := b.retryRepo.EnqueueRecordingRetry(context.WithoutCancel(ctx), retry); err != nil {
+		slog.Error("Failed to queue recording for retry", "i_xdr", iXDR, "error", err)
+		return false
+	}
+	return true
+}
+
+// retryBackoff is the wait after the given number of failed attempts: the
+// initial backoff, doubled per further attempt, up to the maximum.
+func (b *Backup) retryBackoff(attempts int) time.Duration {
+	backoff := b.retry.InitialBackoff
+	for i := 1; i < attempts && backoff < b.retry.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, b.retry.MaxBackoff)
+}
+
+// RetryStats counts what a pass over the retry queue did.
+type RetryStats struct {
+	Due         int64 `json:"due"`
+	Archived    int64 `json:"archived"`
+	Rescheduled int64 `json:"rescheduled"`
+	Dead        int64 `json:"dead"`
+}
+
+// retryStats is the concurrency-safe counterpart of RetryStats.
+type retryStats struct {
+	due         int64
+	archived    atomic.Int64
+	rescheduled atomic.Int64
+	dead        atomic.Int64
+}
+
+func (s *retryStats) snapshot() RetryStats {
+	return RetryStats{
+		Due:         s.due,
+		Archived:    s.archived.Load(),
+		Rescheduled: s.rescheduled.Load(),
+		Dead:        s.dead.Load(),
+	}
+}
+
+// RetryRecordings retries the recordings in the queue whose next attempt is
+// due. A recording that fails again is rescheduled with a longer backoff, or
+// marked dead once it has used up its attempts. Failures caused by an
+// unavailable PortaOne instance don't use up an attempt.
+func (b *Backup) RetryRecordings(ctx context.Context, progress *Progress) {
+	retries, err := b.retryRepo.ListDueRecordingRetries(ctx, time.Now(), retryBatchSize)
+	if err != nil {
+		slog.Error("Failed to list due recording retries", "error", err)
+		return
+	}
+	if len(retries) == 0 {
+		return
+	}
+
+	slog.Info("Retrying failed recordings", "due", len(retries))
+	started := time.Now()
+
+	pool := newWorkerPool(b.workers, b.perCustomerWorkers)
+	groups := make(map[int]*poolGroup)
+	stats := &retryStats{due: int64(len(retries))}
+	progress.SetStats(func() any { return stats.snapshot() })
+
+	for _, retry := range retries {
+		group, ok := groups[retry.ICustomer]
+		if !ok {
+			group = pool.Group()
+			groups[retry.ICustomer] = group
+		}
+		retry := retry
+		if err := group.Go(ctx, func() { b.retryRecording(ctx, retry, stats) }); err != nil {
+			break
+		}
+	}
+	for _, group := range groups {
+		group.Wait()
+	}
+
+	slog.Info("Recording retries finished", "due", len(retries), "archived", stats.archived.Load(),
+		"rescheduled", stats.rescheduled.Load(), "dead", stats.dead.Load(),
+		"duration", time.Since(started), "cancelled", ctx.Err() != nil)
+}
+
+func (b *Backup) retryRecording(ctx context.Context, retry domain.RecordingRetry, stats *retryStats) {
+	portaOneClient, err := b.portaOne.Resolve(retry.Instance, strconv.Itoa(retry.ICustomer))
+	if err == nil && !isArchived(ctx, b.xdrRepo, b.store, portaOneClient.Name(), retry.IXDR) {
+		err = b.archiveRecording(ctx, portaOneClient, retry.ICustomer, retry.Date, retry.IXDR)
+	}
+
+	// Left due, so the next pass picks it up again
+	if ctx.Err() != nil {
+		return
+	}
+
+	if err == nil {
+		stats.archived.Add(1)
+		slog.Info("Archived recording on retry", "i_xdr", retry.IXDR, "attempts", retry.Attempts+1)
+		if err := b.retryRepo.DeleteRecordingRetry(ctx, retry.IXDR); err != nil {
+			slog.Error("Failed to remove recording retry", "i_xdr", retry.IXDR, "error", err)
+		}
+		return
+	}
+
+	attempts, state, next := retry.Attempts, domain.RecordingRetryPending, time.Now()
+	switch {
+	case portaone.IsUnavailable(err):
+		next = next.Add(b.retry.InitialBackoff)
+		stats.rescheduled.Add(1)
+		slog.Warn("PortaOne unavailable, rescheduling recording retry", "i_xdr", retry.IXDR, "error", err)
+	case attempts+1 >= b.retry.MaxAttempts:
+		attempts++
+		state = domain.RecordingRetryDead
+		stats.dead.Add(1)
+		slog.Error("Recording failed permanently", "i_xdr", retry.IXDR, "attempts", attempts, "error", err)
+	default:
+		attempts++
+		next = next.Add(b.retryBackoff(attempts))
+		stats.rescheduled.Add(1)
+		slog.Warn("Recording retry failed", "i_xdr", retry.IXDR, "attempts", attempts, "nextAttemptAt", next, "error", err)
+	}
+
+	if err := b.retryRepo.RecordRetryAttempt(ctx, retry.IXDR, state, attempts, next, err.Error()); err != nil {
+		slog.Error("Failed to record recording retry", "i_xdr", retry.IXDR, "error", err)
+	}
+}
@@ -0,0 +1,146 @@
+package tasks
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Rafin000/call-recording-service-v2/internal/common"
+	"github.com/Rafin000/call-recording-service-v2/internal/domain"
+	"github.com/Rafin000/call-recording-service-v2/internal/infra/portaone"
+	"github.com/Rafin000/call-recording-service-v2/internal/infra/resilience"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	b := &Backup{retry: common.RetryConfig{InitialBackoff: 5 * time.Minute, MaxBackoff: time.Hour}}
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: 5 * time.Minute},
+		{attempts: 2, want: 10 * time.Minute},
+		{attempts: 4, want: 40 * time.Minute},
+		{attempts: 5, want: time.Hour},
+		{attempts: 50, want: time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := b.retryBackoff(tt.attempts); got != tt.want {
+			t.Errorf("retryBackoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestRetryRecordings(t *testing.T) {
+	tests := []struct {
+		name     string
+		iXDR     int64
+		attempts int
+		fault    error
+		// wantState is the state left in the queue, empty if it was removed.
+		wantState    string
+		wantAttempts int
+		wantArchived bool
+	}{
+		{name: "archived on retry", iXDR: 1, attempts: 1, wantArchived: true},
+		{name: "fails again", iXDR: 404, attempts: 2, wantState: domain.RecordingRetryPending, wantAttempts: 3},
+		{name: "runs out of attempts", iXDR: 404, attempts: defaultRetryMaxAttempts - 1, wantState: domain.RecordingRetryDead, wantAttempts: defaultRetryMaxAttempts},
+		{
+			name: "PortaOne unavailable", iXDR: 1, attempts: 2,
+			fault:     resilience.ErrCircuitOpen,
+			wantState: domain.RecordingRetryPending, wantAttempts: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tb := newTestBackup(t)
+			tb.addCall(1, testDay.Add(time.Hour))
+			if tt.fault != nil {
+				tb.portaOne.recordingErr = tt.fault
+			}
+			tb.retries.retries[tt.iXDR] = domain.RecordingRetry{
+				IXDR:          tt.iXDR,
+				ICustomer:     1001,
+				Date:          testDay.Format("2006-01-02"),
+				State:         domain.RecordingRetryPending,
+				Attempts:      tt.attempts,
+				NextAttemptAt: time.Now().Add(-time.Minute),
+			}
+
+			started := time.Now()
+			tb.RetryRecordings(context.Background(), nil)
+
+			if got := tb.xdrs.archived(tt.iXDR); got != tt.wantArchived {
+				t.Errorf("archived %v, want %v", got, tt.wantArchived)
+			}
+
+			retry, _ := tb.retries.GetRecordingRetry(context.Background(), tt.iXDR)
+			if tt.wantState == "" {
+				if retry != nil {
+					t.Fatalf("left %+v in the queue, want it removed", retry)
+				}
+				return
+			}
+			if retry == nil {
+				t.Fatalf("removed from the queue, want %s", tt.wantState)
+			}
+			if retry.State != tt.wantState || retry.Attempts != tt.wantAttempts {
+				t.Errorf("left %s after %d attempts, want %s after %d", retry.State, retry.Attempts, tt.wantState, tt.wantAttempts)
+			}
+			if retry.State == domain.RecordingRetryPending {
+				wantNext := started.Add(tb.retryBackoff(tt.wantAttempts))
+				if tt.fault != nil {
+					wantNext = started.Add(tb.retry.InitialBackoff)
+				}
+				if diff := retry.NextAttemptAt.Sub(wantNext); diff < 0 || diff > time.Minute {
+					t.Errorf("next attempt at %v, want about %v", retry.NextAttemptAt, wantNext)
+				}
+			}
+		})
+	}
+}
+
+func TestRunQueuesFailedRecordings(t *testing.T) {
+	tb := newTestBackup(t)
+	for i := int64(1); i <= 3; i++ {
+		tb.addCall(i, testDay.Add(time.Duration(i)*time.Hour))
+	}
+	tb.portaOne.recordingErr = &portaone.APIError{Method: "CDR/get_call_recording", StatusCode: 500, FaultCode: "Server.CDR.failed", FaultString: "Recording unavailable"}
+	tb.portaOne.recordingErrTimes = 1
+	ctx := context.Background()
+
+	stats := &runStats{}
+	tb.run(ctx, dayWindow(testDay), scopeAll, []backupCustomer{{ICustomer: "1001"}}, false, stats)
+
+	if got := stats.snapshot(); got.Archived != 2 || got.Failed != 1 || got.Queued != 1 {
+		t.Fatalf("got %+v, want 2 archived and 1 failed and queued", got)
+	}
+	due, _ := tb.retries.ListDueRecordingRetries(ctx, time.Now().Add(tb.retry.InitialBackoff), 0)
+	if len(due) != 1 || due[0].Attempts != 1 {
+		t.Fatalf("queued %+v, want one recording after its first attempt", due)
+	}
+	queued := due[0].IXDR
+
+	// The queued recording doesn't hold the run open
+	runs, _ := tb.runs.ListBackupRuns(ctx, 0)
+	if len(runs) != 1 || runs[0].State != domain.BackupRunCompleted {
+		t.Fatalf("got runs %+v, want one completed", runs)
+	}
+	if got := tb.runs.xdrState(runs[0].ID, queued); got != domain.BackupXDRQueued {
+		t.Errorf("XDR %d is %q in the run, want queued", queued, got)
+	}
+
+	retry := tb.retries.retries[queued]
+	retry.NextAttemptAt = time.Now()
+	tb.retries.retries[queued] = retry
+	tb.RetryRecordings(ctx, nil)
+
+	if !tb.xdrs.archived(queued) {
+		t.Errorf("XDR %d not archived on retry", queued)
+	}
+	if retry, _ := tb.retries.GetRecordingRetry(ctx, queued); retry != nil {
+		t.Errorf("left %+v in the queue, want it removed", retry)
+	}
+}
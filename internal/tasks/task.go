@@ -2,43 +2,431 @@ package tasks
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Rafin000/call-recording-service-v2/internal/common"
 	"github.com/Rafin000/call-recording-service-v2/internal/domain"
 	"github.com/Rafin000/call-recording-service-v2/internal/infra/portaone"
+	"github.com/Rafin000/call-recording-service-v2/internal/infra/storage"
+	"github.com/Rafin000/call-recording-service-v2/internal/utils"
 )
 
-func BackupTask(
-	userRepo domain.UserRepository,
-	XDRRepo domain.XDRRepository,
-	ctx context.Context,
-	cfg common.AppSettings,
-	portaOneClient portaone.PortaOneClient,
-) {
-	customers := iCustomerList(userRepo, ctx)
+const (
+	defaultBackupWorkers            = 8
+	defaultBackupPerCustomerWorkers = 2
+)
+
+// errInstanceUnavailable stops queuing work for a PortaOne instance that is down.
+var errInstanceUnavailable = errors.New("PortaOne instance unavailable")
+
+// Backup archives the call recordings of every customer from PortaOne to S3.
+type Backup struct {
+	userRepo           domain.UserRepository
+	xdrRepo            domain.XDRRepository
+	runRepo            domain.BackupRunRepository
+	retryRepo          domain.RecordingRetryRepository
+	backfillRepo       domain.BackfillRepository
+	store              storage.RecordingStore
+	portaOne           portaone.Registry
+	workers            int
+	perCustomerWorkers int
+	retry              common.RetryConfig
+
+	backfillMu sync.Mutex
+	backfills  map[string]*Backfill
+}
+
+// NewBackup creates a Backup, filling unset concurrency and retry limits with
+// defaults.
+func NewBackup(userRepo domain.UserRepository, xdrRepo domain.XDRRepository, runRepo domain.BackupRunRepository, retryRepo domain.RecordingRetryRepository, backfillRepo domain.BackfillRepository, store storage.RecordingStore, portaOne portaone.Registry, backupCfg common.BackupConfig) *Backup {
+	b := &Backup{
+		userRepo:           userRepo,
+		xdrRepo:            xdrRepo,
+		runRepo:            runRepo,
+		retryRepo:          retryRepo,
+		backfillRepo:       backfillRepo,
+		store:              store,
+		portaOne:           portaOne,
+		workers:            backupCfg.Workers,
+		perCustomerWorkers: backupCfg.PerCustomerWorkers,
+		retry:              backupCfg.Retry,
+		backfills:          make(map[string]*Backfill),
+	}
+	if b.workers <= 0 {
+		b.workers = defaultBackupWorkers
+	}
+	if b.perCustomerWorkers <= 0 {
+		b.perCustomerWorkers = defaultBackupPerCustomerWorkers
+	}
+	if b.retry.MaxAttempts <= 0 {
+		b.retry.MaxAttempts = defaultRetryMaxAttempts
+	}
+	if b.retry.InitialBackoff <= 0 {
+		b.retry.InitialBackoff = defaultRetryInitialBackoff
+	}
+	if b.retry.MaxBackoff <= 0 {
+		b.retry.MaxBackoff = defaultRetryMaxBackoff
+	}
+	return b
+}
 
-	fmt.Println("*********************ENTERED BACKUP TASK**************")
+// backupWindow is the PortaOne time range a run asks for, and the date its
+// recordings are filed under in S3. end is when the window closes; until then
+// new calls can still show up in it.
+type backupWindow struct {
+	startTime string
+	endTime   string
+	date      string
+	end       time.Time
+}
 
-	currentTime := time.Now().UTC()
-	previousTime := currentTime.Add(-24 * time.Hour)
+// dayWindow covers one whole calendar day, starting at day, midnight in its
+// location.
+func dayWindow(day time.Time) backupWindow {
+	return backupWindow{
+		startTime: day.Format("2006-01-02") + " 00:00:00",
+		endTime:   day.Format("2006-01-02") + " 23:59:59",
+		date:      day.Format("2006-01-02"),
+		end:       time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, day.Location()),
+	}
+}
 
-	fmt.Println("*********************Current time:", currentTime)
-	fmt.Println("*********************Previous time (24 hours ago):", previousTime)
+// startOfDay returns midnight in location of the calendar day t falls on there.
+func startOfDay(t time.Time, location *time.Location) time.Time {
+	t = t.In(location)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, location)
+}
 
-	previousTimeAdjusted := previousTime.Add(12 * time.Hour)
+// BackupStats counts what a run did with the XDRs it saw.
+type BackupStats struct {
+	XDRs     int64 `json:"xdrs"`
+	Archived int64 `json:"archived"`
+	Skipped  int64 `json:"skipped"`
+	Pending  int64 `json:"pending"`
+	Failed   int64 `json:"failed"`
+	Queued   int64 `json:"queued"`
+}
+
+// runStats is the concurrency-safe counterpart of BackupStats.
+type runStats struct {
+	xdrs     atomic.Int64
+	archived atomic.Int64
+	skipped  atomic.Int64
+	pending  atomic.Int64
+	failed   atomic.Int64
+	queued   atomic.Int64
+}
 
-	startTimeStr := previousTimeAdjusted.Format("2006-01-02 00:00:00")
-	endTimeAdjusted := previousTimeAdjusted.Add(24 * time.Hour).Add(-time.Second)
-	endTimeStr := endTimeAdjusted.Format("2006-01-02 15:04:05")
+func (s *runStats) snapshot() BackupStats {
+	return BackupStats{
+		XDRs:     s.xdrs.Load(),
+		Archived: s.archived.Load(),
+		Skipped:  s.skipped.Load(),
+		Pending:  s.pending.Load(),
+		Failed:   s.failed.Load(),
+		Queued:   s.queued.Load(),
+	}
+}
 
-	fmt.Println("Start Time:", startTimeStr)
-	fmt.Println("End Time:", endTimeStr)
-	dateString := previousTimeAdjusted.Format("2006-01-02")
+// backupRun holds the state shared by the workers of one run.
+type backupRun struct {
+	pool       *workerPool
+	window     backupWindow
+	dryRun     bool
+	stats      *runStats
+	checkpoint *checkpoint
 
+	mu          sync.Mutex
+	unavailable map[portaone.PortaOneClient]bool
+}
+
+func (r *backupRun) isUnavailable(client portaone.PortaOneClient) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.unavailable[client]
+}
+
+func (r *backupRun) markUnavailable(client portaone.PortaOneClient) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.unavailable[client] = true
+}
+
+// Run backs up every customer over the whole days in location that overlap the
+// last lookback, oldest first, reporting the day it is on to progress.
+// Cancelling ctx stops queuing recordings and aborts the ones in flight.
+func (b *Backup) Run(ctx context.Context, lookback time.Duration, location *time.Location, progress *Progress) {
+	now := time.Now().In(location)
+	customers := iCustomerList(b.userRepo, ctx)
+
+	stats := &runStats{}
+	progress.SetStats(func() any { return stats.snapshot() })
+
+	for day := startOfDay(now.Add(-lookback), location); !day.After(now) && ctx.Err() == nil; day = day.AddDate(0, 0, 1) {
+		window := dayWindow(day)
+		progress.SetStep(window.date)
+		b.run(ctx, window, scopeAll, customers, false, stats)
+	}
+}
+
+// run backs up one window for the given customers, counting into stats.
+// Progress is checkpointed in backup_runs, and an earlier run over the same
+// window and scope is resumed rather than started over. With dryRun set
+// nothing is written; XDRs that would be archived are counted as pending.
+// It reports false if it skipped the window because another process is
+// backing it up or a completed run already covered it.
+func (b *Backup) run(ctx context.Context, window backupWindow, scope string, customers []backupCustomer, dryRun bool, stats *runStats) bool {
+	run := &backupRun{
+		pool:        newWorkerPool(b.workers, b.perCustomerWorkers),
+		window:      window,
+		dryRun:      dryRun,
+		stats:       stats,
+		unavailable: make(map[portaone.PortaOneClient]bool),
+	}
+	if !dryRun {
+		var ok bool
+		run.checkpoint, customers, ok = startCheckpoint(ctx, b.runRepo, window, scope, customers)
+		if !ok {
+			return false
+		}
+	}
+
+	slog.Info("Starting backup", "customers", len(customers), "startTime", window.startTime, "endTime", window.endTime, "dryRun", dryRun)
+	started := time.Now()
+
+	var wg sync.WaitGroup
 	for _, customer := range customers {
-		xdrList := GetXDRList(customer, startTimeStr, endTimeStr, portaOneClient, ctx)
-		DownloadRecordings(xdrList, customer, dateString, cfg, portaOneClient, ctx, XDRRepo)
+		wg.Add(1)
+		go func(customer backupCustomer) {
+			defer wg.Done()
+			b.backupCustomer(ctx, run, customer)
+		}(customer)
+	}
+	wg.Wait()
+
+	run.checkpoint.finish(ctx)
+
+	slog.Info("Backup finished", "customers", len(customers), "duration", time.Since(started), "cancelled", ctx.Err() != nil)
+	return true
+}
+
+// backupCustomer archives a customer's recordings. A customer whose XDRs were
+// fully listed by an earlier attempt of the run only has its unfinished XDRs
+// retried; otherwise its XDRs are paged through and each is handed to the pool.
+func (b *Backup) backupCustomer(ctx context.Context, run *backupRun, customer backupCustomer) {
+	state := run.checkpoint.customerState(customer.ICustomer)
+	if state == domain.BackupCustomerDone || state == domain.BackupCustomerFailed {
+		return
+	}
+
+	// Neither of these is going to get better by trying again, so the customer
+	// is failed rather than left to hold the run open
+	portaOneClient, err := b.portaOne.Resolve(customer.Instance, customer.ICustomer)
+	if err != nil {
+		slog.Error("No PortaOne instance for customer, skipping", "iCustomer", customer.ICustomer, "instance", customer.Instance, "error", err)
+		run.checkpoint.setCustomerState(ctx, customer.ICustomer, domain.BackupCustomerFailed)
+		return
+	}
+	if run.isUnavailable(portaOneClient) {
+		return
+	}
+	instance := portaOneClient.Name()
+
+	iCustomer, err := strconv.Atoi(customer.ICustomer)
+	if err != nil {
+		slog.Error("Error converting iCustomer to integer", "iCustomer", customer.ICustomer, "error", err)
+		run.checkpoint.setCustomerState(ctx, customer.ICustomer, domain.BackupCustomerFailed)
+		return
+	}
+
+	group := run.pool.Group()
+	queued := 0
+	var failed atomic.Int64
+
+	if state == domain.BackupCustomerListed {
+		var items []domain.BackupRunXDR
+		items, err = run.checkpoint.unfinishedXDRs(ctx, iCustomer)
+		for _, item := range items {
+			if run.isUnavailable(portaOneClient) {
+				err = errInstanceUnavailable
+				break
+			}
+			queued++
+			run.stats.xdrs.Add(1)
+			iXDR := item.IXDR
+			if err = group.Go(ctx, func() {
+				if !b.archiveXDR(ctx, run, portaOneClient, instance, iCustomer, iXDR) {
+					failed.Add(1)
+				}
+			}); err != nil {
+				break
+			}
+		}
+	} else {
+		run.checkpoint.setCustomerState(ctx, customer.ICustomer, domain.BackupCustomerListing)
+		err = portaOneClient.ForEachCustomerXDR(ctx, portaone.GetCustomerXDRsRequest{
+			ICustomer:     iCustomer,
+			FromDate:      run.window.startTime,
+			ToDate:        run.window.endTime,
+			BillingModel:  1,
+			CallRecording: 1,
+		}, func(xdr portaone.XDR) error {
+			if run.isUnavailable(portaOneClient) {
+				return errInstanceUnavailable
+			}
+			queued++
+			run.checkpoint.addXDR(ctx, iCustomer, xdr.IXDR)
+			return group.Go(ctx, func() {
+				if !b.backupXDR(ctx, run, portaOneClient, instance, iCustomer, xdr) {
+					failed.Add(1)
+				}
+			})
+		})
+		if err == nil {
+			run.checkpoint.setCustomerState(ctx, customer.ICustomer, domain.BackupCustomerListed)
+		}
+	}
+	group.Wait()
+
+	if err == nil && failed.Load() == 0 {
+		run.checkpoint.setCustomerState(ctx, customer.ICustomer, domain.BackupCustomerDone)
+	}
+
+	switch {
+	case portaone.IsUnavailable(err) || errors.Is(err, errInstanceUnavailable):
+		run.markUnavailable(portaOneClient)
+		slog.Warn("PortaOne unavailable, leaving remaining recordings for the next run", "iCustomer", iCustomer, "error", err)
+	case err != nil:
+		slog.Error("Backup of customer stopped", "iCustomer", iCustomer, "queued", queued, "error", err)
+	default:
+		slog.Info("Backup of customer finished", "iCustomer", iCustomer, "recordings", queued, "failed", failed.Load())
+	}
+}
+
+// backupXDR saves an XDR of the named instance and archives its recording
+// unless that was already done. It reports whether the recording is now archived (or, in a dry run,
+// whether it could be checked).
+func (b *Backup) backupXDR(ctx context.Context, run *backupRun, portaOneClient portaone.PortaOneClient, instance string, iCustomer int, xdr portaone.XDR) bool {
+	run.stats.xdrs.Add(1)
+
+	if run.dryRun {
+		if isArchived(ctx, b.xdrRepo, b.store, instance, xdr.IXDR) {
+			run.stats.skipped.Add(1)
+		} else {
+			run.stats.pending.Add(1)
+		}
+		return true
+	}
+
+	// Keep the metadata even if the recording can't be archived this time
+	if err := b.xdrRepo.UpsertXDR(ctx, toDomainXDR(instance, iCustomer, xdr)); err != nil {
+		slog.Error("Failed to save XDR", "i_xdr", xdr.IXDR, "error", err)
+	}
+
+	return b.archiveXDR(ctx, run, portaOneClient, instance, iCustomer, xdr.IXDR)
+}
+
+// archiveXDR archives the recording of an XDR unless that was already done,
+// and checkpoints the outcome. A recording that fails is handed to the retry
+// queue, which then owns it; later runs leave it alone. It reports whether the
+// recording is archived or queued.
+func (b *Backup) archiveXDR(ctx context.Context, run *backupRun, portaOneClient portaone.PortaOneClient, instance string, iCustomer int, iXDR int64) bool {
+	if isArchived(ctx, b.xdrRepo, b.store, instance, iXDR) {
+		slog.Debug("Recording already archived, skipping", "i_xdr", iXDR)
+		run.stats.skipped.Add(1)
+		run.checkpoint.setXDRState(ctx, iXDR, domain.BackupXDRSkipped, nil)
+		return true
+	}
+
+	if b.isQueued(ctx, iXDR) {
+		slog.Debug("Recording is in the retry queue, skipping", "i_xdr", iXDR)
+		run.stats.queued.Add(1)
+		run.checkpoint.setXDRState(ctx, iXDR, domain.BackupXDRQueued, nil)
+		return true
+	}
+
+	err := b.archiveRecording(ctx, portaOneClient, iCustomer, run.window.date, iXDR)
+	if portaone.IsUnavailable(err) {
+		run.markUnavailable(portaOneClient)
+	}
+	if err != nil {
+		run.stats.failed.Add(1)
+		slog.Error("Failed to archive recording", "i_xdr", iXDR, "error", err)
+
+		// A cancelled run is resumed from its checkpoint instead
+		if ctx.Err() == nil && b.enqueueRetry(ctx, instance, iCustomer, run.window.date, iXDR, err) {
+			run.stats.queued.Add(1)
+			run.checkpoint.setXDRState(ctx, iXDR, domain.BackupXDRQueued, err)
+			return true
+		}
+		run.checkpoint.setXDRState(ctx, iXDR, domain.BackupXDRFailed, err)
+		return false
+	}
+
+	run.stats.archived.Add(1)
+	run.checkpoint.setXDRState(ctx, iXDR, domain.BackupXDRArchived, nil)
+	return true
+}
+
+// archiveRecording streams one recording from PortaOne to the store, hashing
+// it on the way, and records the archive in xdr_list along with the audio
+// metadata from its WAV header. Recordings are stored under the name of the
+// instance they came from, since i_xdr and i_customer are only unique within
+// one instance. Nothing is written to local disk by the S3 store and memory
+// use is bounded by its part size.
+func (b *Backup) archiveRecording(ctx context.Context, portaOneClient portaone.PortaOneClient, iCustomer int, date string, iXDR int64) error {
+	recording, err := portaOneClient.GetCallRecording(ctx, portaone.GetCallRecordingRequest{IXDR: iXDR})
+	if err != nil {
+		return err
+	}
+	defer recording.Body.Close()
+
+	instance := portaOneClient.Name()
+	header := &headerBuffer{limit: utils.MaxWAVHeaderSize}
+	key := fmt.Sprintf("%s/%d/%s/recording_%d.wav", instance, iCustomer, date, iXDR)
+	stored, err := b.store.Put(ctx, key, io.TeeReader(recording.Body, header), storage.PutOptions{ContentType: recording.ContentType})
+	if err != nil {
+		return fmt.Errorf("failed to archive recording: %w", err)
+	}
+
+	archive := domain.XDRArchive{
+		S3Key:      key,
+		Size:       stored.Size,
+		SHA256:     stored.SHA256,
+		UploadedAt: time.Now(),
+		Audio:      b.inspectRecording(ctx, instance, iXDR, header.Bytes(), stored.Size),
+	}
+	if err := b.xdrRepo.MarkXDRArchived(ctx, instance, iXDR, archive); err != nil {
+		return fmt.Errorf("failed to record archived recording: %w", err)
+	}
+
+	return nil
+}
+
+// inspectRecording reads the audio metadata of a freshly archived recording.
+// A recording that can't be read is archived all the same, without it.
+func (b *Backup) inspectRecording(ctx context.Context, instance string, iXDR int64, header []byte, size int64) *domain.RecordingAudio {
+	xdr, err := b.xdrRepo.GetXDR(ctx, instance, iXDR)
+	if err != nil {
+		slog.Error("Failed to get XDR to check recording duration", "i_xdr", iXDR, "error", err)
+	}
+
+	audio, err := recordingAudio(header, size, xdr)
+	if err != nil {
+		slog.Warn("Failed to read recording audio metadata", "i_xdr", iXDR, "error", err)
+		return nil
+	}
+	if len(audio.DurationMismatch) > 0 {
+		slog.Warn("Recording duration does not match its XDR", "i_xdr", iXDR, "duration", audio.Duration,
+			"mismatch", audio.DurationMismatch, "charged_quantity", xdr.ChargedQuantity,
+			"call_duration", xdr.UnixDisconnectTime-xdr.UnixConnectTime)
 	}
+	return audio
 }
@@ -0,0 +1,24 @@
+package tasks
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Rafin000/call-recording-service-v2/internal/common"
+)
+
+func TestRunKeysXDRsOnInstance(t *testing.T) {
+	tb := newTestBackup(t)
+	tb.addCall(1, testDay.Add(time.Hour))
+
+	tb.run(context.Background(), dayWindow(testDay), scopeAll, []backupCustomer{{ICustomer: "1001"}}, false, &runStats{})
+
+	xdr := tb.xdrs.xdrs[1]
+	if xdr.Instance != common.PortaOneDefaultInstance {
+		t.Errorf("saved the XDR for instance %q, want %q", xdr.Instance, common.PortaOneDefaultInstance)
+	}
+	if want := "default/1001/2026-01-10/recording_1.wav"; xdr.Archive == nil || xdr.Archive.S3Key != want {
+		t.Errorf("archived the recording as %+v, want it at %s", xdr.Archive, want)
+	}
+}
@@ -1,28 +1,23 @@
 package tasks
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
-	"fmt"
-	"io"
 	"log/slog"
-	"net/http"
-	"os"
-	"path/filepath"
-	"strconv"
 
-	"github.com/Rafin000/call-recording-service-v2/internal/common"
 	"github.com/Rafin000/call-recording-service-v2/internal/domain"
 	"github.com/Rafin000/call-recording-service-v2/internal/infra/portaone"
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/credentials"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/Rafin000/call-recording-service-v2/internal/infra/storage"
 )
 
+// backupCustomer is a customer to back up and the PortaOne instance it lives on.
+type backupCustomer struct {
+	ICustomer string
+	Instance  string
+}
+
 // Function to get the list of i_customer
-func iCustomerList(userRepo domain.UserRepository, ctx context.Context) []string {
-	var iCustomers []string
+func iCustomerList(userRepo domain.UserRepository, ctx context.Context) []backupCustomer {
+	var iCustomers []backupCustomer
 	users, err := userRepo.GetAllUsersWithICustomer(ctx)
 	if err != nil {
 		slog.Error("Error fetching users with i_customer", "error", err)
@@ -31,240 +26,67 @@ func iCustomerList(userRepo domain.UserRepository, ctx context.Context) []string
 
 	for _, user := range users {
 		if user.ICustomer != nil && *user.ICustomer != "" {
-			iCustomers = append(iCustomers, *user.ICustomer)
+			iCustomers = append(iCustomers, backupCustomer{ICustomer: *user.ICustomer, Instance: user.PortaOneInstance})
 		}
 	}
 	return iCustomers
 }
 
-// GetXDRList fetches the XDR list for a given customer within a time range.
-func GetXDRList(iCustomer string, startTime string, endTime string, portaOneClient portaone.PortaOneClient, ctx context.Context) []map[string]interface{} {
-	slog.Info("***********************ENTERED GETXDRList******************")
-	slog.Info("Fetching XDR list", "iCustomer", iCustomer, "startTime", startTime, "endTime", endTime)
-
-	// Convert iCustomer to an integer
-	iCustomerInt, err := strconv.Atoi(iCustomer)
-	if err != nil {
-		slog.Error("Error converting iCustomer to integer", "error", err)
-		return nil
-	}
-	slog.Debug("Converted iCustomer to integer", "iCustomerInt", iCustomerInt)
-
-	// Get session ID
-	sessionID, _ := portaOneClient.GetSessionID(ctx)
-	slog.Debug("Session ID retrieved", "sessionID", sessionID)
-
-	// Prepare the request data
-	authInfo := map[string]string{"session_id": sessionID}
-	params := map[string]interface{}{
-		"billing_model":  1,
-		"call_recording": 1,
-		"from_date":      startTime,
-		"i_customer":     iCustomerInt,
-		"to_date":        endTime,
-	}
-
-	// Log the prepared parameters
-	slog.Debug("Request parameters", "params", params)
-
-	data := map[string]string{
-		"auth_info": mustJSON(authInfo),
-		"params":    mustJSON(params),
-	}
-
-	// Encode data as form-urlencoded
-	reqBody := EncodeFormData(data)
-	slog.Debug("Encoded request body", "reqBody", reqBody)
-
-	// Make the HTTP request
-	xdrURL := "https://pbwebsrv.intercloud.com.bd/rest/Customer/get_customer_xdrs"
-	req, err := http.NewRequest("POST", xdrURL, bytes.NewBufferString(reqBody))
-	if err != nil {
-		slog.Error("Error creating request", "error", err)
-		return nil
-	}
-	slog.Debug("Request created successfully", "xdrURL", xdrURL)
-
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		slog.Error("Error making request", "error", err)
-		return nil
-	}
-	defer resp.Body.Close()
-
-	slog.Debug("Response received", "statusCode", resp.StatusCode)
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		slog.Error("Error response from server", "status", resp.Status, "responseBody", string(body))
-		return nil
-	}
-
-	// Parse response JSON
-	var result map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		slog.Error("Error decoding JSON response", "error", err)
-		return nil
-	}
-	slog.Debug("Response decoded successfully", "result", result)
-
-	// Extract XDR list
-	if xdrList, ok := result["xdr_list"].([]map[string]interface{}); ok {
-		slog.Debug("XDR list successfully extracted", "xdrList", xdrList)
-		return xdrList
-	}
-
-	slog.Debug("XDR list not found in response")
-	return nil
-}
-
-// mustJSON marshals a value to JSON and returns it as a string.
-func mustJSON(data interface{}) string {
-	jsonData, err := json.Marshal(data)
+// isArchived reports whether the recording of an XDR of the named instance is
+// recorded as archived in xdr_list, was not flagged by the verifier, and the
+// object is still in the store with the recorded size.
+func isArchived(ctx context.Context, xdrRepo domain.XDRRepository, store storage.RecordingStore, instance string, iXDR int64) bool {
+	archive, err := xdrRepo.GetXDRArchive(ctx, instance, iXDR)
 	if err != nil {
-		slog.Error("Error marshaling JSON", "error", err)
-		return "{}"
-	}
-	return string(jsonData)
-}
-
-// EncodeFormData encodes a map[string]string into a form-urlencoded string.
-func EncodeFormData(data map[string]string) string {
-	form := ""
-	for key, value := range data {
-		form += fmt.Sprintf("%s=%s&", key, value)
+		slog.Error("Failed to look up archived recording", "i_xdr", iXDR, "error", err)
+		return false
 	}
-	return form[:len(form)-1] // Remove trailing '&'
-}
-
-func DownloadRecordings(xdrList []map[string]interface{}, iCustomer string, dateString string, cfg common.AppSettings, portaOneClient portaone.PortaOneClient, ctx context.Context, xdrRepo domain.XDRRepository) {
-	slog.Info("***********************ENTERED DOWNLOAD RECORDINGS******************")
-	recordingURL := "https://pbwebsrv.intercloud.com.bd/rest/CDR/get_call_recording"
-
-	// Create recordings directory if it doesn't exist
-	saveDirectory := filepath.Join(".", "recordings")
-	if err := os.MkdirAll(saveDirectory, 0755); err != nil {
-		slog.Error("Failed to create recordings directory", "error", err)
-		return
+	if archive == nil {
+		return false
 	}
-
-	s3Client := createS3Client(cfg)
-
-	for _, xdr := range xdrList {
-		sessionID, err := portaOneClient.GetSessionID(ctx)
-		if err != nil {
-			slog.Error("Failed to sign in to PortaOne", "error", err)
-			continue
-		}
-
-		// Prepare recording request data
-		recordingData := map[string]string{
-			"auth_info": fmt.Sprintf(`{"session_id": "%s"}`, sessionID),
-			"params":    fmt.Sprintf(`{"i_xdr": %v}`, xdr["i_xdr"]),
-		}
-
-		// Encode data as form-urlencoded
-		reqBody := EncodeFormData(recordingData)
-
-		// Make the HTTP request to fetch the recording
-		req, err := http.NewRequest("POST", recordingURL, bytes.NewBufferString(reqBody))
-		if err != nil {
-			slog.Error("Error creating request", "error", err)
-			continue
-		}
-		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-
-		client := &http.Client{}
-		resp, err := client.Do(req)
-		if err != nil {
-			slog.Error("Error making request", "error", err)
-			continue
-		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != http.StatusOK {
-			slog.Error("Error response from server", "status", resp.Status)
-			continue
-		}
-
-		// Read the recording into memory
-		var audioBuffer bytes.Buffer
-		if _, err := io.Copy(&audioBuffer, resp.Body); err != nil {
-			slog.Error("Failed to read recording response", "error", err)
-			continue
-		}
-
-		// Save the recording locally
-		iXDR := fmt.Sprintf("%v", xdr["i_xdr"])
-		filename := fmt.Sprintf("recording_%s.wav", iXDR)
-		filepath := filepath.Join(saveDirectory, filename)
-
-		if err := os.WriteFile(filepath, audioBuffer.Bytes(), 0644); err != nil {
-			slog.Error("Failed to write recording to file", "error", err)
-			continue
-		}
-
-		// Upload to S3
-		s3Key := fmt.Sprintf("%s/%s/%s", iCustomer, dateString, filename)
-		if success := uploadToS3(ctx, s3Client, filepath, cfg.S3_BUCKET_NAME, s3Key); success {
-			// Remove local file after successful upload
-			if err := os.Remove(filepath); err != nil {
-				slog.Error("Failed to remove local file", "error", err, "filepath", filepath)
-			} else {
-				slog.Info("Removed local file", "filepath", filepath)
-			}
-		} else {
-			slog.Error("Failed to upload recording to S3", "filepath", filepath)
-		}
+	if archive.Integrity != "" && archive.Integrity != domain.IntegrityOK {
+		slog.Warn("Archived recording failed verification, archiving again", "i_xdr", iXDR, "integrity", archive.Integrity)
+		return false
 	}
-}
 
-func uploadToS3(ctx context.Context, client *s3.Client, filePath, bucketName, s3Key string) bool {
-	file, err := os.Open(filePath)
+	info, err := store.Stat(ctx, archive.S3Key)
 	if err != nil {
-		slog.Error("Failed to open file for S3 upload", "error", err)
+		slog.Warn("Archived recording missing from storage, archiving again", "i_xdr", iXDR, "key", archive.S3Key, "error", err)
 		return false
 	}
-	defer file.Close()
-
-	// Create S3 upload input
-	input := &s3.PutObjectInput{
-		Bucket: aws.String(bucketName),
-		Key:    aws.String(s3Key),
-		Body:   file,
-	}
 
-	// Upload to S3
-	_, err = client.PutObject(ctx, input)
-	if err != nil {
-		slog.Error("Failed to upload to S3", "error", err, "bucket", bucketName, "key", s3Key)
+	if info.Size != archive.Size {
+		slog.Warn("Archived recording size mismatch, archiving again", "i_xdr", iXDR, "key", archive.S3Key,
+			"expected", archive.Size, "actual", info.Size)
 		return false
 	}
 
-	slog.Info("Uploaded file to S3", "filepath", filePath, "bucket", bucketName, "key", s3Key)
 	return true
 }
 
-func createS3Client(cfg common.AppSettings) *s3.Client {
-	// Custom endpoint resolver for S3
-	customResolver := aws.EndpointResolverWithOptionsFunc(func(service, region string, options ...interface{}) (aws.Endpoint, error) {
-		return aws.Endpoint{
-			URL: cfg.S3_ENDPOINT_URL,
-		}, nil
-	})
-
-	// AWS configuration setup
-	awsCfg := aws.Config{
-		Credentials: credentials.NewStaticCredentialsProvider(
-			cfg.AWS_ACCESS_KEY,
-			cfg.AWS_SECRET_ACCESS_KEY,
-			"",
-		),
-		EndpointResolverWithOptions: customResolver,
+// toDomainXDR converts a PortaOne XDR of the named instance into the record
+// stored in xdr_list.
+func toDomainXDR(instance string, iCustomer int, xdr portaone.XDR) domain.XDR {
+	return domain.XDR{
+		Instance:           instance,
+		IXDR:               xdr.IXDR,
+		ICustomer:          iCustomer,
+		IAccount:           xdr.IAccount,
+		AccountID:          xdr.AccountID,
+		CLI:                xdr.CLI,
+		CLD:                xdr.CLD,
+		ConnectTime:        xdr.ConnectTime,
+		DisconnectTime:     xdr.DisconnectTime,
+		UnixConnectTime:    xdr.UnixConnectTime,
+		UnixDisconnectTime: xdr.UnixDisconnectTime,
+		ChargedAmount:      xdr.ChargedAmount,
+		ChargedQuantity:    xdr.ChargedQuantity,
+		IService:           xdr.IService,
+		IDest:              xdr.IDest,
+		Country:            xdr.Country,
+		Subdivision:        xdr.Subdivision,
+		Description:        xdr.Description,
+		BillStatus:         xdr.BillStatus,
+		H323ConfID:         xdr.H323ConfID,
 	}
-
-	return s3.NewFromConfig(awsCfg)
 }
@@ -0,0 +1,177 @@
+package tasks
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Rafin000/call-recording-service-v2/internal/common"
+	"github.com/Rafin000/call-recording-service-v2/internal/domain"
+	"github.com/Rafin000/call-recording-service-v2/internal/infra/storage"
+)
+
+const (
+	defaultVerifyBatchSize     = 1000
+	defaultVerifyReverifyAfter = 30 * 24 * time.Hour
+)
+
+// Verifier re-reads archived recordings and checks them against the size and
+// SHA-256 recorded when they were uploaded.
+type Verifier struct {
+	xdrRepo       domain.XDRRepository
+	reportRepo    domain.IntegrityReportRepository
+	store         storage.RecordingStore
+	workers       int
+	batchSize     int
+	reverifyAfter time.Duration
+}
+
+// NewVerifier creates a Verifier, filling unset limits with defaults.
+func NewVerifier(xdrRepo domain.XDRRepository, reportRepo domain.IntegrityReportRepository, store storage.RecordingStore, backupCfg common.BackupConfig) *Verifier {
+	v := &Verifier{
+		xdrRepo:       xdrRepo,
+		reportRepo:    reportRepo,
+		store:         store,
+		workers:       backupCfg.Workers,
+		batchSize:     backupCfg.Verify.BatchSize,
+		reverifyAfter: backupCfg.Verify.ReverifyAfter,
+	}
+	if v.workers <= 0 {
+		v.workers = defaultBackupWorkers
+	}
+	if v.batchSize <= 0 {
+		v.batchSize = defaultVerifyBatchSize
+	}
+	if v.reverifyAfter <= 0 {
+		v.reverifyAfter = defaultVerifyReverifyAfter
+	}
+	return v
+}
+
+// VerifyStats counts what a verification run has checked so far.
+type VerifyStats struct {
+	Total   int `json:"total"`
+	Checked int `json:"checked"`
+	OK      int `json:"ok"`
+	Errors  int `json:"errors"`
+	Issues  int `json:"issues"`
+}
+
+// Run verifies up to one batch of archived recordings that are due and stores
+// an integrity report listing every missing or mismatched object. A batchSize
+// of zero uses the configured one.
+func (v *Verifier) Run(ctx context.Context, batchSize int, progress *Progress) {
+	if batchSize <= 0 {
+		batchSize = v.batchSize
+	}
+	report := domain.IntegrityReport{StartedAt: time.Now()}
+
+	xdrs, err := v.xdrRepo.ListXDRsToVerify(ctx, report.StartedAt.Add(-v.reverifyAfter), batchSize)
+	if err != nil {
+		slog.Error("Failed to list recordings to verify", "error", err)
+		return
+	}
+
+	var mu sync.Mutex
+	progress.SetStats(func() any {
+		mu.Lock()
+		defer mu.Unlock()
+		return VerifyStats{Total: len(xdrs), Checked: report.Checked, OK: report.OK, Errors: report.Errors, Issues: len(report.Issues)}
+	})
+
+	group := newWorkerPool(v.workers, v.workers).Group()
+	for _, xdr := range xdrs {
+		err := group.Go(ctx, func() {
+			issue, err := v.verify(ctx, xdr)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checked++
+			switch {
+			case err != nil:
+				report.Errors++
+				slog.Error("Failed to verify archived recording", "i_xdr", xdr.IXDR, "error", err)
+			case issue != nil:
+				report.Issues = append(report.Issues, *issue)
+				slog.Warn("Archived recording failed verification", "i_xdr", xdr.IXDR, "key", issue.S3Key, "problem", issue.Problem)
+			default:
+				report.OK++
+			}
+		})
+		if err != nil {
+			break
+		}
+	}
+	group.Wait()
+
+	report.FinishedAt = time.Now()
+	// Save the report even if the run was cancelled part way
+	if err := v.reportRepo.CreateIntegrityReport(context.WithoutCancel(ctx), report); err != nil {
+		slog.Error("Failed to save integrity report", "error", err)
+	}
+
+	slog.Info("Integrity verification finished", "checked", report.Checked, "ok", report.OK,
+		"issues", len(report.Issues), "errors", report.Errors, "duration", report.FinishedAt.Sub(report.StartedAt))
+}
+
+// verify checks one archived recording. It returns an issue when the object is
+// missing or differs from what was uploaded, and an error when the check itself
+// could not be completed.
+func (v *Verifier) verify(ctx context.Context, xdr domain.XDR) (*domain.IntegrityIssue, error) {
+	archive := xdr.Archive
+	issue := &domain.IntegrityIssue{IXDR: xdr.IXDR, ICustomer: xdr.ICustomer, S3Key: archive.S3Key}
+
+	object, err := v.store.Get(ctx, archive.S3Key, nil)
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			return nil, fmt.Errorf("failed to read archived recording: %w", err)
+		}
+		issue.Problem = domain.IntegrityMissing
+		v.record(ctx, xdr.Instance, xdr.IXDR, issue.Problem)
+		return issue, nil
+	}
+	defer object.Body.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, object.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archived recording: %w", err)
+	}
+	checksum := hex.EncodeToString(hash.Sum(nil))
+
+	switch {
+	case size != archive.Size:
+		issue.Problem = domain.IntegritySizeMismatch
+		issue.Expected = strconv.FormatInt(archive.Size, 10)
+		issue.Actual = strconv.FormatInt(size, 10)
+	case checksum != archive.SHA256:
+		issue.Problem = domain.IntegrityChecksumMismatch
+		issue.Expected = archive.SHA256
+		issue.Actual = checksum
+	case object.SHA256 != "" && object.SHA256 != archive.SHA256:
+		// The object matches xdr_list but not its own metadata
+		issue.Problem = domain.IntegrityChecksumMismatch
+		issue.Expected = object.SHA256
+		issue.Actual = checksum
+	default:
+		v.record(ctx, xdr.Instance, xdr.IXDR, domain.IntegrityOK)
+		return nil, nil
+	}
+
+	v.record(ctx, xdr.Instance, xdr.IXDR, issue.Problem)
+	return issue, nil
+}
+
+// record flags the XDR with the outcome so the backup re-archives bad copies.
+// A failure is logged by the repository and the XDR is simply checked again
+// on a later run.
+func (v *Verifier) record(ctx context.Context, instance string, iXDR int64, integrity string) {
+	_ = v.xdrRepo.SetXDRIntegrity(ctx, instance, iXDR, integrity, time.Now())
+}
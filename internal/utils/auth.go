@@ -9,10 +9,11 @@ import (
 )
 
 type JWTClaims struct {
-	Email     string  `json:"email"`
-	Role      string  `json:"role"`
-	Name      string  `json:"name"`
-	ICustomer *string `json:"i_customer,omitempty"`
+	Email            string  `json:"email"`
+	Role             string  `json:"role"`
+	Name             string  `json:"name"`
+	ICustomer        *string `json:"i_customer,omitempty"`
+	PortaOneInstance string  `json:"portaone_instance,omitempty"`
 	jwt.StandardClaims
 }
 
@@ -38,10 +39,11 @@ func DecodeAuthToken(token string, config common.AppConfig) (*JWTClaims, error)
 
 func GenerateAccessToken(payloads map[string]interface{}, config common.AppConfig) (string, error) {
 	claims := &JWTClaims{
-		Email:     payloads["email"].(string),
-		Role:      payloads["role"].(string),
-		Name:      payloads["name"].(string),
-		ICustomer: payloads["i_customer"].(*string),
+		Email:            payloads["email"].(string),
+		Role:             payloads["role"].(string),
+		Name:             payloads["name"].(string),
+		ICustomer:        payloads["i_customer"].(*string),
+		PortaOneInstance: portaOneInstanceFromPayloads(payloads),
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: time.Now().Add(24 * time.Hour).Unix(),
 			IssuedAt:  time.Now().Unix(),
@@ -53,10 +55,11 @@ func GenerateAccessToken(payloads map[string]interface{}, config common.AppConfi
 
 func GenerateRefreshToken(payloads map[string]interface{}, config common.AppConfig) (string, error) {
 	claims := &JWTClaims{
-		Email:     payloads["email"].(string),
-		Role:      payloads["role"].(string),
-		Name:      payloads["name"].(string),
-		ICustomer: payloads["i_customer"].(*string),
+		Email:            payloads["email"].(string),
+		Role:             payloads["role"].(string),
+		Name:             payloads["name"].(string),
+		ICustomer:        payloads["i_customer"].(*string),
+		PortaOneInstance: portaOneInstanceFromPayloads(payloads),
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: time.Now().Add(24 * time.Hour).Unix(),
 			IssuedAt:  time.Now().Unix(),
@@ -65,3 +68,9 @@ func GenerateRefreshToken(payloads map[string]interface{}, config common.AppConf
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(config.App.SECRET_KEY))
 }
+
+// portaOneInstanceFromPayloads reads the optional portaone_instance payload.
+func portaOneInstanceFromPayloads(payloads map[string]interface{}) string {
+	instance, _ := payloads["portaone_instance"].(string)
+	return instance
+}
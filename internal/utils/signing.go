@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Rafin000/call-recording-service-v2/internal/common"
+)
+
+// Errors returned when verifying a signed link.
+var (
+	ErrLinkInvalid = errors.New("invalid")
+	ErrLinkExpired = errors.New("expired")
+)
+
+// PlaybackClaims are what a signed playback URL grants: one recording, served
+// for the given customer and PortaOne instance, until Expires.
+type PlaybackClaims struct {
+	IXDR      int64
+	ICustomer int
+	Instance  string
+	Expires   int64
+}
+
+// SignPlayback returns the HMAC-SHA256 signature of the claims under SECRET_KEY.
+func SignPlayback(claims PlaybackClaims, config common.AppConfig) string {
+	return sign(config, "playback", claims.IXDR, claims.ICustomer, claims.Instance, claims.Expires)
+}
+
+// VerifyPlayback checks a playback signature, returning ErrLinkInvalid or
+// ErrLinkExpired.
+func VerifyPlayback(claims PlaybackClaims, signature string, config common.AppConfig) error {
+	return verify(SignPlayback(claims, config), signature, claims.Expires)
+}
+
+// SignExportDownload signs a link to download a finished recording export.
+func SignExportDownload(id string, expires int64, config common.AppConfig) string {
+	return sign(config, "export", id, expires)
+}
+
+// VerifyExportDownload checks an export download signature, returning
+// ErrLinkInvalid or ErrLinkExpired.
+func VerifyExportDownload(id string, expires int64, signature string, config common.AppConfig) error {
+	return verify(SignExportDownload(id, expires, config), signature, expires)
+}
+
+// sign is the HMAC-SHA256 of fields under SECRET_KEY. The purpose comes first
+// so a signature made for one kind of link can never pass for another.
+func sign(config common.AppConfig, purpose string, fields ...any) string {
+	mac := hmac.New(sha256.New, []byte(config.App.SECRET_KEY))
+	fmt.Fprint(mac, purpose)
+	for _, field := range fields {
+		fmt.Fprintf(mac, "\n%v", field)
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func verify(expected, signature string, expires int64) error {
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return ErrLinkInvalid
+	}
+	if time.Now().Unix() > expires {
+		return ErrLinkExpired
+	}
+	return nil
+}
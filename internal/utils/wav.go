@@ -0,0 +1,158 @@
+package utils
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// MaxWAVHeaderSize is how far into a WAV file the data chunk must start for
+// ReadWAVHeader to find it.
+const MaxWAVHeaderSize = 64 << 10
+
+// WAV format tags.
+const (
+	WAVFormatPCM        = 0x0001
+	WAVFormatIEEEFloat  = 0x0003
+	WAVFormatALaw       = 0x0006
+	WAVFormatMuLaw      = 0x0007
+	WAVFormatExtensible = 0xFFFE
+)
+
+var wavCodecs = map[uint16]string{
+	WAVFormatPCM:       "pcm",
+	0x0002:             "ms_adpcm",
+	WAVFormatIEEEFloat: "pcm_float",
+	WAVFormatALaw:      "alaw",
+	WAVFormatMuLaw:     "mulaw",
+	0x0011:             "ima_adpcm",
+	0x0031:             "gsm610",
+	0x0055:             "mp3",
+}
+
+// ErrNotWAV is returned for data that isn't a RIFF WAVE file.
+var ErrNotWAV = errors.New("not a WAV file")
+
+// WAVHeader describes the audio in a WAV file, as read from its header.
+type WAVHeader struct {
+	// FormatTag is the codec; for WAVE_FORMAT_EXTENSIBLE files it is the
+	// sub-format.
+	FormatTag     uint16
+	Channels      int
+	SampleRate    int
+	ByteRate      int
+	BlockAlign    int
+	BitsPerSample int
+	// DataOffset and DataSize locate the samples in the file.
+	DataOffset int64
+	DataSize   int64
+	// Frames is the length in samples per channel, from the fact chunk where
+	// there is one. It is zero when not known.
+	Frames int64
+}
+
+// Codec names the format of the samples, e.g. "pcm" or "mulaw".
+func (h *WAVHeader) Codec() string {
+	if codec, ok := wavCodecs[h.FormatTag]; ok {
+		return codec
+	}
+	return fmt.Sprintf("0x%04x", h.FormatTag)
+}
+
+// Duration is the playing time of the samples.
+func (h *WAVHeader) Duration() time.Duration {
+	switch {
+	case h.Frames > 0 && h.SampleRate > 0:
+		return time.Duration(float64(h.Frames) / float64(h.SampleRate) * float64(time.Second))
+	case h.ByteRate > 0:
+		return time.Duration(float64(h.DataSize) / float64(h.ByteRate) * float64(time.Second))
+	}
+	return 0
+}
+
+// ReadWAVHeader reads the header of a WAV file of the given size from r,
+// leaving r at the first sample. Writers streaming a recording often leave the
+// data chunk size unset, so the data is then taken to run to the end of the
+// file; size may be zero if unknown.
+func ReadWAVHeader(r io.Reader, size int64) (*WAVHeader, error) {
+	var riff [12]byte
+	if _, err := io.ReadFull(r, riff[:]); err != nil {
+		return nil, ErrNotWAV
+	}
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return nil, ErrNotWAV
+	}
+
+	var header WAVHeader
+	var haveFormat bool
+	offset := int64(len(riff))
+
+	for offset < MaxWAVHeaderSize {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			return nil, fmt.Errorf("WAV file has no data chunk: %w", err)
+		}
+		offset += int64(len(chunk))
+		id, chunkSize := string(chunk[0:4]), int64(binary.LittleEndian.Uint32(chunk[4:8]))
+
+		if id == "data" {
+			if !haveFormat {
+				return nil, errors.New("WAV data chunk precedes its format")
+			}
+			header.DataOffset, header.DataSize = offset, chunkSize
+			if size > 0 && (chunkSize == 0 || chunkSize == 0xFFFFFFFF || offset+chunkSize > size) {
+				header.DataSize = size - offset
+			}
+			return &header, nil
+		}
+
+		// Chunks are padded to an even length
+		padded := chunkSize + chunkSize&1
+		if offset+padded > MaxWAVHeaderSize {
+			break
+		}
+		body := make([]byte, padded)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return nil, fmt.Errorf("truncated WAV %q chunk: %w", id, err)
+		}
+		offset += padded
+
+		switch id {
+		case "fmt ":
+			if err := header.parseFormat(body[:chunkSize]); err != nil {
+				return nil, err
+			}
+			haveFormat = true
+		case "fact":
+			if chunkSize >= 4 {
+				header.Frames = int64(binary.LittleEndian.Uint32(body))
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("WAV data chunk not within the first %d bytes", MaxWAVHeaderSize)
+}
+
+func (h *WAVHeader) parseFormat(body []byte) error {
+	if len(body) < 16 {
+		return errors.New("WAV format chunk too short")
+	}
+	h.FormatTag = binary.LittleEndian.Uint16(body[0:2])
+	h.Channels = int(binary.LittleEndian.Uint16(body[2:4]))
+	h.SampleRate = int(binary.LittleEndian.Uint32(body[4:8]))
+	h.ByteRate = int(binary.LittleEndian.Uint32(body[8:12]))
+	h.BlockAlign = int(binary.LittleEndian.Uint16(body[12:14]))
+	h.BitsPerSample = int(binary.LittleEndian.Uint16(body[14:16]))
+
+	// The sub-format GUID starts with the format tag it stands for
+	if h.FormatTag == WAVFormatExtensible && len(body) >= 26 {
+		h.FormatTag = binary.LittleEndian.Uint16(body[24:26])
+	}
+
+	if h.Channels == 0 || h.SampleRate == 0 {
+		return errors.New("WAV format has no channels or sample rate")
+	}
+	return nil
+}
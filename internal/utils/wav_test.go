@@ -0,0 +1,175 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// wavChunk is a RIFF chunk. size overrides the length written in its header
+// when not zero.
+type wavChunk struct {
+	id   string
+	body []byte
+	size uint32
+}
+
+// buildWAV assembles a RIFF WAVE file from chunks, padding odd ones.
+func buildWAV(chunks ...wavChunk) []byte {
+	var body bytes.Buffer
+	body.WriteString("WAVE")
+	for _, chunk := range chunks {
+		size := chunk.size
+		if size == 0 {
+			size = uint32(len(chunk.body))
+		}
+		body.WriteString(chunk.id)
+		binary.Write(&body, binary.LittleEndian, size)
+		body.Write(chunk.body)
+		if len(chunk.body)%2 == 1 && chunk.id != "data" {
+			body.WriteByte(0)
+		}
+	}
+
+	var file bytes.Buffer
+	file.WriteString("RIFF")
+	binary.Write(&file, binary.LittleEndian, uint32(body.Len()))
+	file.Write(body.Bytes())
+	return file.Bytes()
+}
+
+// fmtChunk describes interleaved samples of bits each.
+func fmtChunk(formatTag uint16, channels, sampleRate, bits int) wavChunk {
+	blockAlign := channels * bits / 8
+	var body bytes.Buffer
+	for _, field := range []any{formatTag, uint16(channels), uint32(sampleRate), uint32(sampleRate * blockAlign), uint16(blockAlign), uint16(bits)} {
+		binary.Write(&body, binary.LittleEndian, field)
+	}
+	return wavChunk{id: "fmt ", body: body.Bytes()}
+}
+
+// extensibleChunk is fmtChunk in WAVE_FORMAT_EXTENSIBLE form, with subFormat
+// as the first two bytes of its sub-format GUID.
+func extensibleChunk(subFormat uint16, channels, sampleRate, bits int) wavChunk {
+	chunk := fmtChunk(WAVFormatExtensible, channels, sampleRate, bits)
+	extension := make([]byte, 24)
+	binary.LittleEndian.PutUint16(extension[0:2], 22)
+	binary.LittleEndian.PutUint16(extension[8:10], subFormat)
+	chunk.body = append(chunk.body, extension...)
+	return chunk
+}
+
+func factChunk(frames uint32) wavChunk {
+	return wavChunk{id: "fact", body: binary.LittleEndian.AppendUint32(nil, frames)}
+}
+
+func TestReadWAVHeader(t *testing.T) {
+	samples := make([]byte, 16000)
+
+	tests := []struct {
+		name         string
+		file         []byte
+		size         int64
+		wantCodec    string
+		wantOffset   int64
+		wantDataSize int64
+		wantDuration time.Duration
+		wantErr      error
+	}{
+		{
+			name:         "16-bit PCM",
+			file:         buildWAV(fmtChunk(WAVFormatPCM, 1, 8000, 16), wavChunk{id: "data", body: samples}),
+			wantCodec:    "pcm",
+			wantOffset:   44,
+			wantDataSize: 16000,
+			wantDuration: time.Second,
+		},
+		{
+			name:         "µ-law with a fact chunk",
+			file:         buildWAV(fmtChunk(WAVFormatMuLaw, 1, 8000, 8), factChunk(4000), wavChunk{id: "data", body: samples}),
+			wantCodec:    "mulaw",
+			wantOffset:   56,
+			wantDataSize: 16000,
+			wantDuration: 500 * time.Millisecond,
+		},
+		{
+			name:         "extensible A-law",
+			file:         buildWAV(extensibleChunk(WAVFormatALaw, 2, 8000, 8), wavChunk{id: "data", body: samples}),
+			wantCodec:    "alaw",
+			wantOffset:   68,
+			wantDataSize: 16000,
+			wantDuration: time.Second,
+		},
+		{
+			name:         "odd chunk before the data",
+			file:         buildWAV(fmtChunk(WAVFormatPCM, 1, 8000, 16), wavChunk{id: "LIST", body: []byte("odd")}, wavChunk{id: "data", body: samples}),
+			wantCodec:    "pcm",
+			wantOffset:   56,
+			wantDataSize: 16000,
+			wantDuration: time.Second,
+		},
+		{
+			name:         "streamed with the data size unset",
+			file:         buildWAV(fmtChunk(WAVFormatPCM, 1, 8000, 16), wavChunk{id: "data", body: samples, size: 0xFFFFFFFF}),
+			size:         44 + 16000,
+			wantCodec:    "pcm",
+			wantOffset:   44,
+			wantDataSize: 16000,
+			wantDuration: time.Second,
+		},
+		{
+			name:         "data size past the end of the file",
+			file:         buildWAV(fmtChunk(WAVFormatPCM, 1, 8000, 16), wavChunk{id: "data", body: samples, size: 1 << 30}),
+			size:         44 + 8000,
+			wantCodec:    "pcm",
+			wantOffset:   44,
+			wantDataSize: 8000,
+			wantDuration: 500 * time.Millisecond,
+		},
+		{
+			name:    "not RIFF",
+			file:    []byte("ID3\x03\x00\x00\x00\x00\x00\x00\x00\x00 mp3"),
+			wantErr: ErrNotWAV,
+		},
+		{
+			name:    "too short",
+			file:    []byte("RIFF"),
+			wantErr: ErrNotWAV,
+		},
+		{name: "data before format", file: buildWAV(wavChunk{id: "data", body: samples}, fmtChunk(WAVFormatPCM, 1, 8000, 16))},
+		{name: "no data chunk", file: buildWAV(fmtChunk(WAVFormatPCM, 1, 8000, 16))},
+		{name: "no sample rate", file: buildWAV(fmtChunk(WAVFormatPCM, 1, 0, 16), wavChunk{id: "data", body: samples})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bytes.NewReader(tt.file)
+			header, err := ReadWAVHeader(r, tt.size)
+
+			if tt.wantCodec == "" {
+				if err == nil || tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got error %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadWAVHeader: %v", err)
+			}
+			if header.Codec() != tt.wantCodec || header.DataOffset != tt.wantOffset || header.DataSize != tt.wantDataSize {
+				t.Errorf("got %s data at %d of %d bytes, want %s at %d of %d",
+					header.Codec(), header.DataOffset, header.DataSize, tt.wantCodec, tt.wantOffset, tt.wantDataSize)
+			}
+			if header.Duration() != tt.wantDuration {
+				t.Errorf("got duration %v, want %v", header.Duration(), tt.wantDuration)
+			}
+
+			// The reader is left at the first sample
+			if read, _ := io.Copy(io.Discard, r); int64(len(tt.file))-read != header.DataOffset {
+				t.Errorf("left the reader at %d, want %d", int64(len(tt.file))-read, header.DataOffset)
+			}
+		})
+	}
+}
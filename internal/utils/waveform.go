@@ -0,0 +1,190 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// ErrUnsupportedCodec is returned for WAV files whose samples can't be decoded
+// to draw a waveform.
+var ErrUnsupportedCodec = errors.New("unsupported codec")
+
+// ErrNoSamples is returned for WAV files without a single sample to draw.
+var ErrNoSamples = errors.New("no samples")
+
+// Waveform holds the lowest and highest sample of each stretch of a recording,
+// in the waveform-data JSON format drawn by peaks.js. Channels are merged, and
+// Data alternates the minimum and maximum of each point.
+type Waveform struct {
+	Version         int    `json:"version"`
+	Channels        int    `json:"channels"`
+	SampleRate      int    `json:"sample_rate"`
+	SamplesPerPixel int    `json:"samples_per_pixel"`
+	Bits            int    `json:"bits"`
+	Length          int    `json:"length"`
+	Data            []int8 `json:"data"`
+}
+
+// ComputeWaveform reads a WAV file of the given size from r and reduces it to
+// at most points pairs of peaks, points being positive. The file is read
+// once, front to back. When neither size nor the header tells how long the
+// recording is, as for a stream whose writer left the data size unset, the
+// peaks are merged pairwise whenever they grow past twice points.
+func ComputeWaveform(r io.Reader, size int64, points int) (*Waveform, error) {
+	header, err := ReadWAVHeader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	decode, err := sampleDecoder(header)
+	if err != nil {
+		return nil, err
+	}
+
+	// ReadWAVHeader only replaces an unset data size when it knows the size
+	unknownLength := size <= 0 && (header.DataSize == 0 || header.DataSize == 0xFFFFFFFF)
+
+	var body io.Reader = r
+	perPoint, capacity := 1, 4*points
+	if !unknownLength {
+		frames := header.DataSize / int64(header.BlockAlign)
+		body = io.LimitReader(r, frames*int64(header.BlockAlign))
+		perPoint = max(1, int((frames+int64(points)-1)/int64(points)))
+		capacity = 2 * int(min(int64(points), frames))
+	}
+	waveform := &Waveform{
+		Version:    2,
+		Channels:   1,
+		SampleRate: header.SampleRate,
+		Bits:       8,
+		Data:       make([]int8, 0, capacity),
+	}
+
+	reader := bufio.NewReaderSize(body, 64<<10)
+	frame := make([]byte, header.BlockAlign)
+	sampleSize := header.BlockAlign / header.Channels
+	low, high, inPoint := 1.0, -1.0, 0
+
+	for {
+		if _, err := io.ReadFull(reader, frame); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				break
+			}
+			return nil, err
+		}
+		for channel := 0; channel < header.Channels; channel++ {
+			sample := decode(frame[channel*sampleSize : (channel+1)*sampleSize])
+			low, high = min(low, sample), max(high, sample)
+		}
+		if inPoint++; inPoint == perPoint {
+			waveform.Data = append(waveform.Data, peak(low), peak(high))
+			low, high, inPoint = 1.0, -1.0, 0
+			if len(waveform.Data) == 4*points {
+				waveform.Data = mergePeaks(waveform.Data)
+				perPoint *= 2
+			}
+		}
+	}
+	if inPoint > 0 {
+		waveform.Data = append(waveform.Data, peak(low), peak(high))
+	}
+	if len(waveform.Data) == 0 {
+		return nil, ErrNoSamples
+	}
+	if len(waveform.Data) > 2*points {
+		waveform.Data = mergePeaks(waveform.Data)
+		perPoint *= 2
+	}
+
+	waveform.SamplesPerPixel = perPoint
+	waveform.Length = len(waveform.Data) / 2
+	return waveform, nil
+}
+
+// mergePeaks merges each pair of points in data into one, in place. An odd
+// last point is kept as is.
+func mergePeaks(data []int8) []int8 {
+	merged := data[:0]
+	for i := 0; i < len(data); i += 4 {
+		low, high := data[i], data[i+1]
+		if i+3 < len(data) {
+			low, high = min(low, data[i+2]), max(high, data[i+3])
+		}
+		merged = append(merged, low, high)
+	}
+	return merged
+}
+
+// peak scales a sample in [-1, 1] to 8 bits.
+func peak(sample float64) int8 {
+	return int8(math.Round(max(-1, min(1, sample)) * 127))
+}
+
+// sampleDecoder returns a function decoding one sample of the file's format
+// to [-1, 1].
+func sampleDecoder(header *WAVHeader) (func([]byte) float64, error) {
+	if header.Channels <= 0 || header.BlockAlign < header.Channels || header.BlockAlign%header.Channels != 0 {
+		return nil, fmt.Errorf("invalid WAV block alignment %d for %d channels", header.BlockAlign, header.Channels)
+	}
+	sampleSize := header.BlockAlign / header.Channels
+
+	switch header.FormatTag {
+	case WAVFormatPCM:
+		switch sampleSize {
+		case 1:
+			// 8-bit PCM is unsigned
+			return func(b []byte) float64 { return (float64(b[0]) - 128) / 128 }, nil
+		case 2:
+			return func(b []byte) float64 { return float64(int16(binary.LittleEndian.Uint16(b))) / (1 << 15) }, nil
+		case 3:
+			return func(b []byte) float64 {
+				return float64(int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24)>>8) / (1 << 23)
+			}, nil
+		case 4:
+			return func(b []byte) float64 { return float64(int32(binary.LittleEndian.Uint32(b))) / (1 << 31) }, nil
+		}
+	case WAVFormatIEEEFloat:
+		switch sampleSize {
+		case 4:
+			return func(b []byte) float64 { return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))) }, nil
+		case 8:
+			return func(b []byte) float64 { return math.Float64frombits(binary.LittleEndian.Uint64(b)) }, nil
+		}
+	case WAVFormatALaw:
+		if sampleSize == 1 {
+			return func(b []byte) float64 { return float64(alawToLinear(b[0])) / (1 << 15) }, nil
+		}
+	case WAVFormatMuLaw:
+		if sampleSize == 1 {
+			return func(b []byte) float64 { return float64(mulawToLinear(b[0])) / (1 << 15) }, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s with %d-byte samples", ErrUnsupportedCodec, header.Codec(), sampleSize)
+}
+
+// alawToLinear expands a G.711 A-law sample to 16-bit linear PCM.
+func alawToLinear(a byte) int16 {
+	a ^= 0x55
+	magnitude := int16(a&0x0F)<<4 + 8
+	if exponent := (a & 0x70) >> 4; exponent > 0 {
+		magnitude = (magnitude + 0x100) << (exponent - 1)
+	}
+	if a&0x80 == 0 {
+		return -magnitude
+	}
+	return magnitude
+}
+
+// mulawToLinear expands a G.711 µ-law sample to 16-bit linear PCM.
+func mulawToLinear(u byte) int16 {
+	u = ^u
+	magnitude := (int16(u&0x0F)<<3 + 0x84) << ((u & 0x70) >> 4)
+	if u&0x80 != 0 {
+		return 0x84 - magnitude
+	}
+	return magnitude - 0x84
+}
@@ -0,0 +1,193 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestComputeWaveform(t *testing.T) {
+	// One second of 16-bit PCM: silence, then a full-scale square wave, then
+	// half scale
+	pcm16 := make([]byte, 0, 16000)
+	for i := 0; i < 8000; i++ {
+		var sample int16
+		switch {
+		case i >= 6000:
+			sample = 16384
+		case i >= 2000 && i%2 == 0:
+			sample = 32767
+		case i >= 2000:
+			sample = -32768
+		}
+		pcm16 = binary.LittleEndian.AppendUint16(pcm16, uint16(sample))
+	}
+
+	// Stereo 8-bit PCM, unsigned, with the peaks on different channels
+	pcm8 := []byte{128, 128, 255, 128, 128, 0, 128, 128}
+
+	tests := []struct {
+		name     string
+		file     []byte
+		points   int
+		wantPer  int
+		wantData []int8
+	}{
+		{
+			name:     "16-bit PCM",
+			file:     buildWAV(fmtChunk(WAVFormatPCM, 1, 8000, 16), wavChunk{id: "data", body: pcm16}),
+			points:   4,
+			wantPer:  2000,
+			wantData: []int8{0, 0, -127, 127, -127, 127, 64, 64},
+		},
+		{
+			name:     "stereo 8-bit PCM",
+			file:     buildWAV(fmtChunk(WAVFormatPCM, 2, 8000, 8), wavChunk{id: "data", body: pcm8}),
+			points:   2,
+			wantPer:  2,
+			wantData: []int8{0, 126, -127, 0},
+		},
+		{
+			name:     "more points than frames",
+			file:     buildWAV(fmtChunk(WAVFormatPCM, 2, 8000, 8), wavChunk{id: "data", body: pcm8}),
+			points:   100,
+			wantPer:  1,
+			wantData: []int8{0, 0, 0, 126, -127, 0, 0, 0},
+		},
+		{
+			name:     "A-law",
+			file:     buildWAV(fmtChunk(WAVFormatALaw, 1, 8000, 8), wavChunk{id: "data", body: []byte{0xD5, 0xAA, 0x2A, 0xD5}}),
+			points:   2,
+			wantPer:  2,
+			wantData: []int8{0, 125, -125, 0},
+		},
+		{
+			name:     "µ-law, odd frame count",
+			file:     buildWAV(fmtChunk(WAVFormatMuLaw, 1, 8000, 8), wavChunk{id: "data", body: []byte{0xFF, 0x80, 0x00}}),
+			points:   2,
+			wantPer:  2,
+			wantData: []int8{0, 125, -125, -125},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			waveform, err := ComputeWaveform(bytes.NewReader(tt.file), int64(len(tt.file)), tt.points)
+			if err != nil {
+				t.Fatalf("ComputeWaveform: %v", err)
+			}
+			if waveform.SamplesPerPixel != tt.wantPer || waveform.SampleRate != 8000 || waveform.Channels != 1 || waveform.Bits != 8 {
+				t.Errorf("got %d samples per pixel at %d Hz, %d channels, %d bits; want %d at 8000 Hz, 1 channel, 8 bits",
+					waveform.SamplesPerPixel, waveform.SampleRate, waveform.Channels, waveform.Bits, tt.wantPer)
+			}
+			if !slices.Equal(waveform.Data, tt.wantData) || waveform.Length != len(tt.wantData)/2 {
+				t.Errorf("got %d points %v, want %v", waveform.Length, waveform.Data, tt.wantData)
+			}
+		})
+	}
+}
+
+func TestComputeWaveformStreamed(t *testing.T) {
+	var pcm16 []byte
+	for _, sample := range []int16{0, 32767, 0, 0, -32768, 0, 16384, 0, 0} {
+		pcm16 = binary.LittleEndian.AppendUint16(pcm16, uint16(sample))
+	}
+	// streamed builds a WAV file whose writer left the data size as dataSize
+	streamed := func(body []byte, dataSize uint32) []byte {
+		file := buildWAV(fmtChunk(WAVFormatPCM, 1, 8000, 16), wavChunk{id: "data", body: body, size: 0xFFFFFFFF})
+		binary.LittleEndian.PutUint32(file[len(file)-len(body)-4:], dataSize)
+		return file
+	}
+
+	tests := []struct {
+		name     string
+		file     []byte
+		wantPer  int
+		wantData []int8
+	}{
+		{
+			name:     "size unset",
+			file:     streamed(pcm16[:16], 0xFFFFFFFF),
+			wantPer:  4,
+			wantData: []int8{0, 127, -127, 64},
+		},
+		{
+			name:     "size zero",
+			file:     streamed(pcm16[:16], 0),
+			wantPer:  4,
+			wantData: []int8{0, 127, -127, 64},
+		},
+		{
+			name:     "odd point left over",
+			file:     streamed(pcm16, 0xFFFFFFFF),
+			wantPer:  8,
+			wantData: []int8{-127, 127, 0, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			waveform, err := ComputeWaveform(bytes.NewReader(tt.file), -1, 2)
+			if err != nil {
+				t.Fatalf("ComputeWaveform: %v", err)
+			}
+			if waveform.SamplesPerPixel != tt.wantPer {
+				t.Errorf("got %d samples per pixel, want %d", waveform.SamplesPerPixel, tt.wantPer)
+			}
+			if !slices.Equal(waveform.Data, tt.wantData) || waveform.Length != len(tt.wantData)/2 {
+				t.Errorf("got %d points %v, want %v", waveform.Length, waveform.Data, tt.wantData)
+			}
+		})
+	}
+
+	if _, err := ComputeWaveform(bytes.NewReader(streamed(nil, 0)), -1, 2); !errors.Is(err, ErrNoSamples) {
+		t.Errorf("empty recording: got %v, want ErrNoSamples", err)
+	}
+}
+
+func TestComputeWaveformUnsupported(t *testing.T) {
+	tests := []struct {
+		name string
+		file []byte
+	}{
+		{name: "MP3", file: buildWAV(fmtChunk(0x0055, 1, 8000, 16), wavChunk{id: "data", body: make([]byte, 64)})},
+		{name: "16-bit µ-law", file: buildWAV(fmtChunk(WAVFormatMuLaw, 1, 8000, 16), wavChunk{id: "data", body: make([]byte, 64)})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ComputeWaveform(bytes.NewReader(tt.file), int64(len(tt.file)), 10)
+			if !errors.Is(err, ErrUnsupportedCodec) {
+				t.Errorf("got %v, want ErrUnsupportedCodec", err)
+			}
+		})
+	}
+}
+
+func TestG711ToLinear(t *testing.T) {
+	tests := []struct {
+		name   string
+		decode func(byte) int16
+		code   byte
+		want   int16
+	}{
+		{name: "A-law smallest positive", decode: alawToLinear, code: 0xD5, want: 8},
+		{name: "A-law smallest negative", decode: alawToLinear, code: 0x55, want: -8},
+		{name: "A-law segment 1", decode: alawToLinear, code: 0xC5, want: 264},
+		{name: "A-law largest positive", decode: alawToLinear, code: 0xAA, want: 32256},
+		{name: "A-law largest negative", decode: alawToLinear, code: 0x2A, want: -32256},
+		{name: "µ-law zero", decode: mulawToLinear, code: 0xFF, want: 0},
+		{name: "µ-law negative zero", decode: mulawToLinear, code: 0x7F, want: 0},
+		{name: "µ-law smallest positive", decode: mulawToLinear, code: 0xFE, want: 8},
+		{name: "µ-law largest positive", decode: mulawToLinear, code: 0x80, want: 32124},
+		{name: "µ-law largest negative", decode: mulawToLinear, code: 0x00, want: -32124},
+	}
+
+	for _, tt := range tests {
+		if got := tt.decode(tt.code); got != tt.want {
+			t.Errorf("%s: decoded 0x%02X to %d, want %d", tt.name, tt.code, got, tt.want)
+		}
+	}
+}
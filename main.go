@@ -14,6 +14,14 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "backfill" {
+		if err := runBackfill(os.Args[2:]); err != nil {
+			slog.Error("backfill failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), common.Timeouts.Server.Startup)
 	defer cancel()
 